@@ -0,0 +1,399 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// The kinds of corporate action.
+const (
+	actionSplit  = "split"
+	actionRename = "rename"
+)
+
+// corporateAction is a split or ticker change of a held symbol. Recording
+// one adjusts the lots bought before Date, so returns compare like with
+// like: a split multiplies their units by Ratio, keeping their cost, and
+// divides their dividends per unit, price targets and recorded prices by
+// it; a rename moves them and their history to NewSymbol.
+type corporateAction struct {
+	Type   string    `json:"type"` // split or rename
+	Symbol string    `json:"symbol"`
+	Date   time.Time `json:"date"`
+	// Ratio is the units after a split per unit before, 4 for a 4:1 split
+	// and 0.1 for a 1:10 reverse split.
+	Ratio     decimal.Decimal `json:"ratio,omitempty"`
+	NewSymbol string          `json:"new_symbol,omitempty"`
+}
+
+func (a corporateAction) String() string {
+	if a.Type == actionRename {
+		return fmt.Sprintf("%s %s %s -> %s", a.Date.Format(humanDate), a.Type, a.Symbol, a.NewSymbol)
+	}
+	return fmt.Sprintf("%s %s %s %s", a.Date.Format(humanDate), a.Type, a.Symbol, a.Ratio)
+}
+
+// parseRatio reads a split ratio such as "4:1", or a plain number of new
+// units per old unit.
+func parseRatio(s string) (decimal.Decimal, error) {
+	parts := strings.Split(s, ":")
+	r, err := decimal.NewFromString(parts[0])
+	if err == nil && len(parts) == 2 {
+		var per decimal.Decimal
+		if per, err = decimal.NewFromString(parts[1]); err == nil && per.IsPositive() {
+			r = r.Div(per)
+		}
+	}
+	if err != nil || len(parts) > 2 || !r.IsPositive() {
+		return decimal.Decimal{}, fmt.Errorf("bad split ratio %q, want e.g. 4:1", s)
+	}
+	return r, nil
+}
+
+// adjust applies a to i if i is a lot of its symbol bought before it, and
+// reports whether it did.
+func (a corporateAction) adjust(i *investment) bool {
+	if i.Symbol != a.Symbol || !i.Date.Before(a.Date) {
+		return false
+	}
+	if a.Type == actionRename {
+		i.Symbol = a.NewSymbol
+		return true
+	}
+	// a reverse split such as 1:3 leaves a ratio that never ends
+	i.Units = i.Units.Mul(a.Ratio).Round(maxUnitPlaces)
+	for k, d := range i.Dividends {
+		if d.Date.Before(a.Date) {
+			i.Dividends[k].PerUnit = d.PerUnit.Div(a.Ratio)
+		}
+	}
+	if i.BuyBelow != nil {
+		p := i.BuyBelow.Div(a.Ratio)
+		i.BuyBelow = &p
+	}
+	if i.SellAbove != nil {
+		p := i.SellAbove.Div(a.Ratio)
+		i.SellAbove = &p
+	}
+	return true
+}
+
+// adjustLot applies the recorded actions dated after i was bought, in the
+// order they happened, so a lot added late is held as it is today.
+func (c config) adjustLot(i *investment) {
+	actions := append([]corporateAction(nil), c.Actions...)
+	sort.SliceStable(actions, func(a, b int) bool { return actions[a].Date.Before(actions[b].Date) })
+	for _, a := range actions {
+		a.adjust(i)
+	}
+}
+
+// recordAction adds a to conf and adjusts the lots it applies to,
+// returning how many. An action recorded before, or one no lot is bought
+// before, is left out. The recorded history is adjusted by saveActions once
+// conf is written.
+func recordAction(conf *config, a corporateAction) int {
+	for _, o := range conf.Actions {
+		if o.Type == a.Type && o.Symbol == a.Symbol && o.Date.Equal(a.Date) {
+			return 0
+		}
+	}
+	adjusted := 0
+	for n := range conf.Investments {
+		if a.adjust(&conf.Investments[n]) {
+			adjusted++
+		}
+	}
+	if adjusted > 0 {
+		conf.Actions = append(conf.Actions, a)
+	}
+	return adjusted
+}
+
+// saveActions writes conf, with actions recorded in it, and only then
+// adjusts the history of every portfolio to them, so a failure can never
+// leave prices adjusted for an action the config does not have, or adjust
+// them twice when it is retried.
+func saveActions(confFile string, conf config, actions []corporateAction) error {
+	if err := writeConfig(confFile, conf); err != nil {
+		return err
+	}
+	stores := actionStores(confFile, conf)
+	for _, a := range actions {
+		for _, s := range stores {
+			var err error
+			if a.Type == actionRename {
+				err = s.rename(a.Symbol, a.NewSymbol)
+			} else {
+				err = s.rewrite(a.Symbol, func(p performance) performance {
+					if p.Date.Before(a.Date) {
+						p.Price = p.Price.Div(a.Ratio)
+					}
+					return p
+				})
+			}
+			if err != nil {
+				return fmt.Errorf("%s recorded, but its history was not adjusted: %v", a, err)
+			}
+		}
+	}
+	return nil
+}
+
+// actionStores returns the history stores of conf that record prices: the
+// combined one and each portfolio's.
+func actionStores(confFile string, conf config) []historyStore {
+	root := historyRoot(confFile, conf)
+	stores := []historyStore{root}
+	for _, name := range portfolioNames(conf) {
+		stores = append(stores, root.portfolio(name))
+	}
+	return stores
+}
+
+// rewrite replaces every entry recorded for symbol with fn of it.
+func (s historyStore) rewrite(symbol string, fn func(performance) performance) error {
+	if !s.writable() {
+		return errReadOnly
+	}
+	history, err := s.load(symbol)
+	if err != nil || len(history) == 0 {
+		return err
+	}
+	for k, p := range history {
+		history[k] = fn(p)
+	}
+	return s.write(symbol, history)
+}
+
+// rename moves the history of symbol to to. Where to already has a
+// history, the entries of symbol from before its first one are kept.
+func (s historyStore) rename(symbol, to string) error {
+	if !s.writable() {
+		return errReadOnly
+	}
+	old, err := s.load(symbol)
+	if err != nil || len(old) == 0 {
+		return err
+	}
+	history, err := s.load(to)
+	if err != nil {
+		return err
+	}
+	var merged []performance
+	for _, p := range old {
+		if len(history) == 0 || p.Date.Before(history[0].Date) {
+			p.Symbol = to
+			merged = append(merged, p)
+		}
+	}
+	if err := s.write(to, append(merged, history...)); err != nil {
+		return err
+	}
+	return os.Remove(s.path(symbol))
+}
+
+// write replaces the history of symbol with history.
+func (s historyStore) write(symbol string, history []performance) error {
+	// in the same directory so the rename stays on one file system
+	tmp, err := ioutil.TempFile(s.dir, ".rewrite-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	enc := json.NewEncoder(tmp)
+	for _, p := range history {
+		if err := enc.Encode(p); err != nil {
+			return err
+		}
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path(symbol))
+}
+
+// fetchSplits returns the splits of symbol since from that Yahoo knows of,
+// asking at most once a day.
+func fetchSplits(ctx context.Context, store historyStore, symbol string, from time.Time) ([]corporateAction, error) {
+	var body struct {
+		Chart struct {
+			Result []struct {
+				Events struct {
+					Splits map[string]struct {
+						Date        int64   `json:"date"`
+						Numerator   float64 `json:"numerator"`
+						Denominator float64 `json:"denominator"`
+					} `json:"splits"`
+				} `json:"events"`
+			} `json:"result"`
+			Error *struct {
+				Description string `json:"description"`
+			} `json:"error"`
+		} `json:"chart"`
+	}
+	key := "splits-" + symbol + "-" + from.Format(isoDate)
+	fresh, err := store.loadCache(key, 24*time.Hour, &body)
+	if err != nil {
+		return nil, err
+	}
+	if !fresh {
+		u := fmt.Sprintf("https://query2.finance.yahoo.com/v8/finance/chart/%s?period1=%d&period2=%d&interval=1d&events=split",
+			url.PathEscape(symbol), from.Unix(), clock().Unix())
+		err := fetchRetry.do(ctx, "yahoo", func(ctx context.Context) error {
+			req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+			if err != nil {
+				return err
+			}
+			req.Header.Set("User-Agent", "Mozilla/5.0")
+			resp, err := yahooClient.Do(req)
+			if err != nil {
+				return err
+			}
+			defer resp.Body.Close()
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				return fmt.Errorf("%s: %s: %v", symbol, resp.Status, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if e := body.Chart.Error; e != nil {
+			return nil, fmt.Errorf("%s: %s", symbol, e.Description)
+		}
+		if err := store.saveCache(key, body); err != nil {
+			return nil, err
+		}
+	}
+	var splits []corporateAction
+	for _, r := range body.Chart.Result {
+		for _, s := range r.Events.Splits {
+			if s.Numerator <= 0 || s.Denominator <= 0 {
+				continue
+			}
+			splits = append(splits, corporateAction{
+				Type:   actionSplit,
+				Symbol: symbol,
+				Date:   startOfDay(time.Unix(s.Date, 0).UTC()),
+				Ratio:  decimal.NewFromFloat(s.Numerator).Div(decimal.NewFromFloat(s.Denominator)),
+			})
+		}
+	}
+	sort.Slice(splits, func(a, b int) bool { return splits[a].Date.Before(splits[b].Date) })
+	return splits, nil
+}
+
+// detectSplits records in conf the splits Yahoo reports for the held symbols it
+// prices since their first purchase, returning the ones that were new.
+// Symbols priced by a plugin are skipped.
+func detectSplits(ctx context.Context, confFile string, conf *config) ([]corporateAction, error) {
+	first := make(map[string]time.Time)
+	for _, i := range conf.Investments {
+		if i.Provider != "" {
+			continue
+		}
+		if t, ok := first[i.Symbol]; !ok || i.Date.Before(t) {
+			first[i.Symbol] = i.Date
+		}
+	}
+	var symbols []string
+	for s := range first {
+		symbols = append(symbols, s)
+	}
+	sort.Strings(symbols)
+	store := historyRoot(confFile, *conf)
+	var found []corporateAction
+	for _, s := range symbols {
+		splits, err := fetchSplits(ctx, store, s, first[s])
+		if err != nil {
+			return found, err
+		}
+		for _, a := range splits {
+			if recordAction(conf, a) > 0 {
+				found = append(found, a)
+			}
+		}
+	}
+	return found, nil
+}
+
+// corporateActions handles "action": with no arguments it lists the
+// recorded actions, otherwise it records a split or rename, or detects
+// splits.
+func corporateActions(ctx context.Context, w io.Writer, confFile string, args []string) error {
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		for _, a := range conf.Actions {
+			fmt.Fprintln(w, a)
+		}
+		return nil
+	}
+	var added []corporateAction
+	switch {
+	case args[0] == "detect" && len(args) == 1:
+		if added, err = detectSplits(ctx, confFile, &conf); err != nil && len(added) == 0 {
+			return err
+		}
+		perr(err)
+	case args[0] == actionSplit && len(args) == 4:
+		a := corporateAction{Type: actionSplit, Symbol: strings.ToUpper(args[1])}
+		if a.Date, err = time.Parse(mmddyy, args[2]); err != nil {
+			return err
+		}
+		if a.Ratio, err = parseRatio(args[3]); err != nil {
+			return err
+		}
+		if recordAction(&conf, a) == 0 {
+			return fmt.Errorf("no %s lots bought before %s, or the split is already recorded", a.Symbol, args[2])
+		}
+		added = append(added, a)
+	case args[0] == actionRename && len(args) == 4:
+		a := corporateAction{Type: actionRename, Symbol: strings.ToUpper(args[1]), NewSymbol: strings.ToUpper(args[2])}
+		if a.Date, err = time.Parse(mmddyy, args[3]); err != nil {
+			return err
+		}
+		if a.Symbol == a.NewSymbol {
+			return errors.New("the new symbol is the old one")
+		}
+		if recordAction(&conf, a) == 0 {
+			return fmt.Errorf("no %s lots bought before %s, or the rename is already recorded", a.Symbol, args[3])
+		}
+		added = append(added, a)
+	default:
+		return errUsage
+	}
+	if len(added) == 0 {
+		fmt.Fprintln(w, conf.tr("no new corporate actions"))
+		return nil
+	}
+	if err := saveActions(confFile, conf, added); err != nil {
+		return err
+	}
+	for _, a := range added {
+		fmt.Fprintln(w, a)
+		if err := appendAudit(confFile, auditEntry{Action: a.Type, Detail: a.String()}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestReverseSplitValidates(t *testing.T) {
+	conf := config{Investments: []investment{{Symbol: "XYZ", Date: day("2020-01-02"),
+		Total: decimal.NewFromInt(1000), Units: decimal.NewFromInt(10)}}}
+	ratio, err := parseRatio("1:3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := corporateAction{Type: actionSplit, Symbol: "XYZ", Date: day("2021-01-04"), Ratio: ratio}
+	if n := recordAction(&conf, a); n != 1 {
+		t.Fatalf("recordAction adjusted %d lots, want 1", n)
+	}
+	if err := conf.validate(); err != nil {
+		t.Errorf("validate after a 1:3 split: %v", err)
+	}
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// alertRule fires an alert when a measure of a holding crosses a limit,
+// e.g. {"symbol":"AAPL","when":"day_change","below":-5} for a 5% drop in a
+// day or {"symbol":"*","when":"return","below":8} for any holding whose
+// compound interest falls under 8%. The measures are:
+//
+//	price       the latest price
+//	day_change  percent change from the previous close
+//	return      compound interest in percent, as in the report
+//
+// Notify names the notification channels to send to; all of them when
+// empty.
+type alertRule struct {
+	Symbol string   `json:"symbol"` // "*" for every holding
+	When   string   `json:"when"`
+	Below  *float64 `json:"below,omitempty"`
+	Above  *float64 `json:"above,omitempty"`
+	Notify []string `json:"notify,omitempty"`
+}
+
+func (r alertRule) validate(channels []channelConfig) error {
+	switch r.When {
+	case "price", "day_change", "return":
+	default:
+		return fmt.Errorf("alert rule %s: unknown measure %q, want price, day_change or return", r.Symbol, r.When)
+	}
+	if r.Symbol == "" {
+		return errors.New("alert rule: no symbol, use * for every holding")
+	}
+	if r.Below == nil && r.Above == nil {
+		return fmt.Errorf("alert rule %s %s: set below or above", r.Symbol, r.When)
+	}
+outer:
+	for _, name := range r.Notify {
+		for _, c := range channels {
+			if c.Name == name {
+				continue outer
+			}
+		}
+		return fmt.Errorf("alert rule %s %s: no notification channel named %q", r.Symbol, r.When, name)
+	}
+	return nil
+}
+
+// measureNames are how the measures read in alert messages.
+var measureNames = map[string]string{
+	"price":      "price",
+	"day_change": "day change %",
+	"return":     "return %",
+}
+
+// measure returns what r watches for symbol and whether it is known.
+func (r alertRule) measure(store historyStore, symbol string, latest map[string]performance, previous map[string]decimal.Decimal, now time.Time) (float64, bool) {
+	p, ok := latest[symbol]
+	if !ok {
+		return 0, false
+	}
+	switch r.When {
+	case "price":
+		return p.Price.InexactFloat64(), true
+	case "return":
+		return p.CompoundInterest, true
+	}
+	prev, ok := previous[symbol]
+	if !ok {
+		// without a previous close from the provider, use the last
+		// recorded day before this one
+		day := now.Format(isoDate)
+		store.each(symbol, func(h performance) error {
+			if h.Date.Format(isoDate) < day {
+				prev, ok = h.Price, true
+			}
+			return nil
+		})
+	}
+	if !ok || !prev.IsPositive() {
+		return 0, false
+	}
+	return 100 * (p.Price.Div(prev).InexactFloat64() - 1), true
+}
+
+// ruleAlerts returns an alert for every rule whose limit a holding is
+// beyond.
+func ruleAlerts(conf config, store historyStore, latest map[string]performance, previous map[string]decimal.Decimal, now time.Time) []alert {
+	var active []alert
+	for _, r := range conf.AlertRules {
+		symbols := []string{strings.ToUpper(r.Symbol)}
+		if r.Symbol == "*" {
+			symbols = heldSymbols(conf)
+		}
+		for _, s := range symbols {
+			v, ok := r.measure(store, s, latest, previous, now)
+			if !ok {
+				continue
+			}
+			if r.Below != nil && v < *r.Below {
+				active = append(active, alert{
+					ID:       fmt.Sprintf("%s-%s-below-%g", s, r.When, *r.Below),
+					Message:  fmt.Sprintf(conf.tr("%s %s is %.2f, below %g"), s, conf.tr(measureNames[r.When]), v, *r.Below),
+					channels: r.Notify,
+				})
+			}
+			if r.Above != nil && v > *r.Above {
+				active = append(active, alert{
+					ID:       fmt.Sprintf("%s-%s-above-%g", s, r.When, *r.Above),
+					Message:  fmt.Sprintf(conf.tr("%s %s is %.2f, above %g"), s, conf.tr(measureNames[r.When]), v, *r.Above),
+					channels: r.Notify,
+				})
+			}
+		}
+	}
+	return active
+}
+
+// sendAlerts notifies about the alerts that are due, in one message per
+// set of channels they go to.
+func sendAlerts(ctx context.Context, conf config, due []alert, now time.Time) error {
+	groups := make(map[string][]string)
+	for _, a := range due {
+		key := strings.Join(a.channels, ",")
+		groups[key] = append(groups[key], fmt.Sprintf("%s (%s)", a.Message, a.ID))
+	}
+	var keys []string
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	subject := fmt.Sprintf(conf.tr("Alerts - %s"), now.Format(humanDate))
+	for _, k := range keys {
+		c := conf
+		if k != "" {
+			c.Notifications.Channels = nil
+			c.Plugins = nil
+			for _, ch := range conf.Notifications.Channels {
+				for _, name := range strings.Split(k, ",") {
+					if ch.Name == name {
+						c.Notifications.Channels = append(c.Notifications.Channels, ch)
+					}
+				}
+			}
+		}
+		if err := notify(ctx, c, subject, strings.Join(groups[k], "\n")+"\n", ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
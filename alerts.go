@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// alert is a condition that holds right now, such as a price beyond a
+// target. ID stays the same from run to run while it holds.
+type alert struct {
+	ID      string
+	Message string
+	// channels are the notification channels to send it to; all when empty.
+	channels []string
+}
+
+// alertState is what the store remembers about an alert between runs.
+type alertState struct {
+	Message      string    `json:"message"`
+	Fired        time.Time `json:"fired"`
+	Acked        bool      `json:"acked,omitempty"`
+	SnoozedUntil time.Time `json:"snoozed_until,omitempty"`
+}
+
+func (s historyStore) alertsPath() string {
+	return filepath.Join(s.dir, ".alerts.json")
+}
+
+func (s historyStore) loadAlerts() (map[string]*alertState, error) {
+	states := make(map[string]*alertState)
+	b, err := ioutil.ReadFile(s.alertsPath())
+	if os.IsNotExist(err) {
+		return states, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &states); err != nil {
+		return nil, fmt.Errorf("%s: %v", s.alertsPath(), err)
+	}
+	return states, nil
+}
+
+func (s historyStore) saveAlerts(states map[string]*alertState) error {
+	if readOnly {
+		return errReadOnly
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(states, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.alertsPath(), append(b, '\n'), 0644)
+}
+
+// fireAlerts returns the alerts in active that are due to be sent: those
+// that just started to hold and those whose snooze has run out. An alert
+// that was sent is not sent again while it keeps holding. Alerts that no
+// longer hold are forgotten, unless snoozed, so they fire again if they
+// come back. The new state is saved if persist is set.
+func fireAlerts(store historyStore, active []alert, now time.Time, persist bool) ([]alert, error) {
+	states, err := store.loadAlerts()
+	if err != nil {
+		return nil, err
+	}
+	var due []alert
+	holding := make(map[string]bool)
+	for _, a := range active {
+		holding[a.ID] = true
+		st := states[a.ID]
+		switch {
+		case st == nil:
+			st = &alertState{Fired: now}
+			states[a.ID] = st
+			due = append(due, a)
+		case now.Before(st.SnoozedUntil):
+		case !st.SnoozedUntil.IsZero():
+			st.Fired, st.Acked, st.SnoozedUntil = now, false, time.Time{}
+			due = append(due, a)
+		}
+		st.Message = a.Message
+	}
+	for id, st := range states {
+		if !holding[id] && !now.Before(st.SnoozedUntil) {
+			delete(states, id)
+		}
+	}
+	if !persist {
+		return due, nil
+	}
+	return due, store.saveAlerts(states)
+}
+
+// alerts handles "alerts list", "alerts ack ID" and "alerts snooze ID
+// DURATION", where DURATION is e.g. 7d or 12h.
+func alerts(w io.Writer, confFile string, args []string) error {
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	store := newHistoryStore(confFile, conf)
+	states, err := store.loadAlerts()
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 || args[0] == "list" {
+		var ids []string
+		for id := range states {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		for _, id := range ids {
+			st := states[id]
+			status := conf.tr("new")
+			switch {
+			case clock().Before(st.SnoozedUntil):
+				status = conf.tr("snoozed until") + " " + st.SnoozedUntil.Format(humanDate)
+			case st.Acked:
+				status = conf.tr("acknowledged")
+			}
+			fmt.Fprintf(w, "%s %s [%s] %s\n", id, st.Fired.Format(humanDate), status, st.Message)
+		}
+		return nil
+	}
+	if len(args) < 2 {
+		return errors.New("usage: alerts list, alerts ack ID, or alerts snooze ID DURATION")
+	}
+	st, ok := states[args[1]]
+	if !ok {
+		return fmt.Errorf("no alert %q, see alerts list", args[1])
+	}
+	switch {
+	case args[0] == "ack" && len(args) == 2:
+		st.Acked = true
+	case args[0] == "snooze" && len(args) == 3:
+		d, err := parseSnooze(args[2])
+		if err != nil {
+			return err
+		}
+		st.SnoozedUntil = clock().Add(d)
+	default:
+		return errors.New("usage: alerts list, alerts ack ID, or alerts snooze ID DURATION")
+	}
+	return store.saveAlerts(states)
+}
+
+// parseSnooze parses a duration that may also be given in days, e.g. 7d.
+func parseSnooze(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		n, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("bad snooze %q, want e.g. 7d or 12h", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("bad snooze %q, want e.g. 7d or 12h", s)
+	}
+	return d, nil
+}
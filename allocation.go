@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/shopspring/decimal"
+)
+
+// allocationConfig is the target asset allocation the report measures the
+// portfolio against, suggesting trades to rebalance it.
+type allocationConfig struct {
+	// Categories group symbols under a name, e.g.
+	// {"bonds": ["BND", "AGG"], "equity": ["VTI", "VXUS"]}.
+	Categories map[string][]string `json:"categories,omitempty"`
+	// Targets are the weights in percent of each category or symbol, which
+	// add up to 100. Holdings in none of them are targeted at 0%.
+	Targets map[string]float64 `json:"targets,omitempty"`
+	// Threshold is the drift in percentage points from a target below which
+	// no trade is suggested for it.
+	Threshold float64 `json:"threshold,omitempty"`
+}
+
+func (a allocationConfig) validate() error {
+	if len(a.Targets) == 0 {
+		return nil
+	}
+	var sum float64
+	for _, w := range a.Targets {
+		if w < 0 {
+			return errors.New("allocation: targets must not be negative")
+		}
+		sum += w
+	}
+	if math.Abs(sum-100) > 0.01 {
+		return fmt.Errorf("allocation: targets add up to %.2f%%, want 100%%", sum)
+	}
+	if a.Threshold < 0 {
+		return errors.New("allocation: threshold must not be negative")
+	}
+	in := make(map[string]string)
+	for name, symbols := range a.Categories {
+		if len(symbols) == 0 {
+			return fmt.Errorf("allocation: category %s has no symbols", name)
+		}
+		for _, s := range symbols {
+			if other, ok := in[s]; ok {
+				return fmt.Errorf("allocation: %s is in both %s and %s", s, other, name)
+			}
+			if _, ok := a.Targets[s]; ok {
+				return fmt.Errorf("allocation: %s has a target and is in %s", s, name)
+			}
+			in[s] = name
+		}
+	}
+	return nil
+}
+
+// group returns the target symbol belongs to: its category, or itself.
+func (a allocationConfig) group(symbol string) string {
+	for name, symbols := range a.Categories {
+		for _, s := range symbols {
+			if s == symbol {
+				return name
+			}
+		}
+	}
+	return symbol
+}
+
+// members returns the symbols traded to rebalance group.
+func (a allocationConfig) members(group string) []string {
+	if symbols, ok := a.Categories[group]; ok {
+		return symbols
+	}
+	return []string{group}
+}
+
+// trade is a suggested purchase, or a sale when units are negative.
+type trade struct {
+	symbol string
+	units  decimal.Decimal
+	amount float64 // in the base currency
+}
+
+// rebalance suggests whole-unit trades bringing each group drifting by at
+// least the threshold back to its target. A group's trade is spread over
+// its symbols by their current value, or goes to the first one when none
+// is held. prices are in the base currency.
+func (a allocationConfig) rebalance(values map[string]float64, prices map[string]float64, total float64) []trade {
+	groups := make(map[string]float64)
+	for s, v := range values {
+		groups[a.group(s)] += v
+	}
+	for g := range a.Targets {
+		if _, ok := groups[g]; !ok {
+			groups[g] = 0
+		}
+	}
+	var trades []trade
+	for g, v := range groups {
+		diff := total*a.Targets[g]/100 - v
+		if math.Abs(100*diff/total) < a.Threshold || diff == 0 {
+			continue
+		}
+		members := a.members(g)
+		for k, s := range members {
+			share := 1.0
+			if v > 0 {
+				share = values[s] / v
+			} else if k > 0 {
+				share = 0
+			}
+			p := prices[s]
+			if share == 0 || p <= 0 {
+				continue
+			}
+			units := decimal.NewFromFloat(diff * share / p).Truncate(0)
+			if units.IsZero() {
+				continue
+			}
+			trades = append(trades, trade{s, units, units.InexactFloat64() * p})
+		}
+	}
+	sort.Slice(trades, func(i, j int) bool { return trades[i].amount < trades[j].amount })
+	return trades
+}
+
+// printAllocation shows how far each target has drifted and the trades to
+// bring the portfolio back to the targets. Sales come first, so they fund
+// the purchases.
+func printAllocation(w io.Writer, conf config, store historyStore, latest map[string]performance) {
+	a := conf.Allocation
+	values := make(map[string]float64)
+	prices := make(map[string]float64)
+	var total float64
+	for s, v := range holdingValues(conf, latest) {
+		values[s] = v.InexactFloat64()
+		total += values[s]
+	}
+	if total <= 0 {
+		return
+	}
+	for _, i := range conf.Investments {
+		if p, ok := latest[i.Symbol]; ok {
+			prices[i.Symbol] = conf.toBase(i.Currency, p.Price).InexactFloat64()
+		}
+	}
+	fmt.Fprintf(w, "=== %s ===\n", conf.tr("Allocation"))
+	if err := a.validate(); err != nil {
+		fmt.Fprintf(w, "%v\n\n", err)
+		return
+	}
+	current := make(map[string]float64)
+	for s, v := range values {
+		current[a.group(s)] += v
+	}
+	var groups []string
+	for g := range current {
+		groups = append(groups, g)
+	}
+	for g := range a.Targets {
+		if _, ok := current[g]; !ok {
+			groups = append(groups, g)
+		}
+	}
+	sort.Strings(groups)
+	for _, g := range groups {
+		weight := 100 * current[g] / total
+		fmt.Fprintf(w, "%s %.1f%%, %s %.1f%%, %s %+.1f\n", g, weight, conf.tr("target"), a.Targets[g],
+			conf.tr("drift"), weight-a.Targets[g])
+		// a group with nothing held is bought as its first symbol, priced at
+		// its last recorded price in the base currency
+		if current[g] > 0 {
+			continue
+		}
+		s := a.members(g)[0]
+		if history, err := store.load(s); err == nil && len(history) > 0 {
+			prices[s] = history[len(history)-1].Price.InexactFloat64()
+		} else {
+			fmt.Fprintf(w, "%s %s: %s\n", s, conf.tr("unavailable"), conf.tr("no recorded price"))
+		}
+	}
+	for _, t := range a.rebalance(values, prices, total) {
+		action := conf.tr("buy")
+		if t.units.IsNegative() {
+			action = conf.tr("sell")
+		}
+		fmt.Fprintf(w, "%s %s %s (%.2f)\n", action, t.units.Abs(), t.symbol, math.Abs(t.amount))
+	}
+	fmt.Fprintf(w, "\n")
+}
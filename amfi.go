@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// amfiNAVURL is AMFI's daily file of the NAV of every Indian mutual fund
+// scheme.
+const amfiNAVURL = "https://www.amfiindia.com/spages/NAVAll.txt"
+
+// amfiRefresh is how long a downloaded NAV file is used before it is
+// fetched again; NAVs change once a day.
+const amfiRefresh = time.Hour
+
+// amfiProvider prices Indian mutual funds at their latest NAV. Symbols are
+// AMFI scheme codes, e.g. "119551", and prices are in INR.
+type amfiProvider struct{}
+
+// amfiNAVs holds the last NAV file downloaded, which is shared by every
+// scheme priced in a run.
+var amfiNAVs struct {
+	sync.Mutex
+	fetched time.Time
+	navs    map[string]quote
+}
+
+func (amfiProvider) price(ctx context.Context, code string) (quote, error) {
+	amfiNAVs.Lock()
+	defer amfiNAVs.Unlock()
+	if amfiNAVs.navs == nil || clock().Sub(amfiNAVs.fetched) > amfiRefresh {
+		navs, err := fetchAMFI(ctx)
+		if err != nil {
+			return quote{}, err
+		}
+		amfiNAVs.navs, amfiNAVs.fetched = navs, clock()
+	}
+	q, ok := amfiNAVs.navs[code]
+	if !ok {
+		return quote{}, permanentError{fmt.Errorf("no scheme with code %s", code)}
+	}
+	return q, nil
+}
+
+func fetchAMFI(ctx context.Context) (map[string]quote, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", amfiNAVURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := quoteClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s", resp.Status)
+	}
+	return parseAMFI(resp.Body)
+}
+
+// parseAMFI reads the NAV file: headings and blank lines between lines of
+// "Scheme Code;ISIN Div Payout/ISIN Growth;ISIN Div Reinvestment;Scheme
+// Name;Net Asset Value;Date", the date as 02-Jan-2006. Schemes without a
+// NAV, given as "N.A.", are left out.
+func parseAMFI(r io.Reader) (map[string]quote, error) {
+	navs := make(map[string]quote)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		fields := strings.Split(sc.Text(), ";")
+		if len(fields) < 6 {
+			continue
+		}
+		nav, err := decimal.NewFromString(strings.TrimSpace(fields[4]))
+		if err != nil || !nav.IsPositive() {
+			continue // the header line, or no NAV
+		}
+		day, err := time.Parse("02-Jan-2006", strings.TrimSpace(fields[5]))
+		if err != nil {
+			continue
+		}
+		navs[strings.TrimSpace(fields[0])] = quote{Price: nav, Time: day}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if len(navs) == 0 {
+		return nil, fmt.Errorf("no NAVs in %s", amfiNAVURL)
+	}
+	return navs, nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// anonymize returns a copy of conf with every amount held scaled by the
+// same random factor, between a tenth and ten times, so that a report can
+// be shared without revealing what the portfolio is worth. Prices, and so
+// every percentage, are left alone.
+func anonymize(conf config) config {
+	rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+	factor := decimal.NewFromFloat(math.Pow(10, 2*rnd.Float64()-1))
+	investments := make([]investment, len(conf.Investments))
+	for k, i := range conf.Investments {
+		i.Total = i.Total.Mul(factor)
+		i.Units = i.Units.Mul(factor)
+		i.Fees, i.TaxesPaid = scaleCost(i.Fees, factor), scaleCost(i.TaxesPaid, factor)
+		investments[k] = i
+	}
+	assets := make([]asset, len(conf.Assets))
+	for k, a := range conf.Assets {
+		a.Value = a.Value.Mul(factor)
+		assets[k] = a
+	}
+	conf.Investments, conf.Assets, conf.scale = investments, assets, factor
+	return conf
+}
+
+// scaled applies the anonymizing factor, if any, to an amount recorded
+// before it was chosen.
+func (c config) scaled(d decimal.Decimal) decimal.Decimal {
+	if c.scale.IsZero() {
+		return d
+	}
+	return d.Mul(c.scale)
+}
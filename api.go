@@ -0,0 +1,199 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// apiConfig guards the REST API served alongside the dashboard. The key
+// resolves like the other secrets: from the file, the value with ${ENV}
+// references expanded, or the keyring entry "api". Without a key the API
+// refuses every request.
+type apiConfig struct {
+	Key     string `json:"key,omitempty"`
+	KeyFile string `json:"key_file,omitempty"`
+}
+
+// The REST API, all JSON:
+//
+//	GET  /investments       the investments, in the order list numbers them
+//	POST /investments       add an investment, given as in investmentInput
+//	GET  /report            the report as -output json prints it, priced at
+//	                        the last recorded prices
+//	GET  /history/{symbol}  the recorded history of a symbol, oldest first
+//
+// Requests carry the key as "Authorization: Bearer <key>". Errors come back
+// as {"error": "..."}.
+func (d *dashboard) registerAPI(mux *http.ServeMux) {
+	mux.HandleFunc("/investments", d.authorized(d.investments))
+	mux.HandleFunc("/report", d.authorized(d.report))
+	mux.HandleFunc("/history/", d.authorized(d.history))
+}
+
+// investmentInput is the body of POST /investments.
+type investmentInput struct {
+	Symbol   string          `json:"symbol"`
+	Date     string          `json:"date"` // 2006-01-02
+	Total    decimal.Decimal `json:"total"`
+	Units    decimal.Decimal `json:"units"`
+	Account  string          `json:"account,omitempty"`
+	Currency string          `json:"currency,omitempty"`
+	// Fees and TaxesPaid are paid on top of Total, see investment.
+	Fees      *decimal.Decimal `json:"fees,omitempty"`
+	TaxesPaid *decimal.Decimal `json:"taxes_paid,omitempty"`
+}
+
+func (in investmentInput) investment() (investment, error) {
+	i := investment{Symbol: strings.ToUpper(strings.TrimSpace(in.Symbol)), Total: in.Total, Units: in.Units,
+		Account: in.Account, Currency: strings.ToUpper(in.Currency), Fees: in.Fees, TaxesPaid: in.TaxesPaid}
+	if i.Symbol == "" {
+		return i, errors.New("no symbol")
+	}
+	var err error
+	if i.Date, err = time.Parse(isoDate, in.Date); err != nil {
+		return i, fmt.Errorf("bad date %q, want 2006-01-02", in.Date)
+	}
+	return i, i.checkAmounts()
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(v)
+}
+
+func writeAPIError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, apiError{err.Error()})
+}
+
+// authorized lets a request through to h only with the configured key.
+func (d *dashboard) authorized(h func(http.ResponseWriter, *http.Request, config)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conf, err := loadConfig(d.confFile)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		key, err := secret("api", conf.API.Key, conf.API.KeyFile)
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		if key == "" {
+			writeAPIError(w, http.StatusServiceUnavailable, errors.New("no api key configured"))
+			return
+		}
+		got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(got), []byte(key)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeAPIError(w, http.StatusUnauthorized, errors.New("missing or wrong api key"))
+			return
+		}
+		h(w, r, conf)
+	}
+}
+
+func (d *dashboard) investments(w http.ResponseWriter, r *http.Request, conf config) {
+	switch r.Method {
+	case http.MethodGet:
+		sortConfig(conf)
+		investments := conf.Investments
+		if investments == nil {
+			investments = []investment{}
+		}
+		writeJSON(w, http.StatusOK, investments)
+	case http.MethodPost:
+		if readOnly || conf.ReadOnly {
+			writeAPIError(w, http.StatusForbidden, errReadOnly)
+			return
+		}
+		var in investmentInput
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&in); err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		i, err := in.investment()
+		if err != nil {
+			writeAPIError(w, http.StatusBadRequest, err)
+			return
+		}
+		if err := d.addLot(i); err == errReadOnly {
+			writeAPIError(w, http.StatusForbidden, err)
+			return
+		} else if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, i)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeAPIError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+func (d *dashboard) report(w http.ResponseWriter, r *http.Request, conf config) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeAPIError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	store := newHistoryStore(d.confFile, conf)
+	now := clock()
+	latest := make(map[string]performance)
+	for _, s := range heldSymbols(conf) {
+		err := store.each(s, func(p performance) error {
+			if !p.Date.After(now) {
+				latest[s] = p
+			}
+			return nil
+		})
+		if err != nil {
+			writeAPIError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+	lots, err := reportLots(conf, store, latest, now)
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, reportOutput{Version: outputVersion, Date: now.Format(isoDate), BaseCurrency: conf.baseCurrency(), Lots: lots})
+}
+
+func (d *dashboard) history(w http.ResponseWriter, r *http.Request, conf config) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		writeAPIError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	symbol := strings.ToUpper(strings.TrimPrefix(r.URL.Path, "/history/"))
+	points := []pointOutput{}
+	err := newHistoryStore(d.confFile, conf).each(symbol, func(p performance) error {
+		points = append(points, pointOutput{p.Date.Format(isoDate), p.Price, p.CompoundInterest})
+		return nil
+	})
+	if err != nil {
+		writeAPIError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if len(points) == 0 {
+		writeAPIError(w, http.StatusNotFound, fmt.Errorf("no history for %s", symbol))
+		return
+	}
+	writeJSON(w, http.StatusOK, points)
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+	"time"
+)
+
+// auditEntry records one change made to the portfolio through stockstalk.
+// Old is unset for additions and New for removals.
+type auditEntry struct {
+	Time   time.Time   `json:"time"`
+	User   string      `json:"user"`
+	Action string      `json:"action"` // add, edit, remove, import, restore, recurring or inactive
+	Old    *investment `json:"old,omitempty"`
+	New    *investment `json:"new,omitempty"`
+	Detail string      `json:"detail,omitempty"`
+}
+
+// auditPath is the append-only audit log kept next to confFile.
+func auditPath(confFile string) string {
+	return confFile + ".audit"
+}
+
+// appendAudit stamps e with the time and the current user@host and appends
+// it to the audit log of confFile.
+func appendAudit(confFile string, e auditEntry) error {
+	if readOnly {
+		return errReadOnly
+	}
+	e.Time = clock()
+	e.User = "unknown"
+	if u, err := user.Current(); err == nil {
+		e.User = u.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		e.User += "@" + host
+	}
+	f, err := os.OpenFile(auditPath(confFile), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return json.NewEncoder(f).Encode(e)
+}
+
+// printAudit writes the audit log of confFile, oldest first.
+func printAudit(w io.Writer, confFile string) error {
+	f, err := os.Open(auditPath(confFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	for {
+		var e auditEntry
+		err := dec.Decode(&e)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", f.Name(), err)
+		}
+		var change []string
+		if e.Old != nil {
+			change = append(change, describeInvestment(*e.Old))
+		}
+		if e.New != nil {
+			change = append(change, describeInvestment(*e.New))
+		}
+		if e.Detail != "" {
+			change = append(change, e.Detail)
+		}
+		fmt.Fprintf(w, "%s %s %s %s\n", e.Time.Format(time.RFC3339), e.User, e.Action, strings.Join(change, " -> "))
+	}
+}
+
+func describeInvestment(i investment) string {
+	s := fmt.Sprintf("%s,%s,%s,%s", i.Symbol, i.Date.Format(mmddyy), i.Total, i.Units)
+	if i.Account != "" || i.Currency != "" {
+		s += "," + i.Account
+	}
+	if i.Currency != "" {
+		s += "," + i.Currency
+	}
+	return s
+}
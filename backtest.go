@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// transaction is a hypothetical purchase of amount worth of symbol.
+type transaction struct {
+	Symbol string
+	Date   time.Time
+	Amount decimal.Decimal
+}
+
+// parseTransaction parses "symbol,date(mm/dd/yy),amount".
+func parseTransaction(s string) (transaction, error) {
+	arr := strings.Split(s, ",")
+	if len(arr) != 3 {
+		return transaction{}, fmt.Errorf("transaction %q format incorrect, want symbol,date,amount", s)
+	}
+	t, err := time.Parse(mmddyy, arr[1])
+	if err != nil {
+		return transaction{}, err
+	}
+	amount, err := decimal.NewFromString(arr[2])
+	if err != nil {
+		return transaction{}, err
+	}
+	return transaction{Symbol: arr[0], Date: t, Amount: amount}, nil
+}
+
+// parseShift parses a signed offset such as "-1y", "6m" or "-90d".
+func parseShift(s string) (years, months, days int, err error) {
+	if len(s) < 2 {
+		return 0, 0, 0, fmt.Errorf("bad shift %q, want e.g. -1y, 6m or -90d", s)
+	}
+	n, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil {
+		return 0, 0, 0, fmt.Errorf("bad shift %q, want e.g. -1y, 6m or -90d", s)
+	}
+	switch s[len(s)-1] {
+	case 'y':
+		return n, 0, 0, nil
+	case 'm':
+		return 0, n, 0, nil
+	case 'd':
+		return 0, 0, n, nil
+	}
+	return 0, 0, 0, fmt.Errorf("bad shift %q, want e.g. -1y, 6m or -90d", s)
+}
+
+// backtest replays the transactions given as arguments, or the config's
+// investments moved by shift when there are none, against Yahoo's daily
+// closes and prints what they would have returned. Nothing is saved, not
+// even the closes to the quote cache.
+func backtest(ctx context.Context, w io.Writer, confFile string, args []string, shift string) error {
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	txs, err := loadTransactions(conf, args, shift)
+	if err != nil {
+		return err
+	}
+	store := newHistoryStore(confFile, conf)
+	store.frozen = true
+	res, err := simulate(ctx, store, txs, clock(), buyAndHold{})
+	if err != nil {
+		return err
+	}
+	res.print(w, conf)
+	return nil
+}
+
+// loadTransactions parses args as transactions, falling back to the
+// configured investments moved by shift.
+func loadTransactions(conf config, args []string, shift string) ([]transaction, error) {
+	var txs []transaction
+	for _, a := range args {
+		tx, err := parseTransaction(a)
+		if err != nil {
+			return nil, err
+		}
+		txs = append(txs, tx)
+	}
+	if len(txs) == 0 {
+		var y, m, d int
+		if shift != "" {
+			var err error
+			if y, m, d, err = parseShift(shift); err != nil {
+				return nil, err
+			}
+		}
+		for _, i := range conf.Investments {
+			txs = append(txs, transaction{Symbol: i.Symbol, Date: i.Date.AddDate(y, m, d), Amount: i.Total})
+		}
+	}
+	if len(txs) == 0 {
+		return nil, errors.New("nothing to backtest")
+	}
+	return txs, nil
+}
+
+type pricePoint struct {
+	date  time.Time
+	close float64
+}
+
+// dailyCloses returns the daily closes of symbol between from and to,
+// oldest first.
+func dailyCloses(ctx context.Context, store historyStore, symbol string, from, to time.Time) ([]pricePoint, error) {
+	prices, err := dailyHistory(ctx, store, symbol, from, to)
+	if err != nil {
+		return nil, err
+	}
+	series := make([]pricePoint, 0, len(prices))
+	for _, p := range prices {
+		series = append(series, pricePoint{date: p.Date, close: p.Close})
+	}
+	sort.Slice(series, func(i, j int) bool {
+		return series[i].date.Before(series[j].date)
+	})
+	if len(series) == 0 {
+		return nil, fmt.Errorf("no prices for %s", symbol)
+	}
+	return series, nil
+}
+
+type lotResult struct {
+	tx           transaction
+	units, value float64
+}
+
+type backtestResult struct {
+	lots            []lotResult
+	invested, value float64
+	// cash is money a strategy was still holding back at the end.
+	cash       float64
+	start, end time.Time
+	// nav is the value of one unit of the portfolio, which new money buys
+	// into at the going rate, so returns and drawdowns are independent of
+	// when money went in.
+	nav                      float64
+	maxDrawdown              float64
+	drawdownFrom, drawdownTo time.Time
+}
+
+// holdings is the simulated portfolio a strategy trades.
+type holdings struct {
+	units map[string]float64
+	price map[string]float64 // latest close
+	cash  float64
+}
+
+func (h *holdings) value() float64 {
+	v := h.cash
+	for s, u := range h.units {
+		v += u * h.price[s]
+	}
+	return v
+}
+
+// buy spends amount of cash on symbol at its latest close.
+func (h *holdings) buy(symbol string, amount float64) {
+	h.units[symbol] += amount / h.price[symbol]
+	h.cash -= amount
+}
+
+// simulate puts each transaction's money in at the first close on or
+// after its date, lets strat decide what to do with it, and values the
+// portfolio at every close up to end.
+func simulate(ctx context.Context, store historyStore, txs []transaction, end time.Time, strat strategy) (backtestResult, error) {
+	sort.SliceStable(txs, func(i, j int) bool { return txs[i].Date.Before(txs[j].Date) })
+	start := txs[0].Date
+	closes := make(map[string][]pricePoint)
+	days := make(map[time.Time]bool)
+	for _, tx := range txs {
+		if _, ok := closes[tx.Symbol]; ok {
+			continue
+		}
+		series, err := dailyCloses(ctx, store, tx.Symbol, start, end)
+		if err != nil {
+			return backtestResult{}, err
+		}
+		closes[tx.Symbol] = series
+		for _, p := range series {
+			days[p.date] = true
+		}
+	}
+	var dates []time.Time
+	for d := range days {
+		dates = append(dates, d)
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+
+	res := backtestResult{start: start, nav: 1}
+	h := &holdings{units: make(map[string]float64), price: make(map[string]float64)}
+	units := make([]float64, len(txs))
+	idx := make(map[string]int)
+	var shares, peak float64
+	var peakDate time.Time
+	next := 0
+	for _, d := range dates {
+		for s, series := range closes {
+			for idx[s] < len(series) && !series[idx[s]].date.After(d) {
+				h.price[s] = series[idx[s]].close
+				idx[s]++
+			}
+		}
+		if shares > 0 {
+			res.nav = h.value() / shares
+		}
+		for next < len(txs) && !txs[next].Date.After(d) {
+			tx := txs[next]
+			price := h.price[tx.Symbol]
+			if price == 0 {
+				break // no close for this symbol yet
+			}
+			amount := tx.Amount.InexactFloat64()
+			units[next] = amount / price
+			shares += amount / res.nav
+			res.invested += amount
+			h.cash += amount
+			strat.contribute(h, tx)
+			next++
+		}
+		strat.trade(h, d)
+		if res.nav > peak {
+			peak, peakDate = res.nav, d
+		}
+		if dd := res.nav/peak - 1; dd < res.maxDrawdown {
+			res.maxDrawdown, res.drawdownFrom, res.drawdownTo = dd, peakDate, d
+		}
+		res.value, res.cash, res.end = h.value(), h.cash, d
+	}
+	if next < len(txs) {
+		return backtestResult{}, fmt.Errorf("no price for %s on or after %s", txs[next].Symbol, txs[next].Date.Format(humanDate))
+	}
+	for k, tx := range txs {
+		res.lots = append(res.lots, lotResult{tx: tx, units: units[k], value: units[k] * h.price[tx.Symbol]})
+	}
+	return res, nil
+}
+
+// annualized converts growth (1.1 for +10%) over the span between from and
+// to into a yearly percentage.
+func annualized(growth float64, from, to time.Time) float64 {
+	years := to.Sub(from).Seconds() / secondsPerYear
+	if years <= 0 {
+		return 0
+	}
+	return 100 * (math.Pow(growth, 1/years) - 1)
+}
+
+func (r backtestResult) print(w io.Writer, conf config) {
+	fmt.Fprintf(w, "=== %s %s - %s ===\n", conf.tr("Backtest"), r.start.Format(humanDate), r.end.Format(humanDate))
+	for _, l := range r.lots {
+		amount := l.tx.Amount.InexactFloat64()
+		fmt.Fprintf(w, "%s %s %.2f -> %.2f (%+.1f%%, %.2f %% %s)\n", l.tx.Symbol, l.tx.Date.Format(humanDate),
+			amount, l.value, 100*(l.value/amount-1), annualized(l.value/amount, l.tx.Date, r.end), conf.tr("a year"))
+	}
+	fmt.Fprintf(w, "%s %.2f, %s %.2f, %s %.2f\n", conf.tr("invested"), r.invested, conf.tr("value"), r.value, conf.tr("gain"), r.value-r.invested)
+	fmt.Fprintf(w, "%s %.2f %% %s, %s %.1f%%", conf.tr("time-weighted"), annualized(r.nav, r.start, r.end), conf.tr("a year"),
+		conf.tr("max drawdown"), 100*r.maxDrawdown)
+	if r.maxDrawdown < 0 {
+		fmt.Fprintf(w, " (%s to %s)", r.drawdownFrom.Format(humanDate), r.drawdownTo.Format(humanDate))
+	}
+	fmt.Fprintf(w, "\n")
+}
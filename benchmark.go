@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// printBenchmark compares each lot, and the portfolio, with having bought
+// the benchmark instead with the same money on the same days. Returns are
+// price-only on both sides.
+func printBenchmark(ctx context.Context, w io.Writer, conf config, store historyStore, latest map[string]performance, now time.Time) {
+	bench := conf.Report.Benchmark
+	fmt.Fprintf(w, "=== %s %s ===\n", conf.tr("Compared with"), bench)
+	price, err := getPrice(ctx, conf, investment{Symbol: bench})
+	if err != nil {
+		fmt.Fprintf(w, "%s %s: %v\n\n", bench, conf.tr("unavailable"), err)
+		return
+	}
+	benchNow := price.InexactFloat64()
+	var invested, value, benchValue float64
+	var flows []cashFlow
+	for _, i := range conf.Investments {
+		p, ok := latest[i.Symbol]
+		if !ok || i.Date.After(now) {
+			continue
+		}
+		then, err := historicalPrice(ctx, store, bench, i.Date)
+		if err != nil || !then.IsPositive() {
+			fmt.Fprintf(w, "%s %s %s: %v\n", i.Symbol, i.Date.Format(humanDate), conf.tr("unavailable"), err)
+			continue
+		}
+		cost, err := lotCost(ctx, conf, store, i)
+		if err != nil {
+			fmt.Fprintf(w, "%s %s %s: %v\n", i.Symbol, i.Date.Format(humanDate), conf.tr("unavailable"), err)
+			continue
+		}
+		growth := benchNow / then.InexactFloat64()
+		invested += cost
+		value += conf.toBase(i.Currency, i.Units.Mul(p.Price)).InexactFloat64()
+		benchValue += cost * growth
+		flows = append(flows, cashFlow{i.Date, -cost})
+
+		years := now.Sub(i.Date).Seconds() / secondsPerYear
+		r := currentRate(i, p.Price)
+		br := 100 * (math.Pow(growth, 1/years) - 1)
+		fmt.Fprintf(w, "%s %s %.2f %% %s %s %.2f %% (%+.2f)\n", i.Symbol, i.Date.Format(humanDate), r,
+			conf.tr("vs"), bench, br, r-br)
+	}
+	if invested == 0 {
+		fmt.Fprintf(w, "\n")
+		return
+	}
+	fmt.Fprintf(w, conf.tr("portfolio %.2f, in %s %.2f (%+.2f)")+"\n", value, bench, benchValue, value-benchValue)
+	fmt.Fprintf(w, conf.tr("money-weighted return %s, in %s %s")+"\n", xirrString(conf, flows, now, value),
+		bench, xirrString(conf, flows, now, benchValue))
+	fmt.Fprintf(w, "\n")
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// chartPoint is one value of a charted series.
+type chartPoint struct {
+	date  time.Time
+	value float64
+}
+
+// chartOptions are the flags of the chart command.
+type chartOptions struct {
+	portfolio     bool
+	out           string
+	width, height int
+}
+
+// chart draws the recorded price of symbol, or with opts.portfolio the
+// recorded value of the whole portfolio in the base currency, as a line
+// chart in opts.out. The format follows the extension of the file: .png or
+// .svg.
+func chart(ctx context.Context, w io.Writer, confFile, symbol string, opts chartOptions) error {
+	if opts.out == "" || (symbol == "") == !opts.portfolio || opts.width < 100 || opts.height < 100 {
+		return errors.New("usage: chart SYMBOL -out FILE, or chart -portfolio -out FILE")
+	}
+	ext := strings.ToLower(filepath.Ext(opts.out))
+	if ext != ".png" && ext != ".svg" {
+		return fmt.Errorf("%s: want a .png or .svg file", opts.out)
+	}
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	store := newHistoryStore(confFile, conf)
+	var series []chartPoint
+	title := symbol
+	if opts.portfolio {
+		title = conf.tr("Portfolio")
+		if conf.fx, err = fxRates(ctx, conf, store, clock(), false); err != nil {
+			return err
+		}
+		series, err = portfolioSeries(conf, store)
+	} else {
+		err = store.each(symbol, func(p performance) error {
+			series = append(series, chartPoint{date: p.Date, value: p.Price.InexactFloat64()})
+			return nil
+		})
+	}
+	if err != nil {
+		return err
+	}
+	if len(series) < 2 {
+		return fmt.Errorf("not enough recorded history to chart %s", title)
+	}
+
+	var b bytes.Buffer
+	if ext == ".png" {
+		err = png.Encode(&b, drawPNG(series, opts.width, opts.height))
+	} else {
+		err = writeSVG(&b, title, series, opts.width, opts.height)
+	}
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(opts.out, b.Bytes(), 0644); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, conf.tr("wrote %s")+"\n", opts.out)
+	return nil
+}
+
+// portfolioSeries values the portfolio, in the base currency at today's
+// rates, on every day a price was recorded, carrying each symbol's last
+// recorded price forward.
+func portfolioSeries(conf config, store historyStore) ([]chartPoint, error) {
+	prices := make(map[string][]performance)
+	days := make(map[string]time.Time)
+	for _, s := range heldSymbols(conf) {
+		h, err := store.load(s)
+		if err != nil {
+			return nil, err
+		}
+		prices[s] = h
+		for _, p := range h {
+			days[p.Date.Format(isoDate)] = p.Date
+		}
+	}
+	var dates []time.Time
+	for _, d := range days {
+		dates = append(dates, d)
+	}
+	sort.Slice(dates, func(i, j int) bool { return dates[i].Before(dates[j]) })
+	var series []chartPoint
+	for _, d := range dates {
+		var value decimal.Decimal
+		for _, i := range conf.Investments {
+			if i.Date.After(d) {
+				continue
+			}
+			var last *performance
+			for k := range prices[i.Symbol] {
+				if !prices[i.Symbol][k].Date.After(d) {
+					last = &prices[i.Symbol][k]
+				}
+			}
+			if last != nil {
+				value = value.Add(conf.toBase(i.Currency, i.Units.Mul(last.Price)))
+			}
+		}
+		series = append(series, chartPoint{date: d, value: value.InexactFloat64()})
+	}
+	return series, nil
+}
+
+// chartScale maps a series onto a width by height canvas with a margin
+// left for labels.
+type chartScale struct {
+	from, to    time.Time
+	min, max    float64
+	left, right int
+	top, bottom int
+}
+
+func newChartScale(series []chartPoint, width, height, margin int) chartScale {
+	s := chartScale{from: series[0].date, to: series[len(series)-1].date, min: series[0].value, max: series[0].value}
+	for _, p := range series {
+		if p.value < s.min {
+			s.min = p.value
+		}
+		if p.value > s.max {
+			s.max = p.value
+		}
+	}
+	if s.max == s.min {
+		s.max, s.min = s.max+1, s.min-1
+	}
+	s.left, s.right, s.top, s.bottom = margin, width-margin/2, margin/2, height-margin
+	return s
+}
+
+func (s chartScale) point(p chartPoint) (x, y int) {
+	span := s.to.Sub(s.from).Seconds()
+	x = s.left + int(float64(s.right-s.left)*p.date.Sub(s.from).Seconds()/span)
+	y = s.bottom - int(float64(s.bottom-s.top)*(p.value-s.min)/(s.max-s.min))
+	return x, y
+}
+
+// drawPNG draws the series as a line over a light frame. PNGs carry no
+// labels; use SVG for those.
+func drawPNG(series []chartPoint, width, height int) image.Image {
+	s := newChartScale(series, width, height, 20)
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	frame := color.RGBA{0xcc, 0xcc, 0xcc, 0xff}
+	line := color.RGBA{0x1f, 0x77, 0xb4, 0xff}
+	drawLine(img, s.left, s.bottom, s.right, s.bottom, frame)
+	drawLine(img, s.left, s.top, s.left, s.bottom, frame)
+	x0, y0 := s.point(series[0])
+	for _, p := range series[1:] {
+		x1, y1 := s.point(p)
+		drawLine(img, x0, y0, x1, y1, line)
+		drawLine(img, x0, y0+1, x1, y1+1, line)
+		x0, y0 = x1, y1
+	}
+	return img
+}
+
+// drawLine draws from (x0, y0) to (x1, y1) with Bresenham's algorithm.
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	abs := func(n int) int {
+		if n < 0 {
+			return -n
+		}
+		return n
+	}
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		img.Set(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func writeSVG(w io.Writer, title string, series []chartPoint, width, height int) error {
+	s := newChartScale(series, width, height, 60)
+	var points []string
+	for _, p := range series {
+		x, y := s.point(p)
+		points = append(points, fmt.Sprintf("%d,%d", x, y))
+	}
+	_, err := fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="%[2]d" viewBox="0 0 %[1]d %[2]d" font-family="sans-serif" font-size="12">
+<rect width="100%%" height="100%%" fill="white"/>
+<text x="%[3]d" y="%[4]d" font-size="14">%[5]s</text>
+<path d="M%[3]d %[4]d V%[6]d H%[7]d" fill="none" stroke="#ccc"/>
+<text x="%[8]d" y="%[4]d" text-anchor="end">%.2[9]f</text>
+<text x="%[8]d" y="%[6]d" text-anchor="end">%.2[10]f</text>
+<text x="%[3]d" y="%[11]d">%[12]s</text>
+<text x="%[7]d" y="%[11]d" text-anchor="end">%[13]s</text>
+<polyline points="%[14]s" fill="none" stroke="#1f77b4" stroke-width="2"/>
+</svg>
+`, width, height, s.left, s.top, svgEscape(title), s.bottom, s.right, s.left-5, s.max, s.min, s.bottom+20,
+		s.from.Format(humanDate), s.to.Format(humanDate), strings.Join(points, " "))
+	return err
+}
+
+var svgEscape = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace
@@ -0,0 +1,13 @@
+package main
+
+import "testing"
+
+func BenchmarkPortfolioSeries(b *testing.B) {
+	conf, store, _ := syntheticPortfolio(b, 20, 5, 2*365)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := portfolioSeries(conf, store); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+package main
+
+import "time"
+
+// clock is the source of the current time for stamping history, return
+// calculations and report dates. It is replaced to pin runs to a fixed
+// time, as -as-of does.
+var clock = time.Now
@@ -0,0 +1,469 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// command is a stockstalk subcommand. setup defines the command's flags on
+// fs and returns the function that runs it once they are parsed, with the
+// remaining arguments.
+type command struct {
+	name    string
+	args    string // synopsis of the arguments, for help
+	summary string
+	setup   func(fs *flag.FlagSet) func(ctx context.Context, confFile string, args []string) error
+}
+
+// errUsage is returned by a command given the wrong arguments; the caller
+// replaces it with the command's usage line.
+var errUsage = errors.New("usage")
+
+// commands is filled in by init since help refers back to it.
+var commands []command
+
+func init() {
+	commands = []command{
+		{"report", "", "fetch prices, record them and send the report; the default command", reportCommand},
+		{"add", "SYMBOL,DATE(mm/dd/yy),TOTAL,UNITS[,ACCOUNT[,CURRENCY]]", "add an investment", func(fs *flag.FlagSet) func(context.Context, string, []string) error {
+			provider := fs.String("provider", "", "price it with this quote plugin, amfi for an Indian mutual fund by scheme code or crypto for a coin such as BTC-USD")
+			tags := fs.String("tags", "", "comma-separated tags, e.g. tech,dividend")
+			note := fs.String("note", "", "free text to keep with it")
+			fees := fs.String("fees", "", "commission and other fees paid on top of TOTAL, part of the cost basis")
+			taxes := fs.String("taxes-paid", "", "taxes paid on top of TOTAL, such as stamp duty, part of the cost basis")
+			return func(ctx context.Context, confFile string, args []string) error {
+				if len(args) != 1 {
+					return errUsage
+				}
+				extra := investment{Tags: parseTags(*tags), Note: *note}
+				var err error
+				if extra.Fees, err = optionalCost(*fees); err != nil {
+					return err
+				}
+				if extra.TaxesPaid, err = optionalCost(*taxes); err != nil {
+					return err
+				}
+				return addInvestment(args[0], confFile, *provider, extra)
+			}
+		}},
+		{"remove", "INDEX|SYMBOL DATE(mm/dd/yy)", "remove an investment, by its index in list or its symbol and date", noFlags(func(ctx context.Context, confFile string, args []string) error {
+			return removeInvestment(confFile, args)
+		})},
+		{"edit", "INDEX|SYMBOL DATE(mm/dd/yy)", "correct an investment, by its index in list or its symbol and date", func(fs *flag.FlagSet) func(context.Context, string, []string) error {
+			var e investmentEdit
+			fs.StringVar(&e.symbol, "symbol", "", "new symbol")
+			fs.StringVar(&e.date, "date", "", "new purchase date (mm/dd/yy)")
+			fs.StringVar(&e.total, "total", "", "new total paid")
+			fs.StringVar(&e.units, "units", "", "new number of units")
+			account := fs.String("account", "", "new account; empty to clear it")
+			currency := fs.String("currency", "", "new currency; empty for the base currency")
+			tags := fs.String("tags", "", "new comma-separated tags, e.g. tech,dividend; empty to clear them")
+			note := fs.String("note", "", "new note; empty to clear it")
+			fees := fs.String("fees", "", "new fees; empty to clear them")
+			taxes := fs.String("taxes-paid", "", "new taxes paid; empty to clear them")
+			return func(ctx context.Context, confFile string, args []string) error {
+				fs.Visit(func(f *flag.Flag) {
+					switch f.Name {
+					case "account":
+						e.account = account
+					case "currency":
+						e.currency = currency
+					case "tags":
+						e.tags = tags
+					case "note":
+						e.note = note
+					case "fees":
+						e.fees = fees
+					case "taxes-paid":
+						e.taxesPaid = taxes
+					}
+				})
+				return editInvestment(confFile, args, e)
+			}
+		}},
+		{"import", "FILE", "add the purchases in a broker's CSV export, - for stdin", func(fs *flag.FlagSet) func(context.Context, string, []string) error {
+			format := fs.String("format", "generic", "column mapping: generic, schwab, fidelity, vanguard or one from import_formats")
+			return func(ctx context.Context, confFile string, args []string) error {
+				if len(args) != 1 {
+					return errUsage
+				}
+				return importTransactions(os.Stdout, confFile, args[0], *format)
+			}
+		}},
+		{"sell", "SYMBOL UNITS PROCEEDS", "sell units, oldest lots first, recording the realized gain", func(fs *flag.FlagSet) func(context.Context, string, []string) error {
+			date := fs.String("date", "", "date of the sale (mm/dd/yy); today by default")
+			return func(ctx context.Context, confFile string, args []string) error {
+				return sell(os.Stdout, confFile, args, *date)
+			}
+		}},
+		{"tax", "", "classify unrealized gains as short- or long-term and estimate the tax on them", func(fs *flag.FlagSet) func(context.Context, string, []string) error {
+			soon := fs.Int("soon", 30, "mark lots turning long-term within this many days")
+			return func(ctx context.Context, confFile string, args []string) error {
+				if len(args) != 0 {
+					return errUsage
+				}
+				return taxReport(ctx, os.Stdout, confFile, *soon)
+			}
+		}},
+		{"action", "[split SYMBOL DATE(mm/dd/yy) RATIO|rename OLD NEW DATE(mm/dd/yy)|detect]", "record a split or ticker change, detect splits, or list them", noFlags(func(ctx context.Context, confFile string, args []string) error {
+			return corporateActions(ctx, os.Stdout, confFile, args)
+		})},
+		{"watch", "[add|remove SYMBOL]", "follow a symbol in the report without holding it, or list the watchlist", func(fs *flag.FlagSet) func(context.Context, string, []string) error {
+			provider := fs.String("provider", "", "price it with this quote plugin, amfi or crypto")
+			screen := fs.String("screen", "", "buying condition to check on every run, e.g. \"pe < 20 and price < ma50\"")
+			return func(ctx context.Context, confFile string, args []string) error {
+				return watchSymbols(os.Stdout, confFile, args, *provider, *screen)
+			}
+		}},
+		{"encrypt", "", "encrypt the config and its backups with AES-GCM, keyed by STOCKSTALK_PASSPHRASE, STOCKSTALK_KEY_FILE or the keyring entry config", noFlags(func(ctx context.Context, confFile string, args []string) error {
+			if len(args) != 0 {
+				return errUsage
+			}
+			return encryptFiles(os.Stdout, confFile, true)
+		})},
+		{"decrypt", "", "decrypt the config and its backups back to plain JSON", noFlags(func(ctx context.Context, confFile string, args []string) error {
+			if len(args) != 0 {
+				return errUsage
+			}
+			return encryptFiles(os.Stdout, confFile, false)
+		})},
+		{"tui", "", "browse the holdings in a live terminal table, with their history, and add or remove lots", func(fs *flag.FlagSet) func(context.Context, string, []string) error {
+			refresh := fs.Duration("refresh", time.Minute, "how often to price the holdings again")
+			return func(ctx context.Context, confFile string, args []string) error {
+				if len(args) != 0 {
+					return errUsage
+				}
+				return tui(ctx, confFile, *refresh)
+			}
+		}},
+		{"doctor", "", "check the config for mistakes and list every problem found", noFlags(func(ctx context.Context, confFile string, args []string) error {
+			if len(args) != 0 {
+				return errUsage
+			}
+			return doctor(os.Stdout, confFile)
+		})},
+		{"list", "", "list the investments", func(fs *flag.FlagSet) func(context.Context, string, []string) error {
+			tag := fs.String("tag", "", "list only the investments with this tag")
+			return func(ctx context.Context, confFile string, args []string) error {
+				if len(args) != 0 {
+					return errUsage
+				}
+				return listInvestments(os.Stdout, confFile, *tag)
+			}
+		}},
+		{"history", "[SYMBOL]", "print the recorded history of a symbol, optionally between two dates", func(fs *flag.FlagSet) func(context.Context, string, []string) error {
+			symbol := fs.String("symbol", "", "the symbol, instead of as an argument")
+			from := fs.String("from", "", "only entries on or after this date (2006-01-02)")
+			to := fs.String("to", "", "only entries on or before this date (2006-01-02)")
+			output := fs.String("output", "text", "what to print: text, or json or csv for other tools")
+			return func(ctx context.Context, confFile string, args []string) error {
+				if len(args) > 1 || (len(args) == 1) == (*symbol != "") {
+					return errUsage
+				}
+				if len(args) == 1 {
+					*symbol = args[0]
+				}
+				start, err := parseDay(*from)
+				if err != nil {
+					return err
+				}
+				end, err := parseDay(*to)
+				if err != nil {
+					return err
+				}
+				if !start.IsZero() && !end.IsZero() && end.Before(start) {
+					return errors.New("-to is before -from")
+				}
+				return printHistory(os.Stdout, confFile, *symbol, start, end, *output)
+			}
+		}},
+		{"compact", "", "thin out old history to the retention policy now", noFlags(func(ctx context.Context, confFile string, args []string) error {
+			if len(args) != 0 {
+				return errUsage
+			}
+			return compactHistory(os.Stdout, confFile)
+		})},
+		{"dividend", "SYMBOL DATE(mm/dd/yy) PER_UNIT", "record a cash dividend on the lots held before DATE", noFlags(func(ctx context.Context, confFile string, args []string) error {
+			return recordDividend(os.Stdout, confFile, args)
+		})},
+		{"daemon", "", "run the report on a schedule", func(fs *flag.FlagSet) func(context.Context, string, []string) error {
+			interval := fs.Duration("interval", 24*time.Hour, "time between runs")
+			return func(ctx context.Context, confFile string, args []string) error {
+				if len(args) != 0 {
+					return errUsage
+				}
+				return daemon(ctx, confFile, *interval)
+			}
+		}},
+		{"serve", "", "serve a dashboard of the portfolio to browsers and a REST API", func(fs *flag.FlagSet) func(context.Context, string, []string) error {
+			addr := fs.String("addr", "127.0.0.1:8080", "address to listen on; :8080 for every interface, which needs an api key")
+			return func(ctx context.Context, confFile string, args []string) error {
+				if len(args) != 0 {
+					return errUsage
+				}
+				return serve(ctx, confFile, *addr)
+			}
+		}},
+		{"auth", "set|delete NAME", "manage secrets in the OS keyring", noFlags(func(ctx context.Context, confFile string, args []string) error {
+			return auth(args)
+		})},
+		{"restore", "[N]", "roll the config back to its Nth most recent backup, 1 by default", func(fs *flag.FlagSet) func(context.Context, string, []string) error {
+			list := fs.Bool("list", false, "list the backups instead")
+			return func(ctx context.Context, confFile string, args []string) error {
+				if *list {
+					return listBackups(os.Stdout, confFile)
+				}
+				n := 1
+				switch len(args) {
+				case 0:
+				case 1:
+					var err error
+					if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+						return errUsage
+					}
+				default:
+					return errUsage
+				}
+				return restoreConfig(confFile, n)
+			}
+		}},
+		{"audit", "", "print the log of changes to the config", noFlags(func(ctx context.Context, confFile string, args []string) error {
+			if len(args) != 0 {
+				return errUsage
+			}
+			return printAudit(os.Stdout, confFile)
+		})},
+		{"backtest", "[SYMBOL,DATE,AMOUNT...]", "replay transactions, or the configured investments, against daily closes", func(fs *flag.FlagSet) func(context.Context, string, []string) error {
+			shift := fs.String("shift", "", "move the configured investments in time, e.g. -1y, 6m or -90d")
+			return func(ctx context.Context, confFile string, args []string) error {
+				return backtest(ctx, os.Stdout, confFile, args, *shift)
+			}
+		}},
+		{"strategies", "[SYMBOL,DATE,AMOUNT...]", "compare rule-based strategies with buy-and-hold", func(fs *flag.FlagSet) func(context.Context, string, []string) error {
+			shift := fs.String("shift", "", "move the configured investments in time, e.g. -1y, 6m or -90d")
+			dip := fs.Float64("dip", 10, "percentage drop the buy-the-dip strategy waits for")
+			return func(ctx context.Context, confFile string, args []string) error {
+				return compareStrategies(ctx, os.Stdout, confFile, args, *shift, *dip)
+			}
+		}},
+		{"optimize", "", "suggest efficient-frontier weights and the trades to get there", func(fs *flag.FlagSet) func(context.Context, string, []string) error {
+			risk := fs.Float64("risk", 15, "annual volatility in percent to aim for")
+			return func(ctx context.Context, confFile string, args []string) error {
+				if len(args) != 0 {
+					return errUsage
+				}
+				return optimize(ctx, os.Stdout, confFile, *risk)
+			}
+		}},
+		{"drawdown", "", "simulate yearly withdrawals from the portfolio", func(fs *flag.FlagSet) func(context.Context, string, []string) error {
+			withdraw := fs.String("withdraw", "4%", "yearly withdrawal: an amount or a percentage of today's value")
+			years := fs.Int("years", 30, "years the money has to last")
+			paths := fs.String("paths", "montecarlo", "return paths: historical or montecarlo")
+			return func(ctx context.Context, confFile string, args []string) error {
+				if len(args) != 0 {
+					return errUsage
+				}
+				return drawdownPlan(ctx, os.Stdout, confFile, *withdraw, *years, *paths)
+			}
+		}},
+		{"distributions", "[add LINE...|import FILE]", "record fund capital gains distributions, or list them per year", noFlags(func(ctx context.Context, confFile string, args []string) error {
+			return distributions(os.Stdout, confFile, args)
+		})},
+		{"asset", "NAME [VALUE]", "set or remove an asset held outside the brokerage", func(fs *flag.FlagSet) func(context.Context, string, []string) error {
+			remove := fs.Bool("remove", false, "remove the named asset")
+			return func(ctx context.Context, confFile string, args []string) error {
+				return setAsset(os.Stdout, confFile, args, *remove)
+			}
+		}},
+		{"goal", "[NAME AMOUNT DATE]", "set a goal such as 50L by 2030 for the selected portfolio, or a tag, and list the goals", func(fs *flag.FlagSet) func(context.Context, string, []string) error {
+			tag := fs.String("tag", "", "count only the investments with this tag")
+			remove := fs.Bool("remove", false, "remove the named goal")
+			return func(ctx context.Context, confFile string, args []string) error {
+				return setGoal(os.Stdout, confFile, args, *tag, *remove)
+			}
+		}},
+		{"balances", "import FILE|sync", "update bank balances from a CSV file or balances plugins", noFlags(func(ctx context.Context, confFile string, args []string) error {
+			return balances(ctx, os.Stdout, confFile, args)
+		})},
+		{"diff", "[OLD NEW]", "summarize what changed between two configs, or since a date", func(fs *flag.FlagSet) func(context.Context, string, []string) error {
+			since := fs.String("since", "", "compare against the portfolio at the end of this date (2006-01-02)")
+			return func(ctx context.Context, confFile string, args []string) error {
+				return diffConfigs(ctx, os.Stdout, confFile, *since, args)
+			}
+		}},
+		{"paper", "buy|sell SYMBOL AMOUNT|UNITS", "trade in the paper-trading portfolio", noFlags(func(ctx context.Context, confFile string, args []string) error {
+			return paperTrade(ctx, os.Stdout, confFile, args)
+		})},
+		{"alerts", "[list|ack ID|snooze ID DURATION]", "list, acknowledge or snooze alerts", noFlags(func(ctx context.Context, confFile string, args []string) error {
+			return alerts(os.Stdout, confFile, args)
+		})},
+		{"transfer", "SYMBOL UNITS FROM TO", "move units between accounts keeping dates and cost basis", noFlags(func(ctx context.Context, confFile string, args []string) error {
+			return transfer(os.Stdout, confFile, args)
+		})},
+		{"chart", "[SYMBOL]", "draw recorded history to a PNG or SVG file", func(fs *flag.FlagSet) func(context.Context, string, []string) error {
+			var opts chartOptions
+			fs.BoolVar(&opts.portfolio, "portfolio", false, "chart the value of the whole portfolio")
+			fs.StringVar(&opts.out, "out", "", "file to write, .png or .svg")
+			fs.IntVar(&opts.width, "width", 800, "width in pixels")
+			fs.IntVar(&opts.height, "height", 400, "height in pixels")
+			return func(ctx context.Context, confFile string, args []string) error {
+				if len(args) > 1 {
+					return errUsage
+				}
+				return chart(ctx, os.Stdout, confFile, strings.Join(args, ""), opts)
+			}
+		}},
+		{"help", "[COMMAND]", "show the commands, or the flags of one", noFlags(func(ctx context.Context, confFile string, args []string) error {
+			if len(args) == 0 {
+				flag.CommandLine.SetOutput(os.Stdout)
+				flag.Usage()
+				return nil
+			}
+			c, ok := findCommand(args[0])
+			if !ok {
+				return fmt.Errorf("unknown command %q", args[0])
+			}
+			fs := commandFlags(c)
+			fs.SetOutput(os.Stdout)
+			c.setup(fs)
+			fs.Usage()
+			return nil
+		})},
+	}
+}
+
+func reportCommand(fs *flag.FlagSet) func(context.Context, string, []string) error {
+	force := fs.Bool("force", false, "send the report even if one was already sent today")
+	asOf := fs.String("as-of", "", "print the report as of the end of this date (2006-01-02) using recorded prices; nothing is saved or sent")
+	anon := fs.Bool("anonymize", false, "print the report with all amounts scaled by a hidden random factor, keeping percentages; nothing is saved or sent")
+	base := fs.String("base-currency", "", "currency to total the report in, e.g. INR; overrides the config")
+	format := fs.String("format", "", "report email format, html or text; overrides the config")
+	benchmark := fs.String("benchmark", "", "symbol to compare the holdings with, e.g. SPY; overrides the config")
+	priceMode := fs.String("price-mode", "", "while the market is open record the last trade (last) or the previous close (close); overrides the config")
+	dedupe := fs.String("dedupe", "", "when a symbol is recorded again on the same day keep the first entry (keep-first), the last (keep-last) or both (keep-all); overrides the config")
+	dry := fs.Bool("dry-run", false, "fetch and analyze, but print what would be recorded and sent instead")
+	output := fs.String("output", "text", "what to print: text, or json or csv for other tools, or pdf to write to -o; the report sent is always text")
+	chart := fs.Bool("chart", isTerminal(os.Stdout), "print charts of each symbol's history; on by default in a terminal")
+	tag := fs.String("tag", "", "print the report of only the investments with this tag; nothing is sent")
+	out := fs.String("o", "", "file to write -output pdf to, e.g. report.pdf")
+	return func(ctx context.Context, confFile string, args []string) error {
+		if len(args) != 0 {
+			return errUsage
+		}
+		if err := validOutput(*output); err != nil {
+			return err
+		}
+		if (*output == "pdf") != (*out != "") {
+			return errors.New("-o FILE goes with -output pdf")
+		}
+		opts := runOptions{persist: true, force: *force}
+		if *asOf != "" {
+			t, err := time.ParseInLocation(isoDate, *asOf, time.Local)
+			if err != nil {
+				return err
+			}
+			t = t.AddDate(0, 0, 1).Add(-time.Second)
+			clock = func() time.Time { return t }
+			opts = runOptions{asOf: true}
+		}
+		if *anon {
+			opts.persist, opts.anonymize = false, true
+		}
+		if *tag != "" {
+			opts.persist, opts.tag = false, *tag
+		}
+		opts.baseCurrency, opts.format, opts.benchmark, opts.output = *base, *format, *benchmark, *output
+		opts.priceMode, opts.dedupe, opts.out, opts.chart = *priceMode, *dedupe, *out, *chart
+		dryRun = *dry
+		return analysis(ctx, confFile, opts)
+	}
+}
+
+// noFlags is the setup of a command that takes no flags.
+func noFlags(run func(ctx context.Context, confFile string, args []string) error) func(*flag.FlagSet) func(context.Context, string, []string) error {
+	return func(*flag.FlagSet) func(context.Context, string, []string) error { return run }
+}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+func commandFlags(c command) *flag.FlagSet {
+	fs := flag.NewFlagSet(c.name, flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: stockstalk [global flags] %s [flags] %s\n\n%s\n", c.name, c.args, c.summary)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// runCommand parses the flags of the named command from args and runs it.
+func runCommand(ctx context.Context, name, confFile string, args []string) error {
+	c, ok := findCommand(name)
+	if !ok {
+		return fmt.Errorf("unknown command %q, see stockstalk help", name)
+	}
+	fs := commandFlags(c)
+	run := c.setup(fs)
+	rest, err := parseInterspersed(fs, args)
+	if err == flag.ErrHelp {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	err = run(ctx, confFile, rest)
+	if err == errUsage {
+		return fmt.Errorf("usage: stockstalk %s [flags] %s", c.name, c.args)
+	}
+	return err
+}
+
+// parseInterspersed parses fs from args, allowing flags after positional
+// arguments as in "chart VTI -out vti.png", and returns the positional
+// ones. Negative numbers and everything after "--" are positional.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for len(args) > 0 {
+		if _, err := strconv.ParseFloat(args[0], 64); err == nil {
+			rest, args = append(rest, args[0]), args[1:]
+			continue
+		}
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if n := len(args) - fs.NArg(); n > 0 && args[n-1] == "--" {
+			return append(rest, fs.Args()...), nil
+		}
+		args = fs.Args()
+		if len(args) > 0 {
+			rest, args = append(rest, args[0]), args[1:]
+		}
+	}
+	return rest, nil
+}
+
+// usage prints the global flags and the list of commands.
+func usage() {
+	w := flag.CommandLine.Output()
+	fmt.Fprintf(w, "usage: stockstalk [global flags] [COMMAND] [flags] [arguments]\n\nCommands:\n")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.name, c.summary)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nRun \"stockstalk help COMMAND\" for the flags of a command.\n\nGlobal flags:\n")
+	flag.PrintDefaults()
+}
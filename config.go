@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// parseConfig reads file and applies the settings it holds for the whole
+// run, read_only and the retry policy, to their globals.
+func parseConfig(file string) (config, error) {
+	c, err := loadConfig(file)
+	if err != nil {
+		return c, err
+	}
+	if c.ReadOnly {
+		readOnly = true
+	}
+	// an invalid policy is reported by validate; until then use the default
+	if fetchRetry, err = c.Quotes.Retry.policy(); err != nil {
+		fetchRetry = defaultRetry
+	}
+	return c, nil
+}
+
+// loadConfig reads file leaving the globals alone, so it is safe to call
+// from requests served at the same time.
+func loadConfig(file string) (config, error) {
+	b, err := readConfigFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config{}, nil
+		}
+		return config{}, err
+	}
+	var c config
+	if err := json.Unmarshal(b, &c); err != nil {
+		return config{}, newConfigError(file, b, err)
+	}
+	warnUnknownFields(file, b)
+	return c, nil
+}
+
+// validate checks what parsing alone does not: the entries, then the
+// settings.
+func (c config) validate() error {
+	for _, p := range c.entryProblems(clock()) {
+		if !p.Warning {
+			return p
+		}
+	}
+	return c.validateSettings()
+}
+
+func (c config) validateSettings() error {
+	if _, err := historyPolicy(c.HistoryDedupe); err != nil {
+		return err
+	}
+	for _, r := range c.Recurring {
+		if err := r.validate(); err != nil {
+			return err
+		}
+	}
+	names := make(map[string]bool)
+	for _, g := range c.Goals {
+		if g.Name == "" || !g.Target.IsPositive() || g.By.IsZero() {
+			return fmt.Errorf("goal %q: needs a name, a positive target and a date", g.Name)
+		}
+		if names[strings.ToLower(g.Name)] {
+			return fmt.Errorf("goal %q is set twice", g.Name)
+		}
+		names[strings.ToLower(g.Name)] = true
+	}
+	for _, w := range c.Watchlist {
+		if _, err := parseScreen(w.Screen); err != nil {
+			return fmt.Errorf("watchlist %s: %v", w.Symbol, err)
+		}
+	}
+	switch c.Quotes.Provider {
+	case "", "yahoo", "iex", "alphavantage":
+	default:
+		return fmt.Errorf("unknown quote provider %q, want yahoo, iex or alphavantage", c.Quotes.Provider)
+	}
+	for _, f := range c.Quotes.Fallback {
+		switch f {
+		case "yahoo", "iex", "alphavantage":
+		default:
+			return fmt.Errorf("unknown fallback quote provider %q, want yahoo, iex or alphavantage", f)
+		}
+	}
+	if _, err := c.Quotes.Retry.policy(); err != nil {
+		return err
+	}
+	if _, err := c.Quotes.cacheTTL(); err != nil {
+		return err
+	}
+	switch c.Quotes.PriceMode {
+	case "", priceLast, priceClose:
+	default:
+		return fmt.Errorf("unknown price_mode %q, want close or last", c.Quotes.PriceMode)
+	}
+	if err := c.Retention.validate(); err != nil {
+		return err
+	}
+	if err := c.Allocation.validate(); err != nil {
+		return err
+	}
+	if err := c.Tax.validate(); err != nil {
+		return err
+	}
+	if c.Schedule != "" {
+		if _, err := parseCron(c.Schedule); err != nil {
+			return err
+		}
+	}
+	for _, ch := range c.Notifications.Channels {
+		if err := ch.validate(); err != nil {
+			return err
+		}
+	}
+	for _, r := range c.AlertRules {
+		if err := r.validate(c.Notifications.Channels); err != nil {
+			return err
+		}
+	}
+	switch c.Notifications.Frequency {
+	case "", frequencyDaily, frequencyWeekly, frequencyMonthly:
+	default:
+		return fmt.Errorf("unknown report frequency %q, want daily, weekly or monthly", c.Notifications.Frequency)
+	}
+	switch c.Notifications.Format {
+	case "", "text", "html":
+	default:
+		return fmt.Errorf("unknown report format %q, want html or text", c.Notifications.Format)
+	}
+	for _, v := range c.Vests {
+		if v.Kind != "" && v.Kind != "vest" && v.Kind != "lockup" {
+			return fmt.Errorf("vest %s: kind must be vest or lockup", v.Symbol)
+		}
+	}
+	return c.Market.validate()
+}
+
+func writeConfig(file string, conf config) error {
+	if readOnly {
+		return errReadOnly
+	}
+	if err := backupConfig(file, conf.backups()); err != nil {
+		return err
+	}
+	conf.WrittenBy, conf.MinVersion = version, minConfigVersion
+	sortConfig(conf)
+	var bu bytes.Buffer
+	enc := json.NewEncoder(&bu)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(conf); err != nil {
+		return err
+	}
+	b := bu.Bytes()
+	// a config encrypted at rest stays encrypted
+	if fileEncrypted(file) {
+		pass, err := configPassphrase()
+		if err != nil {
+			return err
+		}
+		if b, err = encryptConfig(b, pass); err != nil {
+			return err
+		}
+	}
+	start := time.Now()
+	if err := writeFileAtomic(file, b, 0777); err != nil {
+		logError("config write failed", "file", file, "error", err)
+		return err
+	}
+	logInfo("config written", "file", file, "investments", len(conf.Investments), "duration", time.Since(start))
+	return nil
+}
+
+// writeFileAtomic replaces file with b so that a crash leaves either the old
+// or the new contents, never a mix: b goes to a temporary file in the same
+// directory, which is synced and then renamed over file. An existing file
+// keeps its permissions.
+func writeFileAtomic(file string, b []byte, perm os.FileMode) error {
+	if fi, err := os.Stat(file); err == nil {
+		perm = fi.Mode().Perm()
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(f.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), file)
+}
+
+// sortConfig puts investments and history in a stable order so that
+// successive writes of the same data produce identical files. Map keys are
+// already sorted by encoding/json.
+func sortConfig(conf config) {
+	sort.SliceStable(conf.Investments, func(i, j int) bool {
+		a, b := conf.Investments[i], conf.Investments[j]
+		if a.Symbol != b.Symbol {
+			return a.Symbol < b.Symbol
+		}
+		return a.Date.Before(b.Date)
+	})
+	for _, h := range conf.History {
+		sort.SliceStable(h, func(i, j int) bool {
+			return h[i].Date.Before(h[j].Date)
+		})
+	}
+}
+
+// defaultBackups is how many backups of the config are kept unless the
+// config says otherwise.
+const defaultBackups = 5
+
+func (c config) backups() int {
+	if c.Backups <= 0 {
+		return defaultBackups
+	}
+	return c.Backups
+}
+
+// backupPath is the nth most recent backup of file, from 1.
+func backupPath(file string, n int) string {
+	return fmt.Sprintf("%s.%d", file, n)
+}
+
+// backupConfig copies the current config aside before it is overwritten,
+// shifting the older backups up and dropping any beyond keep. A config that
+// no longer parses is never overwritten, since it may still hold data worth
+// recovering by hand, and neither is one that requires a newer stockstalk,
+// since this one would drop whatever it does not know about.
+func backupConfig(file string, keep int) error {
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	plain, err := plainConfig(file, b)
+	if err != nil {
+		return fmt.Errorf("refusing to overwrite %v", err)
+	}
+	var c config
+	if err := json.Unmarshal(plain, &c); err != nil {
+		return fmt.Errorf("refusing to overwrite %v", newConfigError(file, plain, err))
+	}
+	for n := keep; n > 1; n-- {
+		if err := os.Rename(backupPath(file, n-1), backupPath(file, n)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if err := writeFileAtomic(backupPath(file, 1), b, 0600); err != nil {
+		return err
+	}
+	if compareVersions(c.MinVersion, version) > 0 {
+		return fmt.Errorf("refusing to overwrite %s: it was written by stockstalk %s and needs at least %s, this is %s; upgrade stockstalk (a copy is at %s)",
+			file, c.WrittenBy, c.MinVersion, version, backupPath(file, 1))
+	}
+	return nil
+}
+
+// restoreConfig replaces file with its nth most recent backup. The file
+// being replaced becomes the latest backup, so a restore can be undone,
+// or is kept alongside with a .corrupt suffix if it does not parse.
+func restoreConfig(file string, n int) error {
+	if readOnly {
+		return errReadOnly
+	}
+	bak := backupPath(file, n)
+	b, err := ioutil.ReadFile(bak)
+	if err != nil {
+		return err
+	}
+	plain, err := plainConfig(bak, b)
+	if err != nil {
+		return err
+	}
+	var c config
+	if err := json.Unmarshal(plain, &c); err != nil {
+		return newConfigError(bak, plain, err)
+	}
+	if cur, err := parseConfig(file); err == nil {
+		if err := backupConfig(file, cur.backups()); err != nil {
+			return err
+		}
+	} else if err := os.Rename(file, file+".corrupt"); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(file, b, 0777); err != nil {
+		return err
+	}
+	fmt.Printf(c.tr("restored %s from %s")+"\n", file, bak)
+	return appendAudit(file, auditEntry{Action: "restore", Detail: "from " + bak})
+}
+
+// listBackups prints the backups of file, most recent first, with when
+// each was taken and how many investments it holds.
+func listBackups(w io.Writer, file string) error {
+	for n := 1; ; n++ {
+		bak := backupPath(file, n)
+		fi, err := os.Stat(bak)
+		if os.IsNotExist(err) {
+			if n == 1 {
+				return fmt.Errorf("no backups of %s", file)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		c, err := parseConfig(bak)
+		if err != nil {
+			fmt.Fprintf(w, "%d %s %v\n", n, fi.ModTime().Format(time.RFC3339), err)
+			continue
+		}
+		fmt.Fprintf(w, c.tr("%d %s %d investments")+"\n", n, fi.ModTime().Format(time.RFC3339), len(c.Investments))
+	}
+}
+
+// configError locates a JSON error in a config file by line and column.
+type configError struct {
+	file      string
+	offset    int64
+	line, col int
+	err       error
+}
+
+func (e *configError) Error() string {
+	msg := fmt.Sprintf("%s:%d:%d (byte %d): %v", e.file, e.line, e.col, e.offset, e.err)
+	if _, err := os.Stat(backupPath(e.file, 1)); err == nil {
+		msg += fmt.Sprintf("\nrun \"stockstalk -config %s restore\" to roll back to %s", e.file, backupPath(e.file, 1))
+	}
+	return msg
+}
+
+func newConfigError(file string, b []byte, err error) error {
+	var offset int64
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		offset = syntaxErr.Offset
+	case errors.As(err, &typeErr):
+		offset = typeErr.Offset
+	default:
+		return err
+	}
+	if offset > int64(len(b)) {
+		offset = int64(len(b))
+	}
+	before := b[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+	return &configError{file: file, offset: offset, line: line, col: col, err: err}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSchedule is a parsed five-field cron expression: minute, hour, day of
+// month, month and day of week (0 or 7 for Sunday). Each field is a set of
+// allowed values as a bit mask.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+	// anyDom and anyDow record a "*" day field. As in cron, when both day
+	// fields are restricted a day matching either one runs.
+	anyDom, anyDow bool
+}
+
+var cronFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 7},
+}
+
+// parseCron parses expressions such as "0 18 * * 1-5" or "*/30 9-16 * * *".
+// Fields are "*", numbers, ranges and comma-separated lists of them, each
+// optionally with a "/step".
+func parseCron(expr string) (cronSchedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(cronFields) {
+		return cronSchedule{}, fmt.Errorf("schedule %q: want 5 fields, minute hour day month weekday", expr)
+	}
+	var masks [5]uint64
+	for k, f := range fields {
+		spec := cronFields[k]
+		for _, part := range strings.Split(f, ",") {
+			rng, step := part, 1
+			if i := strings.Index(part, "/"); i >= 0 {
+				n, err := strconv.Atoi(part[i+1:])
+				if err != nil || n <= 0 {
+					return cronSchedule{}, fmt.Errorf("schedule %q: bad %s step %q", expr, spec.name, part)
+				}
+				rng, step = part[:i], n
+			}
+			lo, hi := spec.min, spec.max
+			if rng != "*" {
+				bounds := strings.SplitN(rng, "-", 2)
+				var err error
+				if lo, err = strconv.Atoi(bounds[0]); err != nil {
+					return cronSchedule{}, fmt.Errorf("schedule %q: bad %s %q", expr, spec.name, part)
+				}
+				hi = lo
+				if len(bounds) == 2 {
+					if hi, err = strconv.Atoi(bounds[1]); err != nil {
+						return cronSchedule{}, fmt.Errorf("schedule %q: bad %s %q", expr, spec.name, part)
+					}
+				} else if step > 1 {
+					hi = spec.max
+				}
+			}
+			if lo < spec.min || hi > spec.max || lo > hi {
+				return cronSchedule{}, fmt.Errorf("schedule %q: %s %q out of range %d-%d", expr, spec.name, part, spec.min, spec.max)
+			}
+			for v := lo; v <= hi; v += step {
+				masks[k] |= 1 << uint(v)
+			}
+		}
+	}
+	s := cronSchedule{minute: masks[0], hour: masks[1], dom: masks[2], month: masks[3], dow: masks[4],
+		anyDom: fields[2] == "*", anyDow: fields[4] == "*"}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1
+	}
+	return s, nil
+}
+
+func (s cronSchedule) day(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	switch {
+	case s.anyDom && s.anyDow:
+		return true
+	case s.anyDom:
+		return dow
+	case s.anyDow:
+		return dom
+	}
+	return dom || dow
+}
+
+// next returns the first minute after t the schedule runs at, in t's
+// location, for which ok (if set) also holds of the day. It gives up after
+// five years, which only an impossible date such as February 30th reaches.
+func (s cronSchedule) next(t time.Time, ok func(time.Time) bool) (time.Time, error) {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	end := t.AddDate(5, 0, 0)
+	for t.Before(end) {
+		if s.month&(1<<uint(t.Month())) == 0 || !s.day(t) || (ok != nil && !ok(t)) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("schedule never runs")
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// encryptedHeader starts a config encrypted at rest. The rest of the file
+// is the base64 of a random scrypt salt, a random AES-GCM nonce and the
+// sealed JSON, with the header as additional data.
+const encryptedHeader = "stockstalk encrypted config v1\n"
+
+const (
+	saltSize = 16
+	// scrypt's recommended cost for interactive use, about 100ms
+	scryptN, scryptR, scryptP = 1 << 15, 8, 1
+)
+
+// configPassphrase is the passphrase of an encrypted config: the contents
+// of the file named by STOCKSTALK_KEY_FILE, STOCKSTALK_PASSPHRASE, or the
+// keyring entry "config", in that order.
+func configPassphrase() (string, error) {
+	var pass string
+	var err error
+	if f := os.Getenv("STOCKSTALK_KEY_FILE"); f != "" {
+		pass, err = secret("config", "", f)
+	} else if pass = os.Getenv("STOCKSTALK_PASSPHRASE"); pass == "" {
+		pass, err = secret("config", "", "")
+	}
+	if err == nil && pass == "" {
+		err = errors.New("the config is encrypted: set STOCKSTALK_PASSPHRASE or STOCKSTALK_KEY_FILE, or store the passphrase with \"auth set config\"")
+	}
+	return pass, err
+}
+
+// configKeys caches the keys derived from the passphrase by salt, since a
+// command may read the config several times.
+var configKeys struct {
+	sync.Mutex
+	keys map[string][]byte
+}
+
+func configKey(pass string, salt []byte) ([]byte, error) {
+	configKeys.Lock()
+	defer configKeys.Unlock()
+	id := pass + "\x00" + string(salt)
+	if k, ok := configKeys.keys[id]; ok {
+		return k, nil
+	}
+	k, err := scrypt.Key([]byte(pass), salt, scryptN, scryptR, scryptP, 32)
+	if err != nil {
+		return nil, err
+	}
+	if configKeys.keys == nil {
+		configKeys.keys = make(map[string][]byte)
+	}
+	configKeys.keys[id] = k
+	return k, nil
+}
+
+func isEncrypted(b []byte) bool {
+	return bytes.HasPrefix(b, []byte(encryptedHeader))
+}
+
+// fileEncrypted reports whether file holds an encrypted config.
+func fileEncrypted(file string) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	head := make([]byte, len(encryptedHeader))
+	_, err = io.ReadFull(f, head)
+	return err == nil && isEncrypted(head)
+}
+
+func configCipher(pass string, salt []byte) (cipher.AEAD, error) {
+	key, err := configKey(pass, salt)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// encryptConfig seals the config JSON plain with pass.
+func encryptConfig(plain []byte, pass string) ([]byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	gcm, err := configCipher(pass, salt)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	sealed := gcm.Seal(append(salt, nonce...), nonce, plain, []byte(encryptedHeader))
+	return []byte(encryptedHeader + base64.StdEncoding.EncodeToString(sealed) + "\n"), nil
+}
+
+// plainConfig returns the JSON of the config file contents b, decrypting
+// them when they are encrypted.
+func plainConfig(file string, b []byte) ([]byte, error) {
+	if !isEncrypted(b) {
+		return b, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(b[len(encryptedHeader):])))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	pass, err := configPassphrase()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	if len(sealed) < saltSize {
+		return nil, fmt.Errorf("%s: truncated", file)
+	}
+	gcm, err := configCipher(pass, sealed[:saltSize])
+	if err != nil {
+		return nil, err
+	}
+	sealed = sealed[saltSize:]
+	if len(sealed) < gcm.NonceSize() {
+		return nil, fmt.Errorf("%s: truncated", file)
+	}
+	plain, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(encryptedHeader))
+	if err != nil {
+		return nil, fmt.Errorf("%s: wrong passphrase, or the file was altered", file)
+	}
+	return plain, nil
+}
+
+// readConfigFile returns the JSON of a config file, decrypted.
+func readConfigFile(file string) ([]byte, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return plainConfig(file, b)
+}
+
+// encryptFiles encrypts confFile and its backups in place, or decrypts
+// them when encrypt is false. Files already as asked are left alone. The
+// audit log and history are not encrypted.
+func encryptFiles(w io.Writer, confFile string, encrypt bool) error {
+	if readOnly {
+		return errReadOnly
+	}
+	var pass string
+	if encrypt {
+		var err error
+		if pass, err = configPassphrase(); err != nil {
+			return err
+		}
+	}
+	files := []string{confFile}
+	for n := 1; ; n++ {
+		if _, err := os.Stat(backupPath(confFile, n)); err != nil {
+			break
+		}
+		files = append(files, backupPath(confFile, n))
+	}
+	for _, f := range files {
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return err
+		}
+		if isEncrypted(b) == encrypt {
+			continue
+		}
+		if encrypt {
+			b, err = encryptConfig(b, pass)
+		} else {
+			b, err = plainConfig(f, b)
+		}
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(f, b, 0600); err != nil {
+			return err
+		}
+		if encrypt {
+			fmt.Fprintf(w, "encrypted %s\n", f)
+		} else {
+			fmt.Fprintf(w, "decrypted %s\n", f)
+		}
+	}
+	return nil
+}
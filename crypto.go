@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// coinGeckoIDs maps the tickers of common coins to CoinGecko's ids. Other
+// coins are named by their id, e.g. "render-token-USD".
+var coinGeckoIDs = map[string]string{
+	"BTC":   "bitcoin",
+	"ETH":   "ethereum",
+	"USDT":  "tether",
+	"USDC":  "usd-coin",
+	"BNB":   "binancecoin",
+	"SOL":   "solana",
+	"XRP":   "ripple",
+	"ADA":   "cardano",
+	"DOGE":  "dogecoin",
+	"DOT":   "polkadot",
+	"AVAX":  "avalanche-2",
+	"LTC":   "litecoin",
+	"LINK":  "chainlink",
+	"MATIC": "matic-network",
+	"XLM":   "stellar",
+	"ATOM":  "cosmos",
+	"BCH":   "bitcoin-cash",
+}
+
+// cryptoProvider prices cryptocurrencies with CoinGecko. Symbols are a coin
+// and the currency to price it in, as Yahoo writes them: "BTC-USD".
+type cryptoProvider struct{}
+
+// splitCryptoSymbol returns the CoinGecko id and currency of symbol.
+func splitCryptoSymbol(symbol string) (id, currency string, err error) {
+	k := strings.LastIndex(symbol, "-")
+	if k <= 0 || k == len(symbol)-1 {
+		return "", "", permanentError{fmt.Errorf("crypto symbol %q, want a coin and a currency such as BTC-USD", symbol)}
+	}
+	coin, currency := symbol[:k], strings.ToUpper(symbol[k+1:])
+	if id, ok := coinGeckoIDs[strings.ToUpper(coin)]; ok {
+		return id, currency, nil
+	}
+	return strings.ToLower(coin), currency, nil
+}
+
+// cryptoCurrency is the currency symbol is priced in.
+func cryptoCurrency(symbol string) string {
+	_, currency, _ := splitCryptoSymbol(symbol)
+	return currency
+}
+
+func (cryptoProvider) price(ctx context.Context, symbol string) (quote, error) {
+	id, currency, err := splitCryptoSymbol(symbol)
+	if err != nil {
+		return quote{}, err
+	}
+	vs := strings.ToLower(currency)
+	u := fmt.Sprintf("https://api.coingecko.com/api/v3/simple/price?ids=%s&vs_currencies=%s&include_24hr_change=true&include_last_updated_at=true",
+		url.QueryEscape(id), url.QueryEscape(vs))
+	var body map[string]map[string]float64
+	if err := getJSON(ctx, u, &body); err != nil {
+		return quote{}, fmt.Errorf("%s: %w", symbol, err)
+	}
+	coin, ok := body[id]
+	if !ok {
+		return quote{}, permanentError{fmt.Errorf("%s: no coin %q on CoinGecko", symbol, id)}
+	}
+	p, ok := coin[vs]
+	if !ok {
+		return quote{}, permanentError{fmt.Errorf("%s: no price in %s", symbol, currency)}
+	}
+	// There is no close; the price a day ago stands in for it.
+	q := quote{Price: decimal.NewFromFloat(p), Time: time.Unix(int64(coin["last_updated_at"]), 0)}
+	if change, ok := coin[vs+"_24h_change"]; ok && change > -100 {
+		q.PreviousClose = decimal.NewFromFloat(p / (1 + change/100))
+	}
+	return q, nil
+}
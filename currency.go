@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/doneland/yquotes"
+	"github.com/shopspring/decimal"
+)
+
+// fxMoves are the hypothetical moves, in percent, of each foreign currency
+// against the base currency that the exposure section simulates.
+var fxMoves = []float64{-20, -10, 10, 20}
+
+// holdingCurrency returns the currency symbol is quoted in.
+func holdingCurrency(ctx context.Context, store historyStore, symbol string) (string, error) {
+	qs, err := cachedSummary(ctx, store, symbol, "price", weeklyRefresh)
+	if err != nil {
+		return "", err
+	}
+	if qs.Price.Currency == "" {
+		return "", fmt.Errorf("%s: no currency", symbol)
+	}
+	return qs.Price.Currency, nil
+}
+
+// fxRate returns how many units of to one unit of from buys, refreshed
+// daily.
+func fxRate(ctx context.Context, store historyStore, from, to string) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	key := "fx-" + from + to
+	var rate float64
+	fresh, err := store.loadCache(key, 24*time.Hour, &rate)
+	if err != nil || fresh {
+		return rate, err
+	}
+	var quote *yquotes.Price
+	err = fetchRetry.do(ctx, "yahoo", func(ctx context.Context) (err error) {
+		quote, err = withContext(ctx, func() (*yquotes.Price, error) {
+			return yquotes.GetPrice(from + to + "=X")
+		})
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	rate = quote.Last
+	return rate, store.saveCache(key, rate)
+}
+
+// historicalFxRate returns how many units of to one unit of from bought at
+// the close on or before t. Past rates do not change, so they are cached
+// for good.
+func historicalFxRate(ctx context.Context, store historyStore, from, to string, t time.Time) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	key := "fx-" + from + to + "-" + t.Format(isoDate)
+	var rate float64
+	fresh, err := store.loadCache(key, math.MaxInt64, &rate)
+	if err != nil || fresh {
+		return rate, err
+	}
+	price, err := historicalPrice(ctx, store, from+to+"=X", t)
+	if err != nil {
+		return 0, err
+	}
+	rate = price.InexactFloat64()
+	return rate, store.saveCache(key, rate)
+}
+
+// baseCurrency is the currency the report is in.
+func (c config) baseCurrency() string {
+	if c.Report.BaseCurrency == "" {
+		return "USD"
+	}
+	return c.Report.BaseCurrency
+}
+
+// toBase converts amount, in currency, to the base currency at this run's
+// rates. Amounts in the base currency, or a currency without a rate, are
+// returned as they are.
+func (c config) toBase(currency string, amount decimal.Decimal) decimal.Decimal {
+	if r, ok := c.fx[currency]; ok {
+		return amount.Mul(r)
+	}
+	return amount
+}
+
+// fxRates fetches the rate to the base currency, at now, of every currency
+// an investment is held in.
+func fxRates(ctx context.Context, conf config, store historyStore, now time.Time, asOf bool) (map[string]decimal.Decimal, error) {
+	base := conf.baseCurrency()
+	rates := make(map[string]decimal.Decimal)
+	for _, i := range conf.Investments {
+		if i.Currency == "" || i.Currency == base {
+			continue
+		}
+		if _, ok := rates[i.Currency]; ok {
+			continue
+		}
+		var r float64
+		var err error
+		if asOf {
+			r, err = historicalFxRate(ctx, store, i.Currency, base, now)
+		} else {
+			r, err = fxRate(ctx, store, i.Currency, base)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s to %s: %v", i.Currency, base, err)
+		}
+		rates[i.Currency] = decimal.NewFromFloat(r)
+	}
+	return rates, nil
+}
+
+// baseLine describes a lot held in a foreign currency in the base currency:
+// its cost at the rate on the day it was bought, its value now and its
+// compound interest r adjusted for the change in the rate since.
+func baseLine(ctx context.Context, conf config, store historyStore, i investment, p performance) string {
+	base := conf.baseCurrency()
+	then, err := historicalFxRate(ctx, store, i.Currency, base, i.Date)
+	if err != nil || then == 0 {
+		return fmt.Sprintf("%s %s: %v", base, conf.tr("unavailable"), err)
+	}
+	now := conf.toBase(i.Currency, decimal.NewFromInt(1)).InexactFloat64()
+	cost := i.basis().InexactFloat64() * then
+	value := conf.toBase(i.Currency, i.Units.Mul(p.Price)).InexactFloat64()
+	years := clock().Sub(i.Date).Seconds() / secondsPerYear
+	r := 100 * ((1+p.CompoundInterest/100)*math.Pow(now/then, 1/years) - 1)
+	return fmt.Sprintf(conf.tr("in %s: cost %.2f, value %.2f, return %.2f %%"), base, cost, value, r)
+}
+
+// printCurrencyExposure shows the share of the portfolio held in each
+// currency and how the portfolio's value would change, in the base
+// currency, if a foreign currency moved by each of fxMoves.
+func printCurrencyExposure(ctx context.Context, w io.Writer, conf config, store historyStore, latest map[string]performance) {
+	base := conf.baseCurrency()
+	fmt.Fprintf(w, "=== %s (%s %s) ===\n", conf.tr("Currency exposure"), conf.tr("base"), base)
+	// holding values are already in the base currency for lots with a
+	// currency set; the others are taken to be in their quote currency
+	held := make(map[string]string)
+	for _, i := range conf.Investments {
+		if i.Currency != "" {
+			held[i.Symbol] = i.Currency
+		}
+	}
+	exposure := make(map[string]float64)
+	var total float64
+	for s, v := range holdingValues(conf, latest) {
+		if cur, ok := held[s]; ok {
+			exposure[cur] += v.InexactFloat64()
+			total += v.InexactFloat64()
+			continue
+		}
+		cur, err := holdingCurrency(ctx, store, s)
+		if err == nil {
+			var rate float64
+			if rate, err = fxRate(ctx, store, cur, base); err == nil {
+				exposure[cur] += v.InexactFloat64() * rate
+				total += v.InexactFloat64() * rate
+				continue
+			}
+		}
+		fmt.Fprintf(w, "%s %s: %v\n", s, conf.tr("unavailable"), err)
+	}
+	if total == 0 {
+		fmt.Fprintf(w, "\n")
+		return
+	}
+	var currencies []string
+	for c := range exposure {
+		currencies = append(currencies, c)
+	}
+	sort.Slice(currencies, func(i, j int) bool { return exposure[currencies[i]] > exposure[currencies[j]] })
+	var foreign float64
+	for _, c := range currencies {
+		share := exposure[c] / total
+		fmt.Fprintf(w, "%s %.1f%%", c, 100*share)
+		if c != base {
+			foreign += share
+			printMoves(w, share)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	if foreign > 0 {
+		fmt.Fprintf(w, "%s %.1f%%", conf.tr("all foreign currencies"), 100*foreign)
+		printMoves(w, foreign)
+		fmt.Fprintf(w, "\n")
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+// printMoves writes the portfolio return from each of fxMoves applied to a
+// share of it.
+func printMoves(w io.Writer, share float64) {
+	for k, m := range fxMoves {
+		sep := ", "
+		if k == 0 {
+			sep = ": "
+		}
+		fmt.Fprintf(w, "%s%+g%% %+.1f%%", sep, m, share*m)
+	}
+}
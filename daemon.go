@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// daemon runs the analysis until stopped: on the config's cron schedule,
+// shortly after each market close when the config has a market calendar,
+// and every interval otherwise. The config file is watched and reloaded
+// whenever it changes; a config that fails to load is rejected and the
+// previous one stays active. SIGTERM and interrupts stop it, cancelling any
+// run in progress, which ctx is then done for.
+func daemon(ctx context.Context, confFile string, interval time.Duration) error {
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	if err := conf.validate(); err != nil {
+		return err
+	}
+	if err := checkCredentials(conf); err != nil {
+		return err
+	}
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer w.Close()
+	// Watch the directory rather than the file: editors commonly save by
+	// renaming a new file over the old one, which drops a file watch.
+	if err := w.Add(filepath.Dir(confFile)); err != nil {
+		return err
+	}
+
+	valid := true
+	failures := 0
+	run := func() {
+		if !valid {
+			fmt.Fprintln(os.Stderr, conf.tr("config on disk is invalid, running with previous config without saving history"))
+		}
+		start := time.Now()
+		logInfo("run started")
+		ctx, cancel := withRunTimeout(ctx)
+		defer cancel()
+		var failed []telemetryFailure
+		err := safeRun(func() error {
+			if valid && len(conf.Recurring) > 0 {
+				added, err := addRecurring(ctx, confFile, &conf, newHistoryStore(confFile, conf), clock())
+				if err != nil {
+					return err
+				}
+				for _, i := range added {
+					fmt.Fprintf(os.Stderr, conf.tr("added recurring investment %s")+"\n", lotHeading(i))
+				}
+			}
+			return runError(ctx, runAnalysis(ctx, confFile, conf, runOptions{persist: valid, failures: &failed}))
+		})
+		sendTelemetry(ctx, conf, time.Since(start), err, failed)
+		logInfo("run finished", "duration", time.Since(start), "ok", err == nil)
+		if ctx.Err() == context.Canceled {
+			// shutting down: the run did not fail
+			return
+		}
+		if err != nil {
+			perr(err)
+			failures++
+		} else {
+			failures = 0
+		}
+		if _, crashed := err.(*panicError); crashed || failures == conf.Notifications.Alerts.threshold() {
+			perr(sendAlert(ctx, conf, err, failures))
+		}
+	}
+	reload := func() {
+		c, err := parseConfig(confFile)
+		if err == nil {
+			err = c.validate()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, conf.tr("config reload rejected, keeping previous config: %v")+"\n", err)
+			valid = false
+			return
+		}
+		conf, valid = c, true
+	}
+
+	// SIGHUP reloads the config and SIGUSR1 runs the analysis right away,
+	// without disturbing the schedule.
+	hup, usr1, stop := make(chan os.Signal, 1), make(chan os.Signal, 1), make(chan os.Signal, 1)
+	notifyReload(hup)
+	notifyRun(usr1)
+	notifyStop(stop)
+
+	next := time.After(nextRun(conf, interval))
+	for {
+		select {
+		case <-next:
+			run()
+			next = time.After(nextRun(conf, interval))
+		case <-usr1:
+			run()
+		case sig := <-stop:
+			fmt.Fprintf(os.Stderr, conf.tr("received %v, shutting down")+"\n", sig)
+			return nil
+		case <-hup:
+			reload()
+			next = time.After(nextRun(conf, interval))
+		case ev := <-w.Events:
+			if filepath.Clean(ev.Name) != filepath.Clean(confFile) || ev.Op&(fsnotify.Write|fsnotify.Create) == 0 {
+				continue
+			}
+			reload()
+			next = time.After(nextRun(conf, interval))
+		case err := <-w.Errors:
+			perr(err)
+		}
+	}
+}
+
+type panicError struct {
+	value interface{}
+	stack []byte
+}
+
+func (e *panicError) Error() string {
+	return fmt.Sprintf("panic: %v\n\n%s", e.value, e.stack)
+}
+
+// safeRun calls run, turning a panic into a *panicError so that one bad run
+// does not take the daemon down.
+func safeRun(run func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &panicError{value: r, stack: debug.Stack()}
+		}
+	}()
+	return run()
+}
+
+func (a alertConfig) threshold() int {
+	if a.AfterFailures <= 0 {
+		return 3
+	}
+	return a.AfterFailures
+}
+
+// sendAlert emails the alert recipients about a failed run.
+func sendAlert(ctx context.Context, conf config, runErr error, failures int) error {
+	to := conf.Notifications.Alerts.To
+	if len(to) == 0 {
+		return nil
+	}
+	host, _ := os.Hostname()
+	subject := fmt.Sprintf("stockstalk daemon failing on %s", host)
+	body := fmt.Sprintf("%d consecutive run(s) failed as of %s.\n\nLast error:\n%v\n",
+		failures, clock().Format(time.RFC1123), runErr)
+	return sendEmail(ctx, conf.Notifications.Mailgun, subject, body, "", to...)
+}
+
+// closeDelay gives quote providers time to publish the official close.
+const closeDelay = 15 * time.Minute
+
+func nextRun(conf config, interval time.Duration) time.Duration {
+	now := clock()
+	if conf.Schedule != "" {
+		next, err := nextScheduled(conf, now)
+		if err != nil {
+			perr(err)
+			return interval
+		}
+		return next.Sub(now)
+	}
+	if conf.Market.Calendar == "" {
+		return interval
+	}
+	next, err := conf.Market.nextClose(now)
+	if err != nil {
+		perr(err)
+		return interval
+	}
+	return next.Add(closeDelay).Sub(now)
+}
+
+// nextScheduled returns the first time after now the config's schedule
+// runs, read in the market's time zone and skipping days the market is
+// closed.
+func nextScheduled(conf config, now time.Time) (time.Time, error) {
+	s, err := parseCron(conf.Schedule)
+	if err != nil {
+		return time.Time{}, err
+	}
+	loc, err := conf.Market.location()
+	if err != nil {
+		return time.Time{}, err
+	}
+	return s.next(now.In(loc), conf.Market.tradingDay)
+}
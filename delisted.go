@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// inactivity marks a lot whose symbol could not be priced for several runs
+// in a row, usually because it was delisted or renamed. Inactive lots are
+// no longer priced; clearing the mark in the config tries them again.
+type inactivity struct {
+	Since time.Time `json:"since"`
+	Error string    `json:"error"` // of the last failed quote
+}
+
+// inactiveError is the quote result of an inactive lot.
+type inactiveError struct{ inactivity }
+
+func (e inactiveError) Error() string {
+	return fmt.Sprintf("inactive since %s, last: %s", e.Since.Format(humanDate), e.inactivity.Error)
+}
+
+// inactiveAfter is how many runs in a row a symbol must fail to be priced
+// before its lots are made inactive, 5 by default. Negative never does.
+func (c quotesConfig) inactiveAfter() int {
+	if c.InactiveAfter == 0 {
+		return 5
+	}
+	return c.InactiveAfter
+}
+
+// failureStreak counts the runs in a row a symbol failed in.
+type failureStreak struct {
+	Runs  int    `json:"runs"`
+	Error string `json:"error"`
+}
+
+func (s historyStore) streaksPath() string {
+	return filepath.Join(s.dir, ".failures")
+}
+
+func (s historyStore) loadStreaks() (map[string]failureStreak, error) {
+	streaks := make(map[string]failureStreak)
+	b, err := ioutil.ReadFile(s.streaksPath())
+	if os.IsNotExist(err) {
+		return streaks, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &streaks); err != nil {
+		return nil, fmt.Errorf("%s: %v", s.streaksPath(), err)
+	}
+	return streaks, nil
+}
+
+func (s historyStore) saveStreaks(streaks map[string]failureStreak) error {
+	if readOnly {
+		return errReadOnly
+	}
+	if len(streaks) == 0 {
+		err := os.Remove(s.streaksPath())
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	b, err := json.Marshal(streaks)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.streaksPath(), b, 0644)
+}
+
+// streakKey names the symbol of k in the failure streaks.
+func streakKey(k priceKey) string {
+	if k.provider == "" {
+		return k.symbol
+	}
+	return k.provider + ":" + k.symbol
+}
+
+// trackFailures counts the runs in a row each symbol failed to be priced
+// in, and makes the lots of those failing inactiveAfter runs inactive, in
+// the config file and in conf, returning their symbols. A failure counts
+// only if retrying cannot help or other symbols were priced in the run, so
+// an outage of the network or the provider does not.
+func trackFailures(confFile string, conf *config, store historyStore, prices map[priceKey]priceResult, now time.Time) ([]string, error) {
+	streaks, err := store.loadStreaks()
+	if err != nil {
+		return nil, err
+	}
+	priced := false
+	for _, r := range prices {
+		priced = priced || r.err == nil
+	}
+	changed := false
+	for k, r := range prices {
+		var perm permanentError
+		var inactive inactiveError
+		switch {
+		case r.err == nil:
+			if _, ok := streaks[streakKey(k)]; ok {
+				delete(streaks, streakKey(k))
+				changed = true
+			}
+		case errors.As(r.err, &inactive):
+		case priced || errors.As(r.err, &perm):
+			s := streaks[streakKey(k)]
+			s.Runs++
+			s.Error = r.err.Error()
+			streaks[streakKey(k)] = s
+			changed = true
+		}
+	}
+	n := conf.Quotes.inactiveAfter()
+	var expired []priceKey
+	for k := range prices {
+		if s, ok := streaks[streakKey(k)]; ok && n > 0 && s.Runs >= n {
+			expired = append(expired, k)
+		}
+	}
+	if len(expired) > 0 {
+		file, err := parseConfig(confFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range []*config{&file, conf} {
+			for m, i := range c.Investments {
+				for _, k := range expired {
+					if i.Symbol == k.symbol && i.Provider == k.provider && i.Inactive == nil {
+						c.Investments[m].Inactive = &inactivity{Since: now, Error: streaks[streakKey(k)].Error}
+					}
+				}
+			}
+		}
+		if err := writeConfig(confFile, file); err != nil {
+			return nil, err
+		}
+	}
+	var symbols []string
+	for _, k := range expired {
+		symbols = append(symbols, k.symbol)
+		detail := fmt.Sprintf("%s after %d failed runs: %s", streakKey(k), streaks[streakKey(k)].Runs, streaks[streakKey(k)].Error)
+		if err := appendAudit(confFile, auditEntry{Action: "inactive", Detail: detail}); err != nil {
+			return symbols, err
+		}
+		delete(streaks, streakKey(k))
+	}
+	sort.Strings(symbols)
+	if changed {
+		return symbols, store.saveStreaks(streaks)
+	}
+	return symbols, nil
+}
+
+// printInactive lists the lots that are no longer priced and why.
+func printInactive(w io.Writer, conf config) {
+	fmt.Fprintf(w, "=== %s ===\n", conf.tr("Inactive symbols"))
+	for _, i := range conf.Investments {
+		if i.Inactive != nil {
+			fmt.Fprintf(w, "%s %s: %v\n", i.Symbol, i.Date.Format(humanDate), inactiveError{*i.Inactive})
+		}
+	}
+	fmt.Fprintf(w, "\n")
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// snapshot is the portfolio as it stood at a point in time.
+type snapshot struct {
+	investments []investment
+	at          time.Time
+}
+
+// loadSnapshot reads the investments of a config file as of when the file
+// was last written.
+func loadSnapshot(file string) (snapshot, error) {
+	fi, err := os.Stat(file)
+	if err != nil {
+		return snapshot{}, err
+	}
+	conf, err := parseConfig(file)
+	if err != nil {
+		return snapshot{}, err
+	}
+	return snapshot{investments: conf.Investments, at: fi.ModTime()}, nil
+}
+
+// diffConfigs compares the two config files in args or, given since, the
+// current config with how it stood at the end of that date.
+func diffConfigs(ctx context.Context, w io.Writer, confFile, since string, args []string) error {
+	var old, cur snapshot
+	switch {
+	case since != "" && len(args) == 0:
+		t, err := time.ParseInLocation(isoDate, since, time.Local)
+		if err != nil {
+			return err
+		}
+		t = t.AddDate(0, 0, 1).Add(-time.Second)
+		conf, err := parseConfig(confFile)
+		if err != nil {
+			return err
+		}
+		cur = snapshot{investments: conf.Investments, at: clock()}
+		old.at = t
+		for _, i := range conf.Investments {
+			if !i.Date.After(t) {
+				old.investments = append(old.investments, i)
+			}
+		}
+	case since == "" && len(args) == 2:
+		var err error
+		if old, err = loadSnapshot(args[0]); err != nil {
+			return err
+		}
+		if cur, err = loadSnapshot(args[1]); err != nil {
+			return err
+		}
+		confFile = args[1]
+	default:
+		return errors.New("usage: diff OLD NEW, or diff -since DATE")
+	}
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	return printDiff(ctx, w, conf, newHistoryStore(confFile, conf), old, cur)
+}
+
+// lots returns the lots of s by describeInvestment, only those bought by
+// s.at if held is set.
+func lots(s snapshot, held bool) map[string]bool {
+	m := make(map[string]bool)
+	for _, i := range s.investments {
+		if !held || !i.Date.After(s.at) {
+			m[describeInvestment(i)] = true
+		}
+	}
+	return m
+}
+
+// printDiff summarizes what changed from old to cur: lots added and
+// removed, units and value per holding, and how much of the change in
+// value came from contributions rather than the market.
+func printDiff(ctx context.Context, w io.Writer, conf config, store historyStore, old, cur snapshot) error {
+	fmt.Fprintf(w, "=== %s %s - %s ===\n", conf.tr("Changes"), old.at.Format(humanDate), cur.at.Format(humanDate))
+	// Lots are listed as added or removed by whether they are in the
+	// config, but only count as contributions once their date has come.
+	inOld, inCur := lots(old, false), lots(cur, false)
+	heldOld, heldCur := lots(old, true), lots(cur, true)
+	var contributed decimal.Decimal
+	for _, i := range cur.investments {
+		if !inOld[describeInvestment(i)] {
+			fmt.Fprintf(w, "+ %s\n", describeInvestment(i))
+		}
+		if heldCur[describeInvestment(i)] && !heldOld[describeInvestment(i)] {
+			contributed = contributed.Add(i.basis())
+		}
+	}
+	for _, i := range old.investments {
+		if !inCur[describeInvestment(i)] {
+			fmt.Fprintf(w, "- %s\n", describeInvestment(i))
+		}
+		if heldOld[describeInvestment(i)] && !heldCur[describeInvestment(i)] {
+			contributed = contributed.Sub(i.basis())
+		}
+	}
+
+	units := func(s snapshot) map[string]decimal.Decimal {
+		u := make(map[string]decimal.Decimal)
+		for _, i := range s.investments {
+			if !i.Date.After(s.at) {
+				u[i.Symbol] = u[i.Symbol].Add(i.Units)
+			}
+		}
+		return u
+	}
+	oldUnits, curUnits := units(old), units(cur)
+	symbols := make(map[string]bool)
+	for s := range oldUnits {
+		symbols[s] = true
+	}
+	for s := range curUnits {
+		symbols[s] = true
+	}
+	var sorted []string
+	for s := range symbols {
+		sorted = append(sorted, s)
+	}
+	sort.Strings(sorted)
+
+	var oldTotal, curTotal decimal.Decimal
+	for _, s := range sorted {
+		var oldValue, curValue decimal.Decimal
+		if u := oldUnits[s]; !u.IsZero() {
+			p, err := historicalPrice(ctx, store, s, old.at)
+			if err != nil {
+				return err
+			}
+			oldValue = u.Mul(p)
+		}
+		if u := curUnits[s]; !u.IsZero() {
+			p, err := historicalPrice(ctx, store, s, cur.at)
+			if err != nil {
+				return err
+			}
+			curValue = u.Mul(p)
+		}
+		oldTotal, curTotal = oldTotal.Add(oldValue), curTotal.Add(curValue)
+		status := ""
+		switch {
+		case oldUnits[s].IsZero():
+			status = " (" + conf.tr("new") + ")"
+		case curUnits[s].IsZero():
+			status = " (" + conf.tr("closed") + ")"
+		}
+		fmt.Fprintf(w, "%s%s %s %s -> %s, %s %s -> %s (%s)\n", s, status, conf.tr("units"), oldUnits[s], curUnits[s],
+			conf.tr("value"), oldValue.StringFixed(2), curValue.StringFixed(2), curValue.Sub(oldValue).StringFixed(2))
+	}
+	change := curTotal.Sub(oldTotal)
+	fmt.Fprintf(w, "%s %s -> %s (%s), %s %s, %s %s\n", conf.tr("total"), oldTotal.StringFixed(2), curTotal.StringFixed(2),
+		change.StringFixed(2), conf.tr("contributions"), contributed.StringFixed(2), conf.tr("market"), change.Sub(contributed).StringFixed(2))
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// How often the report is emailed. Runs in between still record prices
+// and send alerts.
+const (
+	frequencyDaily   = "daily"
+	frequencyWeekly  = "weekly"
+	frequencyMonthly = "monthly"
+)
+
+func (n notifications) frequency() string {
+	if n.Frequency == "" {
+		return frequencyDaily
+	}
+	return n.Frequency
+}
+
+// periodStart is the start of the report period t falls in: its day, its
+// week from Monday, or its month.
+func periodStart(t time.Time, frequency string) time.Time {
+	d := startOfDay(t)
+	switch frequency {
+	case frequencyWeekly:
+		return d.AddDate(0, 0, -(int(d.Weekday())+6)%7)
+	case frequencyMonthly:
+		return d.AddDate(0, 0, 1-d.Day())
+	}
+	return d
+}
+
+// periodBefore is when the report period ending at t began, a week or a
+// month back.
+func periodBefore(t time.Time, frequency string) time.Time {
+	if frequency == frequencyMonthly {
+		return t.AddDate(0, -1, 0)
+	}
+	return t.AddDate(0, 0, -7)
+}
+
+// symbolChange is how one symbol moved over the digest period, in the base
+// currency.
+type symbolChange struct {
+	symbol string
+	// change is the percent change of its price, gain what its lots gained
+	// less the money put in during the period.
+	change, gain float64
+}
+
+// printDigest sums up the period since the last weekly or monthly report:
+// the change in the portfolio's value, the best and worst performing
+// symbols, and how much each contributed to the portfolio's return. Lots
+// bought during the period start at their cost.
+func printDigest(ctx context.Context, w io.Writer, conf config, store historyStore, latest map[string]performance, now time.Time) {
+	frequency := conf.Notifications.frequency()
+	from := periodBefore(now, frequency)
+	title := "Weekly summary"
+	if frequency == frequencyMonthly {
+		title = "Monthly summary"
+	}
+	fmt.Fprintf(w, "=== %s ===\n", conf.tr(title))
+	prices := make(map[string]decimal.Decimal)
+	start := make(map[string]float64)
+	added := make(map[string]float64)
+	for _, i := range conf.Investments {
+		if _, ok := latest[i.Symbol]; !ok || i.Date.After(now) {
+			continue
+		}
+		if i.Date.After(from) {
+			cost, err := lotCost(ctx, conf, store, i)
+			if err != nil {
+				fmt.Fprintf(w, "%s %s: %v\n", i.Symbol, conf.tr("unavailable"), err)
+				continue
+			}
+			added[i.Symbol] += cost
+			continue
+		}
+		p, ok := prices[i.Symbol]
+		if !ok {
+			var err error
+			if p, err = historicalPrice(ctx, store, i.Symbol, from); err != nil {
+				fmt.Fprintf(w, "%s %s: %v\n", i.Symbol, conf.tr("unavailable"), err)
+			}
+			prices[i.Symbol] = p
+		}
+		start[i.Symbol] += conf.toBase(i.Currency, i.Units.Mul(p)).InexactFloat64()
+	}
+	values := holdingValues(conf, latest)
+	var startValue, endValue, flows float64
+	// priced are the changes of the symbols held since the start
+	var changes, priced []symbolChange
+	for _, s := range heldSymbols(conf) {
+		v, ok := values[s]
+		if !ok {
+			continue
+		}
+		end := v.InexactFloat64()
+		startValue += start[s]
+		endValue += end
+		flows += added[s]
+		c := symbolChange{symbol: s, gain: end - start[s] - added[s]}
+		if p := prices[s]; p.IsPositive() {
+			c.change = 100 * (latest[s].Price.Div(p).InexactFloat64() - 1)
+			priced = append(priced, c)
+		}
+		changes = append(changes, c)
+	}
+	gain := endValue - startValue - flows
+	fmt.Fprintf(w, conf.tr("value %.2f, %+.2f since %s"), endValue, gain, from.Format(humanDate))
+	if startValue > 0 {
+		fmt.Fprintf(w, " (%+.2f%%)", 100*gain/startValue)
+	}
+	if flows > 0 {
+		fmt.Fprintf(w, ", %s %.2f", conf.tr("added"), flows)
+	}
+	fmt.Fprintf(w, "\n")
+	if len(priced) > 0 {
+		sort.SliceStable(priced, func(a, b int) bool { return priced[a].change > priced[b].change })
+		best, worst := priced[0], priced[len(priced)-1]
+		fmt.Fprintf(w, "%s %s %+.2f %%, %s %s %+.2f %%\n", conf.tr("best"), best.symbol, best.change,
+			conf.tr("worst"), worst.symbol, worst.change)
+	}
+	if startValue > 0 {
+		sort.SliceStable(changes, func(a, b int) bool { return changes[a].gain > changes[b].gain })
+		fmt.Fprintf(w, "%s:\n", conf.tr("contribution to return"))
+		for _, c := range changes {
+			fmt.Fprintf(w, "%s %+.2f (%+.2f%%)\n", c.symbol, c.gain, 100*c.gain/startValue)
+		}
+	}
+	fmt.Fprintf(w, "\n")
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// distribution is a capital gains distribution paid by a fund, per share
+// held on Date.
+type distribution struct {
+	Symbol   string          `json:"symbol"`
+	Date     time.Time       `json:"date"`
+	PerShare decimal.Decimal `json:"per_share"`
+	// LongTerm marks a long-term capital gains distribution; others are
+	// short-term.
+	LongTerm bool `json:"long_term,omitempty"`
+}
+
+// parseDistribution parses "symbol,date(mm/dd/yy),per_share[,long|short]".
+func parseDistribution(s string) (distribution, error) {
+	arr := strings.Split(strings.TrimSpace(s), ",")
+	if len(arr) != 3 && len(arr) != 4 {
+		return distribution{}, fmt.Errorf("distribution %q format incorrect, want symbol,date,per_share[,long|short]", s)
+	}
+	t, err := time.Parse(mmddyy, arr[1])
+	if err != nil {
+		return distribution{}, err
+	}
+	perShare, err := decimal.NewFromString(arr[2])
+	if err != nil {
+		return distribution{}, err
+	}
+	d := distribution{Symbol: arr[0], Date: t, PerShare: perShare}
+	if len(arr) == 4 {
+		switch arr[3] {
+		case "long":
+			d.LongTerm = true
+		case "short":
+		default:
+			return distribution{}, fmt.Errorf("distribution %q: kind must be long or short", s)
+		}
+	}
+	return d, nil
+}
+
+// distributedPerShare sums what each share of i was paid in distributions
+// after it was bought, up to now.
+func distributedPerShare(conf config, i investment, now time.Time) decimal.Decimal {
+	var sum decimal.Decimal
+	for _, d := range conf.Distributions {
+		if d.Symbol == i.Symbol && d.Date.After(i.Date) && !d.Date.After(now) {
+			sum = sum.Add(d.PerShare)
+		}
+	}
+	return sum
+}
+
+// distributions handles "distributions add LINE...", "distributions import
+// FILE" (one line per distribution, "-" for stdin) and, with no arguments,
+// prints what was received per tax year.
+func distributions(w io.Writer, confFile string, args []string) error {
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		printDistributions(w, conf)
+		return nil
+	}
+	var lines []string
+	switch args[0] {
+	case "add":
+		lines = args[1:]
+	case "import":
+		if len(args) != 2 {
+			return errors.New("usage: distributions import FILE")
+		}
+		f := os.Stdin
+		if args[1] != "-" {
+			if f, err = os.Open(args[1]); err != nil {
+				return err
+			}
+			defer f.Close()
+		}
+		sc := bufio.NewScanner(f)
+		for sc.Scan() {
+			if l := strings.TrimSpace(sc.Text()); l != "" && !strings.HasPrefix(l, "#") {
+				lines = append(lines, l)
+			}
+		}
+		if err := sc.Err(); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown distributions command %q, want add or import", args[0])
+	}
+	for _, l := range lines {
+		d, err := parseDistribution(l)
+		if err != nil {
+			return err
+		}
+		conf.Distributions = append(conf.Distributions, d)
+	}
+	if err := writeConfig(confFile, conf); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, conf.tr("added %d distributions")+"\n", len(lines))
+	return appendAudit(confFile, auditEntry{Action: "distributions", Detail: strings.Join(lines, "; ")})
+}
+
+// printDistributions totals the distributions received by the held lots
+// per year, with the tax due at the configured rate.
+func printDistributions(w io.Writer, conf config) {
+	type year struct{ short, long float64 }
+	years := make(map[int]*year)
+	for _, d := range conf.Distributions {
+		var shares decimal.Decimal
+		for _, i := range conf.Investments {
+			if i.Symbol == d.Symbol && i.Date.Before(d.Date) {
+				shares = shares.Add(i.Units)
+			}
+		}
+		y := years[d.Date.Year()]
+		if y == nil {
+			y = &year{}
+			years[d.Date.Year()] = y
+		}
+		amount := shares.Mul(d.PerShare).InexactFloat64()
+		if d.LongTerm {
+			y.long += amount
+		} else {
+			y.short += amount
+		}
+	}
+	var keys []int
+	for k := range years {
+		keys = append(keys, k)
+	}
+	sort.Ints(keys)
+	fmt.Fprintf(w, "=== %s ===\n", conf.tr("Capital gains distributions"))
+	for _, k := range keys {
+		y := years[k]
+		fmt.Fprintf(w, "%d %s %.2f, %s %.2f", k, conf.tr("short-term"), y.short, conf.tr("long-term"), y.long)
+		if conf.Report.TaxRate > 0 {
+			fmt.Fprintf(w, ", %s %.2f", conf.tr("estimated tax"), (y.short+y.long)*conf.Report.TaxRate/100)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// dividend is a cash dividend paid on an investment, per unit held on Date.
+type dividend struct {
+	Date    time.Time       `json:"date"`
+	PerUnit decimal.Decimal `json:"per_unit"`
+}
+
+// paidDividends returns the dividends of i paid up to now, oldest first.
+func paidDividends(i investment, now time.Time) []dividend {
+	var paid []dividend
+	for _, d := range i.Dividends {
+		if !d.Date.After(now) {
+			paid = append(paid, d)
+		}
+	}
+	sort.Slice(paid, func(a, b int) bool { return paid[a].Date.Before(paid[b].Date) })
+	return paid
+}
+
+// reinvestedUnits is what the units of i grow to up to now when every
+// dividend buys more units at the price on its payment date.
+func reinvestedUnits(ctx context.Context, store historyStore, i investment, now time.Time) (decimal.Decimal, error) {
+	units := i.Units
+	for _, d := range paidDividends(i, now) {
+		price, err := historicalPrice(ctx, store, i.Symbol, d.Date)
+		if err != nil {
+			return decimal.Decimal{}, err
+		}
+		if !price.IsPositive() {
+			continue
+		}
+		units = units.Add(units.Mul(d.PerUnit).Div(price))
+	}
+	return units, nil
+}
+
+// dividendsReceived is the cash i paid out up to now on its original units.
+func dividendsReceived(i investment, now time.Time) decimal.Decimal {
+	var sum decimal.Decimal
+	for _, d := range paidDividends(i, now) {
+		sum = sum.Add(d.PerUnit)
+	}
+	return sum.Mul(i.Units)
+}
+
+// recordDividend handles "dividend SYMBOL DATE(mm/dd/yy) PER_UNIT", adding
+// the dividend to every lot of SYMBOL bought before DATE. Lots that already
+// have a dividend on DATE are left alone so an import can be rerun.
+func recordDividend(w io.Writer, confFile string, args []string) error {
+	if len(args) != 3 {
+		return errUsage
+	}
+	t, err := time.Parse(mmddyy, args[1])
+	if err != nil {
+		return err
+	}
+	perUnit, err := decimal.NewFromString(args[2])
+	if err != nil {
+		return err
+	}
+	if !perUnit.IsPositive() {
+		return fmt.Errorf("dividend per unit must be positive")
+	}
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	symbol := strings.ToUpper(args[0])
+	added, held := 0, 0
+outer:
+	for n := range conf.Investments {
+		i := &conf.Investments[n]
+		if !strings.EqualFold(i.Symbol, symbol) || !i.Date.Before(t) {
+			continue
+		}
+		held++
+		for _, d := range i.Dividends {
+			if d.Date.Equal(t) {
+				continue outer
+			}
+		}
+		i.Dividends = append(i.Dividends, dividend{Date: t, PerUnit: perUnit})
+		added++
+	}
+	if held == 0 {
+		return fmt.Errorf("no %s lots held before %s", symbol, args[1])
+	}
+	if added == 0 {
+		fmt.Fprintln(w, conf.tr("dividend already recorded"))
+		return nil
+	}
+	if err := writeConfig(confFile, conf); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, conf.tr("recorded dividend on %d lots")+"\n", added)
+	return appendAudit(confFile, auditEntry{Action: "dividend", Detail: strings.Join(args, " ")})
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// configProblem is a mistake in a config file, at a path such as
+// "investments[2].units". Warnings do not stop stockstalk from running.
+type configProblem struct {
+	Path    string
+	Msg     string
+	Warning bool
+}
+
+func (p configProblem) String() string {
+	if p.Path == "" {
+		return p.Msg
+	}
+	return p.Path + ": " + p.Msg
+}
+
+func (p configProblem) Error() string { return p.String() }
+
+// unknownFields returns a warning for every key in the config file b that
+// no field of config reads, such as a misspelled one. Whatever such keys
+// hold is dropped the next time the config is written.
+func unknownFields(b []byte) []configProblem {
+	var v interface{}
+	if err := json.Unmarshal(b, &v); err != nil {
+		return nil
+	}
+	var problems []configProblem
+	walkUnknown(v, reflect.TypeOf(config{}), "", &problems)
+	return problems
+}
+
+var unmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+func walkUnknown(v interface{}, t reflect.Type, path string, problems *[]configProblem) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(unmarshalerType) {
+		return
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields := jsonFields(t)
+		var keys []string
+		for k := range m {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+			f, ok := fields[strings.ToLower(k)]
+			if !ok {
+				*problems = append(*problems, configProblem{Path: p, Msg: "unknown field, ignored", Warning: true})
+				continue
+			}
+			walkUnknown(m[k], f.Type, p, problems)
+		}
+	case reflect.Slice, reflect.Array:
+		if a, ok := v.([]interface{}); ok {
+			for n, e := range a {
+				walkUnknown(e, t.Elem(), fmt.Sprintf("%s[%d]", path, n), problems)
+			}
+		}
+	case reflect.Map:
+		if m, ok := v.(map[string]interface{}); ok {
+			var keys []string
+			for k := range m {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				walkUnknown(m[k], t.Elem(), fmt.Sprintf("%s[%q]", path, k), problems)
+			}
+		}
+	}
+}
+
+// jsonFields maps the lower-cased JSON names of the exported fields of t,
+// including those of embedded structs, to their fields, matching keys
+// without regard to case as encoding/json does.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for n := 0; n < t.NumField(); n++ {
+		f := t.Field(n)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" || (f.PkgPath != "" && !f.Anonymous) {
+			continue
+		}
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				for k, e := range jsonFields(ft) {
+					fields[k] = e
+				}
+				continue
+			}
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[strings.ToLower(name)] = f
+	}
+	return fields
+}
+
+// entryProblems checks the entries of c, naming each by its position: lots,
+// sales, vests and watched symbols.
+func (c config) entryProblems(now time.Time) []configProblem {
+	var problems []configProblem
+	add := func(path, format string, args ...interface{}) {
+		problems = append(problems, configProblem{Path: path, Msg: fmt.Sprintf(format, args...)})
+	}
+	for n, i := range c.Investments {
+		p := fmt.Sprintf("investments[%d]", n)
+		if i.Symbol == "" {
+			add(p+".symbol", "missing")
+		}
+		if i.Date.IsZero() {
+			add(p+".date", "missing")
+		} else if i.Date.After(now) {
+			problems = append(problems, configProblem{Path: p + ".date",
+				Msg: fmt.Sprintf("%s is in the future; the lot is left out until then", i.Date.Format(humanDate)), Warning: true})
+		}
+		if !i.Units.IsPositive() {
+			add(p+".units", "%s must be positive", i.Units)
+		} else if !i.Units.Equal(i.Units.Truncate(maxUnitPlaces)) {
+			add(p+".units", "%s has more than %d decimal places", i.Units, maxUnitPlaces)
+		}
+		if !i.Total.IsPositive() {
+			add(p+".total", "%s must be positive", i.Total)
+		}
+		if i.Fees != nil && i.Fees.IsNegative() {
+			add(p+".fees", "%s must not be negative", i.Fees)
+		}
+		if i.TaxesPaid != nil && i.TaxesPaid.IsNegative() {
+			add(p+".taxes_paid", "%s must not be negative", i.TaxesPaid)
+		}
+		if i.Currency != "" && i.Currency != strings.ToUpper(i.Currency) {
+			add(p+".currency", "%q must be upper case, e.g. %q", i.Currency, strings.ToUpper(i.Currency))
+		}
+		if i.Portfolio != "" {
+			if err := validPortfolio(i.Portfolio); err != nil {
+				add(p+".portfolio", "%v", err)
+			}
+		}
+		for k, d := range i.Dividends {
+			if !d.PerUnit.IsPositive() {
+				add(fmt.Sprintf("%s.dividends[%d].per_unit", p, k), "%s must be positive", d.PerUnit)
+			}
+		}
+	}
+	for n, s := range c.Sales {
+		p := fmt.Sprintf("sales[%d]", n)
+		if !s.Units.IsPositive() {
+			add(p+".units", "%s must be positive", s.Units)
+		}
+		if s.Date.After(now) {
+			problems = append(problems, configProblem{Path: p + ".date",
+				Msg: fmt.Sprintf("%s is in the future", s.Date.Format(humanDate)), Warning: true})
+		}
+	}
+	for n, v := range c.Vests {
+		if !v.Units.IsPositive() {
+			add(fmt.Sprintf("vests[%d].units", n), "%s must be positive", v.Units)
+		}
+	}
+	for n, w := range c.Watchlist {
+		if w.Symbol == "" {
+			add(fmt.Sprintf("watchlist[%d].symbol", n), "missing")
+		}
+	}
+	return problems
+}
+
+// warnedUnknown holds the config files whose unknown fields were already
+// warned about, so a command that loads the config again does not repeat
+// them.
+var warnedUnknown struct {
+	sync.Mutex
+	files map[string]bool
+}
+
+// warnUnknownFields logs the unknown fields of the config file b once per
+// run.
+func warnUnknownFields(file string, b []byte) {
+	warnedUnknown.Lock()
+	defer warnedUnknown.Unlock()
+	if warnedUnknown.files[file] {
+		return
+	}
+	if warnedUnknown.files == nil {
+		warnedUnknown.files = make(map[string]bool)
+	}
+	warnedUnknown.files[file] = true
+	for _, p := range unknownFields(b) {
+		logWarn("config problem", "file", file, "path", p.Path, "problem", p.Msg)
+	}
+}
+
+// doctor checks confFile and prints every problem found in it: JSON it
+// cannot parse, unknown fields, bad entries, invalid settings and missing
+// credentials. It fails if any problem is more than a warning.
+func doctor(w io.Writer, confFile string) error {
+	b, err := readConfigFile(confFile)
+	if err != nil {
+		return err
+	}
+	var c config
+	if err := json.Unmarshal(b, &c); err != nil {
+		fmt.Fprintln(w, newConfigError(confFile, b, err))
+		return fmt.Errorf("%s does not parse", confFile)
+	}
+	problems := unknownFields(b)
+	problems = append(problems, c.entryProblems(clock())...)
+	if err := c.validateSettings(); err != nil {
+		problems = append(problems, configProblem{Msg: err.Error()})
+	}
+	if err := checkCredentials(c); err != nil {
+		problems = append(problems, configProblem{Path: "credentials", Msg: err.Error()})
+	}
+	if dir := historyRoot(confFile, c).dir; dir != "" {
+		if fi, err := os.Stat(dir); err == nil && !fi.IsDir() {
+			problems = append(problems, configProblem{Path: "history_dir", Msg: dir + " is not a directory"})
+		}
+	}
+	errs := 0
+	for _, p := range problems {
+		level := c.tr("error")
+		if p.Warning {
+			level = c.tr("warning")
+		} else {
+			errs++
+		}
+		fmt.Fprintf(w, "%s: %s\n", level, p)
+	}
+	if errs > 0 {
+		return fmt.Errorf(c.tr("%s: %d problems"), confFile, errs)
+	}
+	if len(problems) == 0 {
+		fmt.Fprintf(w, c.tr("%s: no problems found")+"\n", confFile)
+	}
+	return nil
+}
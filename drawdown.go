@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// planHistoryYears is how much daily history withdrawal paths are drawn
+// from, and planPaths how many Monte Carlo paths are run.
+const (
+	planHistoryYears = 20
+	planPaths        = 10000
+)
+
+// drawdownPlan simulates withdrawing withdraw at the start of every year for
+// years years from the current portfolio and prints how often the money
+// lasts. withdraw is an amount, or a percentage such as "4%" of today's
+// value that is then withdrawn every year. method is "historical", which
+// starts a path at every month of the held symbols' history, wrapping
+// around at the end, or "montecarlo", which builds each year from randomly
+// drawn historical days.
+func drawdownPlan(ctx context.Context, w io.Writer, confFile, withdraw string, years int, method string) error {
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	if years <= 0 {
+		return fmt.Errorf("years %d must be positive", years)
+	}
+	held := make(map[string]float64)
+	for _, i := range conf.Investments {
+		held[i.Symbol] += i.Units.InexactFloat64()
+	}
+	var symbols []string
+	for s := range held {
+		symbols = append(symbols, s)
+	}
+	sort.Strings(symbols)
+	if len(symbols) == 0 {
+		return errors.New("no holdings to plan withdrawals from")
+	}
+	end := clock()
+	closes, err := alignedCloses(ctx, newHistoryStore(confFile, conf), symbols, end.AddDate(-planHistoryYears, 0, 0), end)
+	if err != nil {
+		return err
+	}
+
+	// Weight each symbol's returns by its share of today's value.
+	last := len(closes[0]) - 1
+	values := make([]float64, len(symbols))
+	var start float64
+	for k, s := range symbols {
+		values[k] = held[s] * closes[k][last]
+		start += values[k]
+	}
+	returns := dailyReturns(closes)
+	daily := make([]float64, len(returns[0]))
+	for k := range symbols {
+		for t, r := range returns[k] {
+			daily[t] += r * values[k] / start
+		}
+	}
+
+	amount, err := parseWithdrawal(withdraw, start)
+	if err != nil {
+		return err
+	}
+	yearReturn := func(from int, day func(int) int) float64 {
+		growth := 1.0
+		for d := 0; d < tradingDays; d++ {
+			growth *= 1 + daily[day(from+d)]
+		}
+		return growth - 1
+	}
+	var paths [][]float64
+	switch method {
+	case "historical":
+		n := len(daily)
+		for s := 0; s < n; s += tradingDays / 12 {
+			path := make([]float64, years)
+			for y := range path {
+				path[y] = yearReturn(s+y*tradingDays, func(i int) int { return i % n })
+			}
+			paths = append(paths, path)
+		}
+	case "montecarlo":
+		rnd := rand.New(rand.NewSource(time.Now().UnixNano()))
+		for p := 0; p < planPaths; p++ {
+			path := make([]float64, years)
+			for y := range path {
+				path[y] = yearReturn(0, func(int) int { return rnd.Intn(len(daily)) })
+			}
+			paths = append(paths, path)
+		}
+	default:
+		return fmt.Errorf("unknown method %q, want historical or montecarlo", method)
+	}
+
+	var ending []float64
+	var lasted []int
+	for _, path := range paths {
+		v := start
+		for y, r := range path {
+			v -= amount
+			if v <= 0 {
+				v = 0
+				lasted = append(lasted, y)
+				break
+			}
+			v *= 1 + r
+		}
+		ending = append(ending, v)
+	}
+	sort.Float64s(ending)
+	sort.Ints(lasted)
+
+	fmt.Fprintf(w, "=== %s: %.2f %s, %d %s ===\n", conf.tr("Withdrawal plan"), amount, conf.tr("a year"), years, conf.tr("years"))
+	fmt.Fprintf(w, "%s %.2f, %d %s %s\n", conf.tr("portfolio"), start, len(paths), method, conf.tr("paths"))
+	fmt.Fprintf(w, "%s %.1f%%\n", conf.tr("money lasts in"), 100*float64(len(paths)-len(lasted))/float64(len(paths)))
+	fmt.Fprintf(w, "%s %.2f, %s %.2f\n", conf.tr("median ending value"), ending[len(ending)/2],
+		conf.tr("10th percentile"), ending[len(ending)/10])
+	if len(lasted) > 0 {
+		fmt.Fprintf(w, "%s %d %s\n", conf.tr("when it runs out, median"), lasted[len(lasted)/2], conf.tr("years"))
+	}
+	return nil
+}
+
+// parseWithdrawal parses an annual withdrawal amount, or a percentage of
+// value such as "4%".
+func parseWithdrawal(s string, value float64) (float64, error) {
+	pct := strings.HasSuffix(s, "%")
+	n, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("bad withdrawal %q, want an amount or a percentage such as 4%%", s)
+	}
+	if pct {
+		return value * n / 100, nil
+	}
+	return n, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// fetchWorkers bounds how many quotes are requested at once.
+const fetchWorkers = 8
+
+// priceKey identifies a quote: lots of the same symbol priced by different
+// providers are fetched separately.
+type priceKey struct {
+	symbol, provider string
+}
+
+type priceResult struct {
+	price decimal.Decimal
+	// previous is the previous close, when the provider gives it
+	previous decimal.Decimal
+	// provider is the provider that supplied the price, empty when it came
+	// from the history store
+	provider string
+	err      error
+}
+
+// fetchPrices prices every investment held at now, once per symbol and
+// provider, with up to fetchWorkers requests in flight. A failed quote is
+// kept in its result instead of stopping the others. With asOf the prices
+// come from the history store.
+func fetchPrices(ctx context.Context, conf config, store historyStore, now time.Time, asOf bool) map[priceKey]priceResult {
+	jobs := make(chan investment)
+	results := make(map[priceKey]priceResult)
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for n := 0; n < fetchWorkers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				var r priceResult
+				if asOf {
+					r.price, r.err = historicalPrice(ctx, store, i.Symbol, now)
+				} else {
+					var q quote
+					q, r.err = cachedQuote(ctx, conf, store, i, now)
+					r.price, r.previous, r.provider = q.Price, q.PreviousClose, q.Provider
+				}
+				mu.Lock()
+				results[priceKey{i.Symbol, i.Provider}] = r
+				mu.Unlock()
+			}
+		}()
+	}
+	queued := make(map[priceKey]bool)
+	inactive := make(map[priceKey]priceResult)
+	for _, i := range conf.Investments {
+		k := priceKey{i.Symbol, i.Provider}
+		if i.Date.After(now) || queued[k] {
+			continue
+		}
+		if i.Inactive != nil {
+			inactive[k] = priceResult{err: inactiveError{*i.Inactive}}
+			continue
+		}
+		queued[k] = true
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	// a symbol still held in an active lot is priced whatever its older
+	// lots say
+	for k, r := range inactive {
+		if !queued[k] {
+			results[k] = r
+		}
+	}
+	return results
+}
+
+// cachedQuote is getQuote through the store's cache, keyed by symbol,
+// provider and day so a quote never outlives the day it was fetched on. A
+// cache that cannot be read or written is logged and otherwise ignored, so
+// it never costs a quote.
+func cachedQuote(ctx context.Context, conf config, store historyStore, i investment, now time.Time) (quote, error) {
+	if store.quoteTTL <= 0 {
+		return getQuote(ctx, conf, i)
+	}
+	key := "quote-" + i.Symbol + "-" + providerName(conf, i) + "-" + now.Format(isoDate)
+	var q quote
+	fresh, err := store.loadCache(key, store.quoteTTL, &q)
+	if err != nil {
+		logWarn("quote cache unreadable, fetching", "symbol", i.Symbol, "error", err)
+	} else if fresh {
+		logDebug("quote from cache", "symbol", i.Symbol, "provider", providerName(conf, i))
+		return q, nil
+	}
+	if q, err = getQuote(ctx, conf, i); err != nil {
+		return q, err
+	}
+	if err := store.saveCache(key, q); err != nil {
+		logWarn("quote not cached", "symbol", i.Symbol, "error", err)
+	}
+	return q, nil
+}
+
+// printFailures lists the symbols that could not be priced, so a report
+// missing some of them says why.
+func printFailures(w io.Writer, conf config, failed map[string]error) {
+	if len(failed) == 0 {
+		return
+	}
+	var symbols []string
+	for s := range failed {
+		symbols = append(symbols, s)
+	}
+	sort.Strings(symbols)
+	fmt.Fprintf(w, "=== %s ===\n", conf.tr("Failed quotes"))
+	for _, s := range symbols {
+		fmt.Fprintf(w, "%s: %v\n", s, failed[s])
+	}
+	fmt.Fprintf(w, "\n")
+}
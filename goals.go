@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// goal is an amount, in the base currency, to have by a date. It counts the
+// lots of its portfolio and tag, or every lot when it names neither.
+type goal struct {
+	Name      string          `json:"name"`
+	Target    decimal.Decimal `json:"target"`
+	By        time.Time       `json:"by"`
+	Portfolio string          `json:"portfolio,omitempty"`
+	Tag       string          `json:"tag,omitempty"`
+}
+
+func (g goal) includes(i investment) bool {
+	return (g.Portfolio == "" || i.Portfolio == g.Portfolio) && (g.Tag == "" || i.hasTag(g.Tag))
+}
+
+func (g goal) String() string {
+	s := fmt.Sprintf("%s %s by %s", g.Name, g.Target.StringFixed(2), g.By.Format(isoDate))
+	if g.Portfolio != "" {
+		s += " [" + g.Portfolio + "]"
+	}
+	if g.Tag != "" {
+		s += " #" + g.Tag
+	}
+	return s
+}
+
+// goalUnits are the suffixes a goal's amount may have, as in 50L for 50
+// lakh.
+var goalUnits = []struct {
+	suffix string
+	factor int64
+}{
+	{"cr", 10000000},
+	{"l", 100000},
+	{"m", 1000000},
+	{"k", 1000},
+}
+
+// parseGoalAmount reads an amount such as 5000000, 50L, 1.5Cr or 250k.
+func parseGoalAmount(s string) (decimal.Decimal, error) {
+	n, factor := strings.ToLower(strings.TrimSpace(s)), decimal.NewFromInt(1)
+	for _, u := range goalUnits {
+		if strings.HasSuffix(n, u.suffix) {
+			n, factor = strings.TrimSuffix(n, u.suffix), decimal.NewFromInt(u.factor)
+			break
+		}
+	}
+	d, err := decimal.NewFromString(n)
+	if err != nil || !d.IsPositive() {
+		return d, fmt.Errorf("bad amount %q, want e.g. 5000000, 50L, 1.5Cr or 250k", s)
+	}
+	return d.Mul(factor), nil
+}
+
+// parseGoalDate reads a date, or a year meaning its last day.
+func parseGoalDate(s string) (time.Time, error) {
+	if y, err := strconv.Atoi(s); err == nil && len(s) == 4 {
+		return time.Date(y, time.December, 31, 0, 0, 0, 0, time.Local), nil
+	}
+	t, err := time.ParseInLocation(isoDate, s, time.Local)
+	if err != nil {
+		return t, fmt.Errorf("bad date %q, want 2006-01-02 or a year", s)
+	}
+	return t, nil
+}
+
+// setGoal handles "goal NAME AMOUNT DATE", adding or updating a goal of the
+// selected portfolio and, with tag, of that tag; "goal NAME" with -remove
+// to delete one; and "goal" to list them.
+func setGoal(w io.Writer, confFile string, args []string, tag string, remove bool) error {
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 && !remove {
+		for _, g := range conf.Goals {
+			fmt.Fprintln(w, g)
+		}
+		return nil
+	}
+	if (remove && len(args) != 1) || (!remove && len(args) != 3) {
+		return errors.New("usage: goal NAME AMOUNT DATE, or goal -remove NAME")
+	}
+	idx := -1
+	for k, g := range conf.Goals {
+		if strings.EqualFold(g.Name, args[0]) {
+			idx = k
+		}
+	}
+	var detail string
+	if remove {
+		if idx < 0 {
+			return fmt.Errorf("no goal named %q", args[0])
+		}
+		detail = conf.Goals[idx].String() + " removed"
+		conf.Goals = append(conf.Goals[:idx], conf.Goals[idx+1:]...)
+	} else {
+		g := goal{Name: args[0], Portfolio: selectedPortfolio(), Tag: strings.ToLower(tag)}
+		if g.Target, err = parseGoalAmount(args[1]); err != nil {
+			return err
+		}
+		if g.By, err = parseGoalDate(args[2]); err != nil {
+			return err
+		}
+		if idx < 0 {
+			conf.Goals = append(conf.Goals, g)
+			detail = g.String()
+		} else {
+			g.Name = conf.Goals[idx].Name
+			detail = conf.Goals[idx].String() + " -> " + g.String()
+			conf.Goals[idx] = g
+		}
+	}
+	if err := writeConfig(confFile, conf); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, detail)
+	return appendAudit(confFile, auditEntry{Action: "goal", Detail: detail})
+}
+
+// monthlyContribution is what has to be added at the end of every month
+// for value to grow to target in months at an annual rate, in percent, or
+// zero when value gets there on its own.
+func monthlyContribution(value, target, rate, months float64) float64 {
+	m := math.Pow(1+rate/100, 1.0/12) - 1
+	growth := math.Pow(1+m, months)
+	short := target - value*growth
+	if short <= 0 {
+		return 0
+	}
+	if math.Abs(m) < 1e-12 {
+		return short / months
+	}
+	return short * m / (growth - 1)
+}
+
+// printGoals prints the progress of each goal with lots in conf, what it
+// needs a month to be reached in time at the money-weighted return of its
+// lots so far, and when that return alone would reach it.
+func printGoals(ctx context.Context, w io.Writer, conf config, store historyStore, latest map[string]performance, now time.Time) {
+	var goals []goal
+	for _, g := range conf.Goals {
+		// with a portfolio selected, every lot is only that portfolio's
+		if g.Portfolio != "" || selectedPortfolio() == "" {
+			goals = append(goals, g)
+		}
+	}
+	totals := subtotals(ctx, conf, store, latest, now, func(i investment) []string {
+		var names []string
+		for _, g := range goals {
+			if g.includes(i) {
+				names = append(names, g.Name)
+			}
+		}
+		return names
+	})
+	if len(totals) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "=== %s ===\n", conf.tr("Goals"))
+	for _, g := range goals {
+		t := totals[g.Name]
+		if t == nil || t.invested == 0 {
+			continue
+		}
+		target := conf.scaled(g.Target).InexactFloat64()
+		fmt.Fprintf(w, conf.tr("%s: %.2f of %.2f (%.1f%%) by %s")+"\n", g.Name, t.value, target, 100*t.value/target, g.By.Format(humanDate))
+		if t.value >= target {
+			fmt.Fprintf(w, "  %s\n", conf.tr("reached"))
+			continue
+		}
+		flows := append([]cashFlow(nil), t.flows...)
+		sort.Slice(flows, func(a, b int) bool { return flows[a].date.Before(flows[b].date) })
+		rate, err := xirr(append(flows, cashFlow{now, t.value}))
+		if err != nil {
+			fmt.Fprintf(w, "  %s: %v\n", conf.tr("unavailable"), err)
+			continue
+		}
+		fmt.Fprintf(w, "  %s %.2f %%", conf.tr("money-weighted return"), rate)
+		if months := g.By.Sub(now).Hours() / 24 / (365.25 / 12); months <= 0 {
+			fmt.Fprintf(w, ", %s", conf.tr("past its date"))
+		} else if need := monthlyContribution(t.value, target, rate, months); need > 0 {
+			fmt.Fprintf(w, ", "+conf.tr("needs %.2f a month to reach it in time"), need)
+		} else {
+			fmt.Fprintf(w, ", %s", conf.tr("on track without adding to it"))
+		}
+		// a century off is as good as never
+		years := math.Inf(1)
+		if rate > 0 {
+			years = math.Log(target/t.value) / math.Log(1+rate/100)
+		}
+		if years < 100 {
+			at := now.AddDate(0, 0, int(years*365.25))
+			fmt.Fprintf(w, ", "+conf.tr("at this return alone reached on %s")+"\n", at.Format(humanDate))
+		} else {
+			fmt.Fprintf(w, ", %s\n", conf.tr("not reached at this return alone"))
+		}
+	}
+	fmt.Fprintf(w, "\n")
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// historyStore keeps the performance history of each symbol in its own file
+// of JSON lines, oldest first. Recording a day only touches the tail of one
+// file and reading streams it, so memory use does not grow with the length
+// of the history.
+type historyStore struct {
+	dir string
+	// quoteTTL is how long fetched quotes are reused from the cache.
+	quoteTTL time.Duration
+	// frozen keeps anything from being written to the store, as -read-only
+	// does for the whole run.
+	frozen bool
+}
+
+// writable reports whether the store may be written.
+func (s historyStore) writable() bool { return !readOnly && !s.frozen }
+
+func newHistoryStore(confFile string, conf config) historyStore {
+	s := historyRoot(confFile, conf)
+	if name := selectedPortfolio(); name != "" {
+		return s.portfolio(name)
+	}
+	return s
+}
+
+// historyRoot is the store of conf's combined history, whichever portfolio
+// is selected.
+func historyRoot(confFile string, conf config) historyStore {
+	// an invalid TTL is reported by validate
+	ttl, err := conf.Quotes.cacheTTL()
+	if err != nil {
+		ttl = defaultCacheTTL
+	}
+	dir := conf.HistoryDir
+	if dir == "" {
+		dir = defaultHistoryDir(confFile)
+	} else if !filepath.IsAbs(dir) {
+		dir = filepath.Join(filepath.Dir(confFile), dir)
+	}
+	return historyStore{dir: dir, quoteTTL: ttl}
+}
+
+// defaultHistoryDir is the history directory in the user's data directory.
+// A history directory next to the config file, where older versions kept
+// it, is used instead as long as it exists.
+func defaultHistoryDir(confFile string) string {
+	legacy := filepath.Join(filepath.Dir(confFile), "history")
+	data, err := userDataDir()
+	if err != nil {
+		return legacy
+	}
+	if _, err := os.Stat(legacy); err == nil {
+		return legacy
+	}
+	return filepath.Join(data, "stockstalk", "history")
+}
+
+func (s historyStore) path(symbol string) string {
+	return filepath.Join(s.dir, url.PathEscape(symbol)+".jsonl")
+}
+
+// each calls fn for every entry recorded for symbol, oldest first.
+func (s historyStore) each(symbol string, fn func(performance) error) error {
+	f, err := os.Open(s.path(symbol))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dec := json.NewDecoder(f)
+	for {
+		var p performance
+		err := dec.Decode(&p)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %v", f.Name(), err)
+		}
+		if err := fn(p); err != nil {
+			return err
+		}
+	}
+}
+
+func (s historyStore) load(symbol string) ([]performance, error) {
+	var history []performance
+	err := s.each(symbol, func(p performance) error {
+		history = append(history, p)
+		return nil
+	})
+	return history, err
+}
+
+// record adds p to the history of its symbol, keyed by symbol and day: if
+// the last entry is from the same day, policy picks whether p replaces it,
+// is dropped or is added after it. An entry older than the last one is
+// dropped too, keeping the history in order.
+func (s historyStore) record(p performance, policy string) error {
+	if !s.writable() {
+		return errReadOnly
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(s.path(p.Symbol), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var last []byte
+	var lastOffset, end int64
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			last = append(last[:0], line...)
+			lastOffset = end
+		}
+		end += int64(len(line))
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if last != nil {
+		var prev performance
+		if err := json.Unmarshal(last, &prev); err != nil {
+			return fmt.Errorf("%s: %v", f.Name(), err)
+		}
+		sameDay := prev.Date.Format(humanDate) == p.Date.Format(humanDate)
+		switch {
+		case sameDay && policy == keepFirst:
+			return nil
+		case sameDay && policy == keepLast:
+			end = lastOffset
+		case p.Date.Before(prev.Date):
+			// a previous close captured after today was recorded
+			return nil
+		}
+	}
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if err := f.Truncate(end); err != nil {
+		return err
+	}
+	if _, err = f.WriteAt(append(b, '\n'), end); err != nil {
+		return err
+	}
+	logDebug("history recorded", "symbol", p.Symbol, "date", p.Date.Format(isoDate), "price", p.Price, "dir", s.dir)
+	return nil
+}
+
+func (s historyStore) reportedPath() string {
+	return filepath.Join(s.dir, ".reported")
+}
+
+// reportedIn reports whether the report was already sent in the period of
+// t: its day, week or month, by frequency.
+func (s historyStore) reportedIn(t time.Time, frequency string) (bool, error) {
+	b, err := ioutil.ReadFile(s.reportedPath())
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	last, err := time.Parse(time.RFC3339, strings.TrimSpace(string(b)))
+	if err != nil {
+		return false, fmt.Errorf("%s: %v", s.reportedPath(), err)
+	}
+	return periodStart(last.In(t.Location()), frequency).Equal(periodStart(t, frequency)), nil
+}
+
+func (s historyStore) setReported(t time.Time) error {
+	if !s.writable() {
+		return errReadOnly
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.reportedPath(), []byte(t.Format(time.RFC3339)+"\n"), 0644)
+}
+
+func (s historyStore) cachePath(key string) string {
+	return filepath.Join(s.dir, ".cache", url.PathEscape(key)+".json")
+}
+
+type cacheEntry struct {
+	Fetched time.Time       `json:"fetched"`
+	Value   json.RawMessage `json:"value"`
+}
+
+// loadCache decodes the value cached under key into v and reports whether it
+// was fetched less than ttl ago. A missing entry is not an error. With
+// -no-cache nothing is ever fresh.
+func (s historyStore) loadCache(key string, ttl time.Duration, v interface{}) (bool, error) {
+	if noCache {
+		return false, nil
+	}
+	b, err := ioutil.ReadFile(s.cachePath(key))
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	var e cacheEntry
+	if err := json.Unmarshal(b, &e); err != nil {
+		return false, fmt.Errorf("%s: %v", s.cachePath(key), err)
+	}
+	if err := json.Unmarshal(e.Value, v); err != nil {
+		return false, fmt.Errorf("%s: %v", s.cachePath(key), err)
+	}
+	return clock().Sub(e.Fetched) < ttl, nil
+}
+
+func (s historyStore) saveCache(key string, v interface{}) error {
+	if !s.writable() {
+		return nil // only an optimization, so not worth failing over
+	}
+	value, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(cacheEntry{Fetched: clock(), Value: value})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.cachePath(key)), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.cachePath(key), b, 0644)
+}
+
+// migrate moves history embedded in configs written by older versions into
+// the store. Symbols that already have a history file are left alone.
+func (s historyStore) migrate(history map[string][]performance, policy string) error {
+	if !s.writable() {
+		return errReadOnly
+	}
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return err
+	}
+	for symbol, h := range history {
+		f, err := os.OpenFile(s.path(symbol), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		sort.SliceStable(h, func(i, j int) bool {
+			return h[i].Date.Before(h[j].Date)
+		})
+		enc := json.NewEncoder(f)
+		for _, p := range dedupeHistory(h, policy) {
+			if err := enc.Encode(p); err != nil {
+				f.Close()
+				return err
+			}
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// The policies for recording a symbol on a day it already has an entry for.
+const (
+	keepLast  = "keep-last"
+	keepFirst = "keep-first"
+	keepAll   = "keep-all"
+)
+
+// historyPolicy reads history_dedupe or -dedupe, where "latest" and
+// "first" are the names of keep-last and keep-first in older configs.
+func historyPolicy(policy string) (string, error) {
+	switch policy {
+	case "", "latest", keepLast:
+		return keepLast, nil
+	case "first", keepFirst:
+		return keepFirst, nil
+	case keepAll:
+		return keepAll, nil
+	}
+	return "", fmt.Errorf("unknown history_dedupe %q, want keep-first, keep-last or keep-all", policy)
+}
+
+// dedupeHistory collapses entries recorded on the same day to the latest
+// one, or the first under keep-first. Under keep-all it keeps them all.
+func dedupeHistory(history []performance, policy string) []performance {
+	if policy == keepAll {
+		return history
+	}
+	var out []performance
+	index := make(map[string]int)
+	for _, h := range history {
+		day := h.Date.Format(humanDate)
+		i, ok := index[day]
+		if !ok {
+			index[day] = len(out)
+			out = append(out, h)
+			continue
+		}
+		if policy != keepFirst {
+			out[i] = h
+		}
+	}
+	return out
+}
+
+// historyOutput is the history printed by "history -output json".
+type historyOutput struct {
+	Version int                  `json:"version"`
+	Symbol  string               `json:"symbol"`
+	History []historyPointOutput `json:"history"`
+}
+
+// historyPointOutput is one recorded entry, dated to the second since a
+// day may have several.
+type historyPointOutput struct {
+	Date             string          `json:"date"`
+	Price            decimal.Decimal `json:"price"`
+	CompoundInterest float64         `json:"compound_interest"`
+	PriceType        string          `json:"price_type,omitempty"`
+	Provider         string          `json:"provider,omitempty"`
+}
+
+// parseDay reads the date of a -from or -to flag, zero when empty.
+func parseDay(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.ParseInLocation(isoDate, s, time.Local)
+	if err != nil {
+		return t, fmt.Errorf("bad date %q, want 2006-01-02", s)
+	}
+	return t, nil
+}
+
+// printHistory writes the history recorded for symbol from the start of
+// day from to the end of day to, oldest first, as text, json or csv. A zero
+// from or to leaves that end open.
+func printHistory(w io.Writer, confFile, symbol string, from, to time.Time, output string) error {
+	switch output {
+	case "text", "json", "csv":
+	default:
+		return fmt.Errorf("unknown output %q, want text, json or csv", output)
+	}
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	var points []performance
+	err = newHistoryStore(confFile, conf).each(symbol, func(p performance) error {
+		if (from.IsZero() || !p.Date.Before(from)) && (to.IsZero() || p.Date.Before(to.AddDate(0, 0, 1))) {
+			points = append(points, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	switch output {
+	case "json":
+		out := historyOutput{Version: outputVersion, Symbol: symbol, History: []historyPointOutput{}}
+		for _, p := range points {
+			out.History = append(out.History, historyPointOutput{p.Date.Format(time.RFC3339), p.Price, p.CompoundInterest, p.PriceType, p.Provider})
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"symbol", "date", "price", "compound_interest", "price_type", "provider"})
+		for _, p := range points {
+			cw.Write([]string{symbol, p.Date.Format(time.RFC3339), p.Price.String(), fmt.Sprintf("%.4f", p.CompoundInterest), p.PriceType, p.Provider})
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+	for _, p := range points {
+		if _, err := fmt.Fprintf(w, "%s %s %.2f%%\n", p.Date.Format(isoDate), p.Price, p.CompoundInterest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
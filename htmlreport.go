@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+// sparkWidth and sparkHeight size the sparkline drawn for each holding.
+const (
+	sparkWidth  = 160
+	sparkHeight = 32
+)
+
+// historyRows is how many recent days of a holding the HTML report lists;
+// the plain text part keeps the full history.
+const historyRows = 10
+
+var htmlReport = template.Must(template.New("report").Funcs(reportFuncs).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width"></head>
+<body style="font-family:sans-serif;font-size:14px;max-width:600px;margin:auto">
+{{range .Holdings}}{{with .Position}}<div style="border-bottom:1px solid #ddd;padding:8px 0;font-weight:bold">{{.Line}}</div>
+{{end}}<div style="border-bottom:1px solid #ddd;padding:8px 0">
+<div style="font-weight:bold">{{.Heading}}</div>
+{{range .Details}}<div style="color:#555">{{.}}</div>
+{{end}}{{.Sparkline}}
+<table style="border-collapse:collapse">
+{{range recent .History}}<tr><td style="padding-right:12px">{{day .Date}}</td><td style="text-align:right;color:{{if up .CompoundInterest}}#1a7f37{{else}}#cf222e{{end}}">{{rate .CompoundInterest}}</td></tr>
+{{end}}</table>
+</div>
+{{end}}{{if .Sections}}<pre style="font-size:12px;white-space:pre-wrap">{{.Sections}}</pre>{{end}}
+</body></html>
+`))
+
+// renderHTML renders the report as an HTML email, with the configured
+// template or by default each holding with a sparkline of its compound
+// interest and its recent history, followed by the optional sections as
+// preformatted text.
+func renderHTML(confFile string, conf config, data reportData) (string, error) {
+	t, err := htmlTemplate(confFile, conf)
+	if err != nil {
+		return "", err
+	}
+	data.Sections = strings.TrimSpace(data.Sections)
+	var b bytes.Buffer
+	err = t.Execute(&b, data)
+	return b.String(), err
+}
+
+// sparkline draws the compound interest of history as a small inline SVG,
+// or nothing when there are fewer than two days to draw.
+func sparkline(history []performance) template.HTML {
+	if len(history) < 2 {
+		return ""
+	}
+	series := make([]chartPoint, len(history))
+	for k, p := range history {
+		series[k] = chartPoint{date: p.Date, value: p.CompoundInterest}
+	}
+	s := newChartScale(series, sparkWidth, sparkHeight, 4)
+	var points []string
+	for _, p := range series {
+		x, y := s.point(p)
+		points = append(points, fmt.Sprintf("%d,%d", x, y))
+	}
+	return template.HTML(fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d"><polyline points="%s" fill="none" stroke="#1f77b4" stroke-width="1.5"/></svg>`,
+		sparkWidth, sparkHeight, strings.Join(points, " ")))
+}
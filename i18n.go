@@ -0,0 +1,404 @@
+package main
+
+// catalogs translates user-facing messages, keyed by language and then by
+// the English message. Messages missing from a catalog fall back to English.
+var catalogs = map[string]map[string]string{
+	"hi": {
+		"Investment Report - %s": "निवेश रिपोर्ट - %s",
+		"adding %s":              "%s जोड़ा जा रहा है",
+		"restored %s from %s":    "%s को %s से पुनर्स्थापित किया गया",
+		"config on disk is invalid, running with previous config without saving history": "डिस्क पर कॉन्फ़िग अमान्य है, इतिहास सहेजे बिना पिछले कॉन्फ़िग से चलाया जा रहा है",
+		"config reload rejected, keeping previous config: %v":                            "कॉन्फ़िग पुनः लोड अस्वीकृत, पिछला कॉन्फ़िग रखा गया: %v",
+		"report already sent today, use -force to send it again":                         "आज की रिपोर्ट पहले ही भेजी जा चुकी है, दोबारा भेजने के लिए -force का उपयोग करें",
+		"Upcoming earnings":              "आगामी तिमाही नतीजे",
+		"unavailable":                    "उपलब्ध नहीं",
+		"News":                           "समाचार",
+		"Analyst ratings":                "विश्लेषक रेटिंग",
+		"analysts":                       "विश्लेषक",
+		"target":                         "लक्ष्य",
+		"price":                          "मूल्य",
+		"upside":                         "संभावित बढ़त",
+		"ESG risk (lower is better)":     "ईएसजी जोखिम (कम बेहतर है)",
+		"Portfolio":                      "पोर्टफोलियो",
+		"Insider transactions (30 days)": "इनसाइडर लेनदेन (30 दिन)",
+		"sold":                           "ने बेचे",
+		"bought":                         "ने खरीदे",
+		"shares worth":                   "शेयर, मूल्य",
+		"%d insiders sold":               "%d इनसाइडरों ने बेचा",
+		"market cap":                     "बाज़ार पूंजीकरण",
+		"dividend yield":                 "लाभांश प्रतिफल",
+		"Screener matches":               "स्क्रीनर मिलान",
+		"Alerts - %s":                    "अलर्ट - %s",
+		"buy below":                      "इससे नीचे खरीदें",
+		"take profit above":              "इससे ऊपर मुनाफ़ा लें",
+		"%s fell to %s, below your buy target of %s":         "%s गिरकर %s पर आ गया, आपके खरीद लक्ष्य %s से नीचे",
+		"%s rose to %s, above your take-profit target of %s": "%s बढ़कर %s पर पहुँच गया, आपके मुनाफ़ा लक्ष्य %s से ऊपर",
+		"Backtest":                             "बैकटेस्ट",
+		"a year":                               "प्रति वर्ष",
+		"invested":                             "निवेश",
+		"value":                                "मूल्य",
+		"gain":                                 "लाभ",
+		"time-weighted":                        "समय-भारित",
+		"max drawdown":                         "अधिकतम गिरावट",
+		"buy and hold":                         "खरीदें और रखें",
+		"rebalance quarterly":                  "तिमाही पुनर्संतुलन",
+		"buy the dip":                          "गिरावट पर खरीदें",
+		"Strategies":                           "रणनीतियाँ",
+		"uninvested cash":                      "बिना निवेश नकद",
+		"Optimize":                             "अनुकूलन",
+		"volatility":                           "अस्थिरता",
+		"expected return":                      "अपेक्षित प्रतिफल",
+		"buy":                                  "खरीदें",
+		"sell":                                 "बेचें",
+		"Tax-loss harvesting":                  "कर-हानि संचयन",
+		"tax rate":                             "कर दर",
+		"loss":                                 "हानि",
+		"saves":                                "बचत",
+		"buy back after":                       "इसके बाद वापस खरीदें",
+		"sell after":                           "इसके बाद बेचें",
+		"no losses to harvest":                 "संचय के लिए कोई हानि नहीं",
+		"last bought":                          "पिछली खरीद",
+		"added %d distributions":               "%d वितरण जोड़े गए",
+		"Capital gains distributions":          "पूंजीगत लाभ वितरण",
+		"capital gains distributions":          "पूंजीगत लाभ वितरण",
+		"short-term":                           "अल्पकालिक",
+		"long-term":                            "दीर्घकालिक",
+		"estimated tax":                        "अनुमानित कर",
+		"Fund fees":                            "फंड शुल्क",
+		"weighted expense ratio":               "भारित व्यय अनुपात",
+		"Currency exposure":                    "मुद्रा जोखिम",
+		"base":                                 "आधार",
+		"all foreign currencies":               "सभी विदेशी मुद्राएँ",
+		"Withdrawal plan":                      "निकासी योजना",
+		"years":                                "वर्ष",
+		"portfolio":                            "पोर्टफोलियो",
+		"paths":                                "पथ",
+		"money lasts in":                       "पैसा इतने में चलता है",
+		"median ending value":                  "माध्य अंतिम मूल्य",
+		"10th percentile":                      "10वाँ प्रतिशतक",
+		"when it runs out, median":             "समाप्त होने पर, माध्य",
+		"Net worth":                            "कुल संपत्ति",
+		"brokerage":                            "ब्रोकरेज",
+		"updated":                              "अद्यतन",
+		"total":                                "कुल",
+		"1 month":                              "1 महीना",
+		"3 months":                             "3 महीने",
+		"1 year":                               "1 वर्ष",
+		"ago":                                  "पहले",
+		"Changes":                              "परिवर्तन",
+		"new":                                  "नया",
+		"closed":                               "बंद",
+		"units":                                "इकाइयाँ",
+		"contributions":                        "योगदान",
+		"market":                               "बाज़ार",
+		"paper":                                "कागज़ी",
+		"bought %s %s for %s at %s":            "%[2]s की %[1]s इकाइयाँ %[3]s में %[4]s पर खरीदीं",
+		"sold %s %s for %s at %s, realized %s": "%[2]s की %[1]s इकाइयाँ %[3]s में %[4]s पर बेचीं, लाभ %[5]s",
+		"snoozed until":                        "तक स्थगित",
+		"acknowledged":                         "स्वीकार किया",
+		"moved %s %s in %d lots from %q to %q": "%[2]s की %[1]s इकाइयाँ %[3]d लॉट में %[4]q से %[5]q में ले जाई गईं",
+		"%s %s of %s units on %s, in %d days":  "%[1]s %[2]s: %[3]s इकाइयाँ %[4]s को, %[5]d दिन में",
+		"vest":                                 "वेस्ट",
+		"lockup":                               "लॉकअप",
+		"Upcoming vests":                       "आगामी वेस्ट",
+		"days":                                 "दिन",
+		"wrote %s":                             "%s लिखा गया",
+		"removing %s":                          "%s हटाया जा रहा है",
+		"changing %s to %s":                    "%[1]s को %[2]s में बदला जा रहा है",
+		"dividends":                            "लाभांश",
+		"price-only return":                    "केवल मूल्य प्रतिफल",
+		"dividend already recorded":            "लाभांश पहले से दर्ज है",
+		"recorded dividend on %d lots":         "%d लॉट पर लाभांश दर्ज किया गया",
+		"in %s: cost %.2f, value %.2f, return %.2f %%": "%[1]s में: लागत %.2[2]f, मूल्य %.2[3]f, प्रतिफल %.2[4]f %%",
+		"Failed quotes":                          "विफल भाव",
+		"money-weighted return":                  "धन-भारित प्रतिफल",
+		"Compared with":                          "तुलना",
+		"vs":                                     "बनाम",
+		"portfolio %.2f, in %s %.2f (%+.2f)":     "पोर्टफोलियो %.2[1]f, %[2]s में %.2[3]f (%+.2[4]f)",
+		"money-weighted return %s, in %s %s":     "धन-भारित प्रतिफल %[1]s, %[2]s में %[3]s",
+		"received %v, shutting down":             "%v मिला, बंद किया जा रहा है",
+		"day change %":                           "दैनिक बदलाव %",
+		"return %":                               "प्रतिफल %",
+		"%s %s is %.2f, below %g":                "%[1]s %[2]s %.2[3]f है, %[4]g से नीचे",
+		"%s %s is %.2f, above %g":                "%[1]s %[2]s %.2[3]f है, %[4]g से ऊपर",
+		"Closed positions":                       "बंद पोज़िशन",
+		"cost":                                   "लागत",
+		"proceeds":                               "प्राप्ति",
+		"realized":                               "प्राप्त लाभ",
+		"unrealized":                             "अप्राप्त लाभ",
+		"sold %s %s for %s, realized %s":         "%[1]s %[2]s %[3]s में बेचे, प्राप्त लाभ %[4]s",
+		"imported %d, skipped %d":                "%d आयात किए, %d छोड़े",
+		"%s: kept %d of %d points":               "%[1]s: %[3]d में से %[2]d बिंदु रखे",
+		"%d %s %d investments":                   "%d %s %d निवेश",
+		"Symbol":                                 "प्रतीक",
+		"Bought":                                 "खरीदा",
+		"Account":                                "खाता",
+		"Units":                                  "इकाइयाँ",
+		"Cost":                                   "लागत",
+		"Price":                                  "मूल्य",
+		"Value":                                  "मूल्यांकन",
+		"Return":                                 "प्रतिफल",
+		"Total":                                  "कुल",
+		"Prices as last recorded by the report.": "मूल्य जैसे रिपोर्ट ने आखिरी बार दर्ज किए।",
+		"Add an investment":                      "निवेश जोड़ें",
+		"Currency":                               "मुद्रा",
+		"Add":                                    "जोड़ें",
+		"Date":                                   "तारीख",
+		"Portfolios":                             "पोर्टफोलियो",
+		"unassigned":                             "असाइन नहीं",
+		"Allocation":                             "आवंटन",
+		"drift":                                  "विचलन",
+		"no recorded price":                      "कोई दर्ज मूल्य नहीं",
+		"tax":                                    "कर",
+		"long-term in %d days, on %s":            "%d दिनों में, %s को दीर्घकालिक",
+		"no new corporate actions":               "कोई नई कॉर्पोरेट कार्रवाई नहीं",
+		"recorded %s":                            "%s दर्ज किया",
+		"would move the history of %d symbols out of the config": "कॉन्फ़िग से %d सिंबल का इतिहास बाहर ले जाया जाता",
+		"would send %q to %s":           "%[2]s को %[1]q भेजा जाता",
+		"would record %s%s %s at %s":    "%s%s %s पर %s दर्ज किया जाता",
+		"Watchlist":                     "वॉचलिस्ट",
+		"52w":                           "52 सप्ताह",
+		"drawdown":                      "गिरावट",
+		"max drawdown since purchase":   "खरीद के बाद अधिकतम गिरावट",
+		"lots":                          "लॉट",
+		"average cost":                  "औसत लागत",
+		"added recurring investment %s": "आवर्ती निवेश %s जोड़ा गया",
+		"Weekly summary":                "साप्ताहिक सारांश",
+		"Monthly summary":               "मासिक सारांश",
+		"value %.2f, %+.2f since %s":    "मूल्य %.2[1]f, %[3]s से %+.2[2]f",
+		"added":                         "जोड़ा गया",
+		"best":                          "सर्वश्रेष्ठ",
+		"worst":                         "सबसे खराब",
+		"contribution to return":        "रिटर्न में योगदान",
+		"daily":                         "दैनिक",
+		"weekly":                        "साप्ताहिक",
+		"monthly":                       "मासिक",
+		"%s report already sent, use -force to send it again": "%s रिपोर्ट पहले ही भेजी जा चुकी है, फिर से भेजने के लिए -force का उपयोग करें",
+		"Inactive symbols": "निष्क्रिय सिंबल",
+		"%s keeps failing to be priced, marked inactive": "%s की कीमत बार-बार नहीं मिल रही, निष्क्रिय किया गया",
+		"error":                                  "त्रुटि",
+		"warning":                                "चेतावनी",
+		"%s: %d problems":                        "%s: %d समस्याएँ",
+		"%s: no problems found":                  "%s: कोई समस्या नहीं मिली",
+		"Weight":                                 "भार",
+		"compound interest":                      "चक्रवृद्धि ब्याज",
+		"Tags":                                   "टैग",
+		"fees":                                   "शुल्क",
+		"taxes paid":                             "चुकाए गए कर",
+		"cost basis":                             "लागत आधार",
+		"sorted by":                              "क्रम",
+		"%d lots could not be priced":            "%d लॉट का मूल्य नहीं मिला",
+		"not enough recorded history to chart":   "चार्ट के लिए पर्याप्त दर्ज इतिहास नहीं",
+		"Goals":                                  "लक्ष्य",
+		"%s: %.2f of %.2f (%.1f%%) by %s":        "%s: %.2f / %.2f (%.1f%%), %s तक",
+		"reached":                                "पूरा हुआ",
+		"past its date":                          "तारीख निकल चुकी है",
+		"needs %.2f a month to reach it in time": "समय पर पूरा करने के लिए हर महीने %.2f चाहिए",
+		"on track without adding to it":          "बिना और निवेश के सही राह पर",
+		"at this return alone reached on %s":     "इसी रिटर्न पर %s को पूरा होगा",
+		"not reached at this return alone":       "इसी रिटर्न पर पूरा नहीं होगा",
+	},
+	"es": {
+		"Investment Report - %s": "Informe de inversiones - %s",
+		"adding %s":              "añadiendo %s",
+		"restored %s from %s":    "%s restaurado desde %s",
+		"config on disk is invalid, running with previous config without saving history": "la configuración en disco no es válida; se usa la anterior sin guardar el historial",
+		"config reload rejected, keeping previous config: %v":                            "recarga de configuración rechazada, se mantiene la anterior: %v",
+		"report already sent today, use -force to send it again":                         "el informe de hoy ya se envió; use -force para enviarlo de nuevo",
+		"Upcoming earnings":              "Próximos resultados",
+		"unavailable":                    "no disponible",
+		"News":                           "Noticias",
+		"Analyst ratings":                "Valoraciones de analistas",
+		"analysts":                       "analistas",
+		"target":                         "objetivo",
+		"price":                          "precio",
+		"upside":                         "potencial",
+		"ESG risk (lower is better)":     "Riesgo ESG (menor es mejor)",
+		"Portfolio":                      "Cartera",
+		"Insider transactions (30 days)": "Operaciones de directivos (30 días)",
+		"sold":                           "vendió",
+		"bought":                         "compró",
+		"shares worth":                   "acciones por",
+		"%d insiders sold":               "%d directivos vendieron",
+		"market cap":                     "capitalización",
+		"dividend yield":                 "rentabilidad por dividendo",
+		"Screener matches":               "Coincidencias del filtro",
+		"Alerts - %s":                    "Alertas - %s",
+		"buy below":                      "comprar por debajo de",
+		"take profit above":              "recoger beneficios por encima de",
+		"%s fell to %s, below your buy target of %s":         "%s bajó a %s, por debajo de su objetivo de compra de %s",
+		"%s rose to %s, above your take-profit target of %s": "%s subió a %s, por encima de su objetivo de beneficios de %s",
+		"Backtest":                             "Backtest",
+		"a year":                               "anual",
+		"invested":                             "invertido",
+		"value":                                "valor",
+		"gain":                                 "ganancia",
+		"time-weighted":                        "ponderado en el tiempo",
+		"max drawdown":                         "caída máxima",
+		"buy and hold":                         "comprar y mantener",
+		"rebalance quarterly":                  "reequilibrar trimestralmente",
+		"buy the dip":                          "comprar en la caída",
+		"Strategies":                           "Estrategias",
+		"uninvested cash":                      "efectivo sin invertir",
+		"Optimize":                             "Optimizar",
+		"volatility":                           "volatilidad",
+		"expected return":                      "rentabilidad esperada",
+		"buy":                                  "comprar",
+		"sell":                                 "vender",
+		"Tax-loss harvesting":                  "Cosecha de pérdidas fiscales",
+		"tax rate":                             "tasa impositiva",
+		"loss":                                 "pérdida",
+		"saves":                                "ahorra",
+		"buy back after":                       "recomprar después de",
+		"sell after":                           "vender después de",
+		"no losses to harvest":                 "no hay pérdidas que cosechar",
+		"last bought":                          "última compra",
+		"added %d distributions":               "se agregaron %d distribuciones",
+		"Capital gains distributions":          "Distribuciones de ganancias de capital",
+		"capital gains distributions":          "distribuciones de ganancias de capital",
+		"short-term":                           "corto plazo",
+		"long-term":                            "largo plazo",
+		"estimated tax":                        "impuesto estimado",
+		"Fund fees":                            "Comisiones de fondos",
+		"weighted expense ratio":               "ratio de gastos ponderado",
+		"Currency exposure":                    "Exposición a divisas",
+		"base":                                 "base",
+		"all foreign currencies":               "todas las divisas extranjeras",
+		"Withdrawal plan":                      "Plan de retiros",
+		"years":                                "años",
+		"portfolio":                            "cartera",
+		"paths":                                "trayectorias",
+		"money lasts in":                       "el dinero alcanza en",
+		"median ending value":                  "valor final mediano",
+		"10th percentile":                      "percentil 10",
+		"when it runs out, median":             "cuando se agota, mediana",
+		"Net worth":                            "Patrimonio neto",
+		"brokerage":                            "corretaje",
+		"updated":                              "actualizado",
+		"total":                                "total",
+		"1 month":                              "1 mes",
+		"3 months":                             "3 meses",
+		"1 year":                               "1 año",
+		"ago":                                  "atrás",
+		"Changes":                              "Cambios",
+		"new":                                  "nuevo",
+		"closed":                               "cerrado",
+		"units":                                "unidades",
+		"contributions":                        "aportaciones",
+		"market":                               "mercado",
+		"paper":                                "simulado",
+		"bought %s %s for %s at %s":            "compradas %s %s por %s a %s",
+		"sold %s %s for %s at %s, realized %s": "vendidas %s %s por %s a %s, realizado %s",
+		"snoozed until":                        "pospuesta hasta",
+		"acknowledged":                         "reconocida",
+		"moved %s %s in %d lots from %q to %q": "movidas %s %s en %d lotes de %q a %q",
+		"%s %s of %s units on %s, in %d days":  "%s %s de %s unidades el %s, en %d días",
+		"vest":                                 "consolidación",
+		"lockup":                               "bloqueo",
+		"Upcoming vests":                       "Próximas consolidaciones",
+		"days":                                 "días",
+		"wrote %s":                             "se escribió %s",
+		"removing %s":                          "eliminando %s",
+		"changing %s to %s":                    "cambiando %s por %s",
+		"dividends":                            "dividendos",
+		"price-only return":                    "rentabilidad solo por precio",
+		"dividend already recorded":            "dividendo ya registrado",
+		"recorded dividend on %d lots":         "dividendo registrado en %d lotes",
+		"in %s: cost %.2f, value %.2f, return %.2f %%": "en %s: coste %.2f, valor %.2f, rentabilidad %.2f %%",
+		"Failed quotes":                          "Cotizaciones fallidas",
+		"money-weighted return":                  "rentabilidad ponderada por dinero",
+		"Compared with":                          "Comparado con",
+		"vs":                                     "frente a",
+		"portfolio %.2f, in %s %.2f (%+.2f)":     "cartera %.2f, en %s %.2f (%+.2f)",
+		"money-weighted return %s, in %s %s":     "rentabilidad ponderada por dinero %s, en %s %s",
+		"received %v, shutting down":             "recibido %v, cerrando",
+		"day change %":                           "cambio diario %",
+		"return %":                               "rentabilidad %",
+		"%s %s is %.2f, below %g":                "%s %s es %.2f, por debajo de %g",
+		"%s %s is %.2f, above %g":                "%s %s es %.2f, por encima de %g",
+		"Closed positions":                       "Posiciones cerradas",
+		"cost":                                   "coste",
+		"proceeds":                               "importe",
+		"realized":                               "realizado",
+		"unrealized":                             "no realizado",
+		"sold %s %s for %s, realized %s":         "vendidas %s %s por %s, realizado %s",
+		"imported %d, skipped %d":                "importadas %d, omitidas %d",
+		"%s: kept %d of %d points":               "%s: se conservaron %d de %d puntos",
+		"%d %s %d investments":                   "%d %s %d inversiones",
+		"Symbol":                                 "Símbolo",
+		"Bought":                                 "Compra",
+		"Account":                                "Cuenta",
+		"Units":                                  "Unidades",
+		"Cost":                                   "Costo",
+		"Price":                                  "Precio",
+		"Value":                                  "Valor",
+		"Return":                                 "Rendimiento",
+		"Total":                                  "Total",
+		"Prices as last recorded by the report.": "Precios según el último registro del informe.",
+		"Add an investment":                      "Agregar una inversión",
+		"Currency":                               "Moneda",
+		"Add":                                    "Agregar",
+		"Date":                                   "Fecha",
+		"Portfolios":                             "Carteras",
+		"unassigned":                             "sin asignar",
+		"Allocation":                             "Asignación",
+		"drift":                                  "desviación",
+		"no recorded price":                      "sin precio registrado",
+		"tax":                                    "impuesto",
+		"long-term in %d days, on %s":            "largo plazo en %d días, el %s",
+		"no new corporate actions":               "no hay acciones corporativas nuevas",
+		"recorded %s":                            "registrado %s",
+		"would move the history of %d symbols out of the config": "se sacaría de la configuración el historial de %d símbolos",
+		"would send %q to %s":           "se enviaría %q a %s",
+		"would record %s%s %s at %s":    "se registraría %s%s %s el %s",
+		"Watchlist":                     "Lista de seguimiento",
+		"52w":                           "52 sem",
+		"drawdown":                      "caída",
+		"max drawdown since purchase":   "caída máxima desde la compra",
+		"lots":                          "lotes",
+		"average cost":                  "costo medio",
+		"added recurring investment %s": "inversión recurrente %s añadida",
+		"Weekly summary":                "Resumen semanal",
+		"Monthly summary":               "Resumen mensual",
+		"value %.2f, %+.2f since %s":    "valor %.2f, %+.2f desde %s",
+		"added":                         "añadido",
+		"best":                          "mejor",
+		"worst":                         "peor",
+		"contribution to return":        "contribución al rendimiento",
+		"daily":                         "diario",
+		"weekly":                        "semanal",
+		"monthly":                       "mensual",
+		"%s report already sent, use -force to send it again": "informe %s ya enviado, use -force para enviarlo de nuevo",
+		"Inactive symbols": "Símbolos inactivos",
+		"%s keeps failing to be priced, marked inactive": "%s sigue sin cotizar, marcado como inactivo",
+		"error":                                  "error",
+		"warning":                                "advertencia",
+		"%s: %d problems":                        "%s: %d problemas",
+		"%s: no problems found":                  "%s: no se encontraron problemas",
+		"Weight":                                 "Peso",
+		"compound interest":                      "interés compuesto",
+		"Tags":                                   "Etiquetas",
+		"fees":                                   "comisiones",
+		"taxes paid":                             "impuestos pagados",
+		"cost basis":                             "base de coste",
+		"sorted by":                              "ordenado por",
+		"%d lots could not be priced":            "%d lotes sin precio",
+		"not enough recorded history to chart":   "no hay suficiente historial para el gráfico",
+		"Goals":                                  "Metas",
+		"%s: %.2f of %.2f (%.1f%%) by %s":        "%s: %.2f de %.2f (%.1f%%) para el %s",
+		"reached":                                "alcanzada",
+		"past its date":                          "fecha vencida",
+		"needs %.2f a month to reach it in time": "necesita %.2f al mes para alcanzarla a tiempo",
+		"on track without adding to it":          "en camino sin aportar más",
+		"at this return alone reached on %s":     "con este rendimiento se alcanza el %s",
+		"not reached at this return alone":       "no se alcanza con este rendimiento",
+	},
+}
+
+// tr returns msg translated to the configured language.
+func (c config) tr(msg string) string {
+	if t, ok := catalogs[c.Language][msg]; ok {
+		return t
+	}
+	return msg
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// importMapping names the CSV columns a broker's transaction export keeps
+// purchases in. Action, when set, is the column holding the transaction
+// type; only rows whose type starts with one of Buy are imported. Amounts
+// may be negative, as brokers show money paid out, and may carry currency
+// symbols and thousands separators.
+type importMapping struct {
+	Symbol     string   `json:"symbol"`
+	Date       string   `json:"date"`
+	Units      string   `json:"units"`
+	Total      string   `json:"total"`
+	DateFormat string   `json:"date_format,omitempty"` // Go layout, 01/02/2006 by default
+	Action     string   `json:"action,omitempty"`
+	Buy        []string `json:"buy,omitempty"`
+	Account    string   `json:"account,omitempty"`
+}
+
+// importFormats are the exports understood without configuration. Others,
+// or changes to these, go in the config's import_formats.
+var importFormats = map[string]importMapping{
+	"generic":  {Symbol: "Symbol", Date: "Date", Units: "Units", Total: "Total", DateFormat: "2006-01-02", Account: "Account"},
+	"schwab":   {Symbol: "Symbol", Date: "Date", Units: "Quantity", Total: "Amount", Action: "Action", Buy: []string{"Buy", "Reinvest Shares"}},
+	"fidelity": {Symbol: "Symbol", Date: "Run Date", Units: "Quantity", Total: "Amount ($)", Action: "Action", Buy: []string{"YOU BOUGHT", "REINVESTMENT"}, Account: "Account"},
+	"vanguard": {Symbol: "Symbol", Date: "Trade Date", Units: "Shares", Total: "Principal Amount", DateFormat: "2006-01-02", Action: "Transaction Type", Buy: []string{"Buy", "Reinvestment"}, Account: "Account Number"},
+}
+
+func findImportMapping(conf config, name string) (importMapping, error) {
+	if m, ok := conf.ImportFormats[name]; ok {
+		return m, nil
+	}
+	if m, ok := importFormats[name]; ok {
+		return m, nil
+	}
+	var names []string
+	for n := range importFormats {
+		names = append(names, n)
+	}
+	for n := range conf.ImportFormats {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return importMapping{}, fmt.Errorf("unknown import format %q, want one of %s", name, strings.Join(names, ", "))
+}
+
+// parseAmount parses an amount as brokers write it, e.g. "-$1,234.50".
+func parseAmount(s string) (decimal.Decimal, error) {
+	s = strings.NewReplacer("$", "", ",", "", " ", "", "(", "-", ")", "").Replace(strings.TrimSpace(s))
+	d, err := decimal.NewFromString(s)
+	return d.Abs(), err
+}
+
+// importTransactions handles "import FILE", adding the purchases in a
+// broker's CSV export. Rows that are not purchases, fail to parse or match
+// an investment already in the config are skipped and listed.
+func importTransactions(w io.Writer, confFile, file, format string) error {
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	m, err := findImportMapping(conf, format)
+	if err != nil {
+		return err
+	}
+	layout := m.DateFormat
+	if layout == "" {
+		layout = "01/02/2006"
+	}
+	f := os.Stdin
+	if file != "-" {
+		if f, err = os.Open(file); err != nil {
+			return err
+		}
+		defer f.Close()
+	}
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	rows, err := r.ReadAll()
+	if err != nil {
+		return err
+	}
+	// Exports often start with a few lines about the account; the header
+	// is the first row naming the symbol column.
+	col := make(map[string]int)
+	start := -1
+	for k, row := range rows {
+		for _, name := range row {
+			if strings.TrimSpace(name) == m.Symbol {
+				start = k + 1
+			}
+		}
+		if start >= 0 {
+			for c, name := range row {
+				col[strings.TrimSpace(name)] = c
+			}
+			break
+		}
+	}
+	if start < 0 {
+		return fmt.Errorf("%s: no header with a %q column", file, m.Symbol)
+	}
+	for _, name := range []string{m.Date, m.Units, m.Total, m.Action, m.Account} {
+		if _, ok := col[name]; name != "" && !ok {
+			return fmt.Errorf("%s: no %q column", file, name)
+		}
+	}
+	field := func(row []string, name string) string {
+		if c, ok := col[name]; ok && name != "" && c < len(row) {
+			return strings.TrimSpace(row[c])
+		}
+		return ""
+	}
+	buys := m.Buy
+	if len(buys) == 0 {
+		buys = []string{"Buy"}
+	}
+
+	var added []investment
+	var skipped []string
+	skip := func(line int, format string, a ...interface{}) {
+		skipped = append(skipped, fmt.Sprintf("%s:%d: %s", file, line, fmt.Sprintf(format, a...)))
+	}
+	held := func(i investment) bool {
+		for _, o := range append(conf.Investments, added...) {
+			if o.Symbol == i.Symbol && o.Date.Equal(i.Date) && o.Units.Equal(i.Units) && o.Total.Equal(i.Total) {
+				return true
+			}
+		}
+		return false
+	}
+	for k, row := range rows[start:] {
+		line := start + k + 1
+		if m.Action != "" {
+			action := strings.ToUpper(field(row, m.Action))
+			buy := false
+			for _, b := range buys {
+				buy = buy || strings.HasPrefix(action, strings.ToUpper(b))
+			}
+			if !buy {
+				continue
+			}
+		}
+		symbol := strings.ToUpper(field(row, m.Symbol))
+		if symbol == "" {
+			skip(line, "no symbol")
+			continue
+		}
+		// some brokers add a note after the date, e.g. "01/02/2024 as of 01/01/2024"
+		date := strings.Fields(field(row, m.Date) + " ")
+		if len(date) == 0 {
+			skip(line, "no date")
+			continue
+		}
+		t, err := time.Parse(layout, date[0])
+		if err != nil {
+			skip(line, "date: %v", err)
+			continue
+		}
+		units, err := parseAmount(field(row, m.Units))
+		if err != nil || !units.IsPositive() {
+			skip(line, "bad units %q", field(row, m.Units))
+			continue
+		}
+		total, err := parseAmount(field(row, m.Total))
+		if err != nil || !total.IsPositive() {
+			skip(line, "bad total %q", field(row, m.Total))
+			continue
+		}
+		i := investment{Symbol: symbol, Date: t, Units: units, Total: total, Account: field(row, m.Account)}
+		if held(i) {
+			skip(line, "already added: %s", describeInvestment(i))
+			continue
+		}
+		added = append(added, i)
+	}
+
+	for _, s := range skipped {
+		fmt.Fprintln(w, s)
+	}
+	fmt.Fprintf(w, conf.tr("imported %d, skipped %d")+"\n", len(added), len(skipped))
+	if len(added) == 0 {
+		return nil
+	}
+	for n := range added {
+		conf.adjustLot(&added[n])
+	}
+	conf.Investments = append(conf.Investments, added...)
+	if err := writeConfig(confFile, conf); err != nil {
+		return err
+	}
+	var lines []string
+	for _, i := range added {
+		lines = append(lines, describeInvestment(i))
+	}
+	return appendAudit(confFile, auditEntry{Action: "import", Detail: strings.Join(lines, "; ")})
+}
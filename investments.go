@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// maxUnitPlaces is the most decimal places units may have, enough for
+// fractional shares and for coins counted in satoshis.
+const maxUnitPlaces = 8
+
+// basis is the cost basis of i: what it cost with its fees and taxes, in
+// its currency.
+func (i investment) basis() decimal.Decimal {
+	b := i.Total
+	if i.Fees != nil {
+		b = b.Add(*i.Fees)
+	}
+	if i.TaxesPaid != nil {
+		b = b.Add(*i.TaxesPaid)
+	}
+	return b
+}
+
+// checkAmounts makes sure the amounts of a lot being added or edited make
+// sense: positive total and units, units of at most maxUnitPlaces decimal
+// places, and fees and taxes that are not negative.
+func (i investment) checkAmounts() error {
+	if !i.Total.IsPositive() || !i.Units.IsPositive() {
+		return errors.New("total and units must be positive")
+	}
+	if !i.Units.Equal(i.Units.Truncate(maxUnitPlaces)) {
+		return fmt.Errorf("units %s have more than %d decimal places", i.Units, maxUnitPlaces)
+	}
+	if (i.Fees != nil && i.Fees.IsNegative()) || (i.TaxesPaid != nil && i.TaxesPaid.IsNegative()) {
+		return errors.New("fees and taxes paid must not be negative")
+	}
+	return nil
+}
+
+// splitCost splits an optional cost of a lot of units between the part of
+// it taken and the rest.
+func splitCost(c *decimal.Decimal, taken, units decimal.Decimal) (part, rest *decimal.Decimal) {
+	if c == nil {
+		return nil, nil
+	}
+	p := c.Mul(taken).Div(units).Round(2)
+	r := c.Sub(p)
+	return &p, &r
+}
+
+// scaleCost multiplies an optional cost by factor.
+func scaleCost(c *decimal.Decimal, factor decimal.Decimal) *decimal.Decimal {
+	if c == nil {
+		return nil
+	}
+	s := c.Mul(factor)
+	return &s
+}
+
+// optionalCost parses the value of a -fees or -taxes-paid flag, empty for
+// none.
+func optionalCost(s string) (*decimal.Decimal, error) {
+	if s == "" {
+		return nil, nil
+	}
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		return nil, fmt.Errorf("bad amount %q", s)
+	}
+	return &d, nil
+}
+
+// listInvestments prints the investments numbered in the order they are
+// kept in the config, which is the index remove and edit take.
+func listInvestments(w io.Writer, confFile, tag string) error {
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	sortConfig(conf)
+	for n, i := range conf.Investments {
+		// the index stays that of the whole list, which edit and remove take
+		if tag != "" && !i.hasTag(tag) {
+			continue
+		}
+		line := fmt.Sprintf("%d %s", n+1, describeInvestment(i))
+		if i.Portfolio != "" {
+			line += " [" + i.Portfolio + "]"
+		}
+		if t := tagLine(i); t != "" {
+			line += " " + t
+		}
+		fmt.Fprintln(w, line)
+	}
+	return nil
+}
+
+// findInvestment returns the position in the sorted investments of the one
+// addressed by args: either the index shown by list or a symbol and purchase
+// date (mm/dd/yy). A symbol and date matching several lots is an error
+// naming their indexes.
+func findInvestment(investments []investment, args []string) (int, error) {
+	switch len(args) {
+	case 1:
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > len(investments) {
+			return 0, fmt.Errorf("no investment %q, see stockstalk list", args[0])
+		}
+		return n - 1, nil
+	case 2:
+		d, err := time.Parse(mmddyy, args[1])
+		if err != nil {
+			return 0, err
+		}
+		var matches []string
+		found := -1
+		for n, i := range investments {
+			if strings.EqualFold(i.Symbol, args[0]) && i.Date.Equal(d) {
+				matches = append(matches, strconv.Itoa(n+1))
+				found = n
+			}
+		}
+		switch len(matches) {
+		case 0:
+			return 0, fmt.Errorf("no %s investment on %s, see stockstalk list", args[0], args[1])
+		case 1:
+			return found, nil
+		}
+		return 0, fmt.Errorf("%s on %s matches investments %s, give the index instead", args[0], args[1], strings.Join(matches, ", "))
+	}
+	return 0, errUsage
+}
+
+// removeInvestment removes the investment addressed by args, see
+// findInvestment.
+func removeInvestment(confFile string, args []string) error {
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	sortConfig(conf)
+	n, err := findInvestment(conf.Investments, args)
+	if err != nil {
+		return err
+	}
+	fmt.Printf(conf.tr("removing %s")+"\n", describeInvestment(conf.Investments[n]))
+	return deleteInvestment(confFile, conf, n)
+}
+
+// deleteInvestment removes the nth investment of conf, as read from
+// confFile, and writes it back.
+func deleteInvestment(confFile string, conf config, n int) error {
+	i := conf.Investments[n]
+	conf.Investments = append(conf.Investments[:n], conf.Investments[n+1:]...)
+	if err := writeConfig(confFile, conf); err != nil {
+		return err
+	}
+	return appendAudit(confFile, auditEntry{Action: "remove", Old: &i})
+}
+
+// investmentEdit holds the fields edit replaces; empty ones are kept.
+type investmentEdit struct {
+	symbol, date, total, units string
+	account, currency          *string
+	tags, note                 *string
+	fees, taxesPaid            *string
+}
+
+// editInvestment corrects the investment addressed by args, see
+// findInvestment. The edited lot goes through the same parsing as an added
+// one so a typo cannot leave the config unreadable.
+func editInvestment(confFile string, args []string, e investmentEdit) error {
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	sortConfig(conf)
+	n, err := findInvestment(conf.Investments, args)
+	if err != nil {
+		return err
+	}
+	old := conf.Investments[n]
+	fields := strings.Split(describeInvestment(old), ",")
+	for len(fields) < 6 {
+		fields = append(fields, "")
+	}
+	for k, v := range []string{e.symbol, e.date, e.total, e.units} {
+		if v != "" {
+			fields[k] = v
+		}
+	}
+	if e.account != nil {
+		fields[4] = *e.account
+	}
+	if e.currency != nil {
+		fields[5] = *e.currency
+	}
+	parsed, err := parseInvestmentLine(strings.Join(fields, ","))
+	if err != nil {
+		return err
+	}
+	// keep the provider and price targets, which the line does not carry
+	i := old
+	i.Symbol, i.Date, i.Total, i.Units = parsed.Symbol, parsed.Date, parsed.Total, parsed.Units
+	i.Account, i.Currency = parsed.Account, parsed.Currency
+	if e.tags != nil {
+		i.Tags = parseTags(*e.tags)
+	}
+	if e.note != nil {
+		i.Note = *e.note
+	}
+	if e.fees != nil {
+		if i.Fees, err = optionalCost(*e.fees); err != nil {
+			return err
+		}
+	}
+	if e.taxesPaid != nil {
+		if i.TaxesPaid, err = optionalCost(*e.taxesPaid); err != nil {
+			return err
+		}
+	}
+	if err := i.checkAmounts(); err != nil {
+		return err
+	}
+	fmt.Printf(conf.tr("changing %s to %s")+"\n", describeInvestment(old), describeInvestment(i))
+	conf.Investments[n] = i
+	if err := writeConfig(confFile, conf); err != nil {
+		return err
+	}
+	return appendAudit(confFile, auditEntry{Action: "edit", Old: &old, New: &i})
+}
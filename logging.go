@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// logLevel orders log messages by severity.
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+var logLevelNames = []string{"debug", "info", "warn", "error"}
+
+func (l logLevel) String() string { return logLevelNames[l] }
+
+func parseLogLevel(s string) (logLevel, error) {
+	for l, name := range logLevelNames {
+		if strings.EqualFold(s, name) {
+			return logLevel(l), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q, want debug, info, warn or error", s)
+}
+
+// The log goes to stderr, one line per message: either text, as in
+//
+//	2026-01-02T15:04:05Z info quote fetched symbol=AAPL provider=yahoo duration=120ms
+//
+// or, with -log-json, a JSON object with time, level, msg and the
+// message's fields. Messages below -log-level, warn by default, are
+// dropped.
+var (
+	logMin  = levelWarn
+	logJSON bool
+	logOut  io.Writer = os.Stderr
+	logMu   sync.Mutex
+)
+
+func logDebug(msg string, kv ...interface{}) { logAt(levelDebug, msg, kv...) }
+func logInfo(msg string, kv ...interface{})  { logAt(levelInfo, msg, kv...) }
+func logWarn(msg string, kv ...interface{})  { logAt(levelWarn, msg, kv...) }
+func logError(msg string, kv ...interface{}) { logAt(levelError, msg, kv...) }
+
+// logAt logs msg at level with fields given as alternating keys and
+// values.
+func logAt(level logLevel, msg string, kv ...interface{}) {
+	if level < logMin {
+		return
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	var b bytes.Buffer
+	if logJSON {
+		b.WriteString(`{"time":` + strconv.Quote(now) + `,"level":"` + level.String() + `","msg":`)
+		writeJSONValue(&b, msg)
+		for k := 0; k+1 < len(kv); k += 2 {
+			b.WriteString(",")
+			writeJSONValue(&b, fmt.Sprint(kv[k]))
+			b.WriteString(":")
+			writeJSONValue(&b, logValue(kv[k+1]))
+		}
+		b.WriteString("}\n")
+	} else {
+		fmt.Fprintf(&b, "%s %s %s", now, level, msg)
+		for k := 0; k+1 < len(kv); k += 2 {
+			s := fmt.Sprint(logValue(kv[k+1]))
+			if s == "" || strings.ContainsAny(s, " \"=\n") {
+				s = strconv.Quote(s)
+			}
+			fmt.Fprintf(&b, " %v=%s", kv[k], s)
+		}
+		b.WriteString("\n")
+	}
+	logMu.Lock()
+	defer logMu.Unlock()
+	logOut.Write(b.Bytes())
+}
+
+// logValue is how v is logged: errors and durations as text, the rest as
+// they are.
+func logValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.Round(time.Millisecond).String()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
+
+func writeJSONValue(b *bytes.Buffer, v interface{}) {
+	j, err := json.Marshal(v)
+	if err != nil {
+		j, _ = json.Marshal(fmt.Sprint(v))
+	}
+	b.Write(j)
+}
@@ -2,177 +2,976 @@ package main
 
 import (
 	"bytes"
-	"encoding/json"
+	"context"
 	"errors"
 	"flag"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"math"
 	"os"
-	"strconv"
+	"os/signal"
 	"strings"
 	"time"
 
-	"github.com/doneland/yquotes"
 	mailgun "github.com/mailgun/mailgun-go"
+	"github.com/shopspring/decimal"
 )
 
+func init() {
+	// keep money values as plain JSON numbers so existing configs round-trip
+	decimal.MarshalJSONWithoutQuotes = true
+}
+
 type config struct {
-	Investments []investment             `json:"investments"`
-	History     map[string][]performance `json:"history"` // history is keyed by the symbol
+	// WrittenBy is the version of stockstalk that last wrote the file and
+	// MinVersion the oldest version that may rewrite it without losing data.
+	WrittenBy  string `json:"written_by,omitempty"`
+	MinVersion string `json:"min_version,omitempty"`
+
+	Investments   []investment  `json:"investments"`
+	Notifications notifications `json:"notifications"`
+	// HistoryDedupe picks what recording a symbol again on the same day
+	// does: "keep-last" (default) replaces that day's entry, "keep-first"
+	// keeps it and "keep-all" adds another, which the report still shows
+	// once a day.
+	HistoryDedupe string `json:"history_dedupe,omitempty"`
+	// HistoryDir holds the per-symbol history files, relative to the config
+	// file. Defaults to the history directory in the user's data directory.
+	HistoryDir string `json:"history_dir,omitempty"`
+	// Backups is how many previous versions of the config are kept, as
+	// config.json.1 (the latest) to config.json.N. Defaults to 5.
+	Backups int `json:"backups,omitempty"`
+	// Retention thins out old history after each run.
+	Retention retention `json:"retention"`
+	// Language selects the message catalog for reports and CLI output,
+	// e.g. "hi" or "es". English is used when empty or unknown.
+	Language string `json:"language,omitempty"`
+	// Market dates the history by its exchange's calendar and time zone.
+	Market market `json:"market"`
+	// Watchlist holds symbols followed without a position.
+	Watchlist []watch `json:"watchlist,omitempty"`
+	// Report turns optional report sections on.
+	Report reportConfig `json:"report"`
+	// Telemetry is off unless an endpoint is set; see telemetryEvent for
+	// exactly what is sent.
+	Telemetry telemetryConfig `json:"telemetry"`
+	// Distributions are fund capital gains distributions, counted in each
+	// holding's return.
+	Distributions []distribution `json:"distributions,omitempty"`
+	// ExpenseRatios are annual fund expense ratios in percent by symbol,
+	// e.g. 0.03 for 0.03%. Funds not listed are looked up when the fees
+	// section is on.
+	ExpenseRatios map[string]float64 `json:"expense_ratios,omitempty"`
+	// Assets are held outside the brokerage account and count towards net
+	// worth, which is shown and recorded daily when any are set.
+	Assets []asset `json:"assets,omitempty"`
+	// Vests are upcoming RSU vests and lockup expiries, listed in the report
+	// and reminded of shortly before.
+	Vests []vest `json:"vests,omitempty"`
+	// Goals are amounts to have by a date, whose progress the report shows.
+	Goals []goal `json:"goals,omitempty"`
+	// Paper marks a paper-trading config; see ensurePaperConfig.
+	Paper bool `json:"paper,omitempty"`
+	// ReadOnly protects the config and its history from every command, as
+	// -read-only does.
+	ReadOnly bool `json:"read_only,omitempty"`
+	// ImportFormats add CSV column mappings for the import command, or
+	// override the built-in ones, by name.
+	ImportFormats map[string]importMapping `json:"import_formats,omitempty"`
+	// Sales are units sold with the sell command, kept for realized gains.
+	Sales []sale `json:"sales,omitempty"`
+	// AlertRules fire alerts on price moves and returns, sent apart from
+	// the report whenever a run finds one newly holding.
+	AlertRules []alertRule `json:"alert_rules,omitempty"`
+	// Schedule is when the daemon runs, as a cron expression in the
+	// market's time zone such as "0 18 * * 1-5". Days the market calendar
+	// has the exchange closed are skipped.
+	Schedule string `json:"schedule,omitempty"`
+	// Quotes selects where latest prices come from.
+	Quotes quotesConfig `json:"quotes"`
+	// Plugins are external quote sources and notifiers.
+	Plugins []plugin `json:"plugins,omitempty"`
+	// API holds the key of the REST API served by "serve".
+	API apiConfig `json:"api"`
+	// Allocation is the target allocation the report suggests rebalancing
+	// trades towards.
+	Allocation allocationConfig `json:"allocation"`
+	// Tax sets the holding period and rates of the tax command.
+	Tax taxConfig `json:"tax"`
+	// Actions are the splits and ticker changes recorded with the action
+	// command, already applied to the lots bought before them.
+	Actions []corporateAction `json:"actions,omitempty"`
+	// DetectSplits looks up splits of the held symbols on Yahoo on every
+	// report run and records the new ones.
+	DetectSplits bool `json:"detect_splits,omitempty"`
+	// Recurring are monthly investments the daemon adds lots for as they
+	// come due.
+	Recurring []recurringInvestment `json:"recurring,omitempty"`
+	// Sheets exports the portfolio to a Google Sheet on every run.
+	Sheets sheetsConfig `json:"sheets"`
+
+	// History is only read, from configs written before history moved out
+	// to HistoryDir; it is migrated on the next analysis run.
+	History map[string][]performance `json:"history,omitempty"` // history is keyed by the symbol
+
+	// scale is the factor amounts were multiplied by when anonymized.
+	scale decimal.Decimal
+	// fx holds this run's rate to the base currency of each currency
+	// investments are held in.
+	fx map[string]decimal.Decimal
+}
+
+type notifications struct {
+	Mailgun mailgunConfig `json:"mailgun"`
+	Alerts  alertConfig   `json:"alerts"`
+	// Frequency is how often the report is emailed: "daily" (default),
+	// "weekly", on the first run of each week from Monday, or "monthly", on
+	// the first run of each month. Weekly and monthly reports open with a
+	// summary of the period.
+	Frequency string `json:"frequency,omitempty"`
+	// Format of the report email: "text" (default) or "html", which adds
+	// an HTML part with a sparkline per holding to the plain text.
+	Format string `json:"format,omitempty"`
+	// Channels are where reports and alerts go. With none, the report is
+	// emailed by Mailgun to the usual recipients.
+	Channels []channelConfig `json:"channels,omitempty"`
+}
+
+// alertConfig is where the daemon reports its own failures, kept apart from
+// the report recipients so a dead job does not go unnoticed.
+type alertConfig struct {
+	To []string `json:"to,omitempty"`
+	// AfterFailures is how many runs in a row must fail before alerting.
+	// Panics alert straight away. Defaults to 3.
+	AfterFailures int `json:"after_failures,omitempty"`
+}
+
+// mailgunConfig holds the Mailgun account. Each key may be given inline,
+// with ${ENV_VAR} references, through its *_file variant, or left out of the
+// config entirely and stored in the OS keyring with "auth set". The
+// MAILGUN_* environment variables override any of them.
+type mailgunConfig struct {
+	APIKey           string `json:"api_key,omitempty"`
+	APIKeyFile       string `json:"api_key_file,omitempty"`
+	PublicAPIKey     string `json:"public_api_key,omitempty"`
+	PublicAPIKeyFile string `json:"public_api_key_file,omitempty"`
+	Domain           string `json:"domain,omitempty"`
+	From             string `json:"from,omitempty"`
+	// To are the report recipients when no channels are configured, and
+	// of a mailgun channel without its own.
+	To []string `json:"to,omitempty"`
 }
 
 type performance struct {
-	Symbol           string    `json:"symbol"`
-	Price            float64   `json:"price"`
-	CompoundInterest float64   `json:"compound_interest"`
-	Date             time.Time `json:"date"`
+	Symbol           string          `json:"symbol"`
+	Price            decimal.Decimal `json:"price"`
+	CompoundInterest float64         `json:"compound_interest"`
+	Date             time.Time       `json:"date"`
+	// PriceType is the price captured: priceClose or priceLast, an
+	// intraday price. Empty in entries recorded before it was kept.
+	PriceType string `json:"price_type,omitempty"`
+	// Provider is the quote provider that supplied the price, which is a
+	// fallback when the configured one failed. Empty in entries recorded
+	// before it was kept and in those priced from history.
+	Provider string `json:"provider,omitempty"`
 }
 
 type investment struct {
-	Symbol string    `json:"symbol"`
-	Date   time.Time `json:"date"`
-	Total  float64   `json:"total"`
-	Units  float64   `json:"units"`
+	Symbol string          `json:"symbol"`
+	Date   time.Time       `json:"date"`
+	Total  decimal.Decimal `json:"total"`
+	Units  decimal.Decimal `json:"units"`
+	// Provider names the quote plugin to price this investment with, or a
+	// built-in provider: "amfi" for Indian mutual funds, whose symbol is
+	// then the scheme code, or "crypto" for coins such as BTC-USD. The
+	// quote provider is used when empty.
+	Provider string `json:"provider,omitempty"`
+	// Account is where the lot is held, e.g. "brokerage" or "IRA". Lots
+	// move between accounts with the transfer command.
+	Account string `json:"account,omitempty"`
+	// Portfolio is the named portfolio the lot belongs to, e.g. "joint",
+	// selected with -portfolio. Each portfolio keeps its own history.
+	Portfolio string `json:"portfolio,omitempty"`
+	// BuyBelow and SellAbove are personal price targets: the report shows
+	// the distance to them and an alert goes out when the price crosses one.
+	BuyBelow  *decimal.Decimal `json:"buy_below,omitempty"`
+	SellAbove *decimal.Decimal `json:"sell_above,omitempty"`
+	// Dividends are the cash dividends paid on the lot, recorded with the
+	// dividend command. The compound interest assumes they were reinvested.
+	Dividends []dividend `json:"dividends,omitempty"`
+	// Currency is what the lot was bought and is quoted in, e.g. "INR",
+	// when it is not the report's base currency.
+	Currency string `json:"currency,omitempty"`
+	// Inactive is set when quotes for the symbol keep failing; the lot is
+	// then left out of pricing and listed apart in the report.
+	Inactive *inactivity `json:"inactive,omitempty"`
+	// Tags group lots across symbols, e.g. "dividend" or "speculative":
+	// the report subtotals each and report -tag covers only one.
+	Tags []string `json:"tags,omitempty"`
+	// Note is free text kept with the lot, shown in the report.
+	Note string `json:"note,omitempty"`
+	// Fees and TaxesPaid are what buying the lot cost on top of Total, in
+	// its currency, such as a commission or stamp duty. They are part of
+	// its cost basis, so they lower its return.
+	Fees      *decimal.Decimal `json:"fees,omitempty"`
+	TaxesPaid *decimal.Decimal `json:"taxes_paid,omitempty"`
 }
 
+// perr prints err for the user, or logs it when the log is JSON so that
+// every line of stderr parses.
 func perr(err error) {
-	if err != nil {
-		fmt.Fprintln(os.Stderr, err.Error())
+	if err == nil {
+		return
+	}
+	if logJSON {
+		logError(err.Error())
+		return
 	}
+	fmt.Fprintln(os.Stderr, err.Error())
 }
 
 func main() {
-	var add = flag.String("add", "", "set an investment as \"symbol,date(mm/dd/yy),total(float64),units(float64)\" takes priority")
-	var config = flag.String("config", "config.json", "file to set config at")
+	var config = flag.String("config", defaultConfigFile(), "file to set config at")
+	var ro = flag.Bool("read-only", false, "never write the config or history or send notifications")
+	var paper = flag.Bool("paper", false, "use the paper-trading portfolio kept next to the config")
+	var provider = flag.String("provider", "", "quote provider: yahoo, iex or alphavantage; overrides the config")
+	var fresh = flag.Bool("no-cache", false, "fetch every quote afresh instead of reusing cached ones")
+	var portfolio = flag.String("portfolio", "", "only report on and add to this portfolio; \"all\" for every one")
+	var level = flag.String("log-level", "warn", "least severe messages to log: debug, info, warn or error")
+	var jsonLog = flag.Bool("log-json", false, "log JSON objects instead of text lines")
+	var profile = flag.String("profile", "", "write CPU and heap profiles to this directory and print phase timings")
+	flag.DurationVar(&runTimeout, "timeout", 0, "cancel a run of the analysis taking longer than this, e.g. 5m; 0 for no limit")
+	flag.Usage = usage
 	flag.Parse()
-
-	if *add != "" {
-		fmt.Println("adding", *add)
-		perr(addInvestment(*add, *config))
+	readOnly = *ro
+	quoteSource = *provider
+	noCache = *fresh
+	portfolioName = *portfolio
+	logJSON = *jsonLog
+	var err error
+	if logMin, err = parseLogLevel(*level); err != nil {
+		perr(err)
 		return
 	}
+	if name := selectedPortfolio(); name != "" {
+		if err := validPortfolio(name); err != nil {
+			perr(err)
+			return
+		}
+	}
+
+	if *profile != "" {
+		stop, err := startProfile(*profile)
+		if err != nil {
+			perr(err)
+			return
+		}
+		defer func() { perr(stop()) }()
+	}
+
+	if *paper {
+		file, err := ensurePaperConfig(*config)
+		if err != nil {
+			perr(err)
+			return
+		}
+		*config = file
+	}
+
+	name, args := "report", flag.Args()
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	ctx, cancel := interruptible()
+	defer cancel()
+	perr(runCommand(ctx, name, *config, args))
+}
+
+// runTimeout is set by -timeout: how long a run of the analysis, by the
+// report or each one of the daemon, may take. Unlimited when zero.
+var runTimeout time.Duration
 
-	perr(analysis(*config))
+// interruptible returns a context cancelled by the first SIGTERM or
+// interrupt, which stops requests in flight instead of waiting on them. A
+// second one kills the process as usual.
+func interruptible() (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := make(chan os.Signal, 1)
+	notifyStop(c)
+	go func() {
+		select {
+		case <-c:
+			signal.Stop(c)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
+// withRunTimeout bounds a run of the analysis by -timeout.
+func withRunTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if runTimeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, runTimeout)
+}
+
+// runError explains err from a run with ctx that ran out of time.
+func runError(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("run cancelled after -timeout %v: %v", runTimeout, err)
+	}
+	return err
 }
 
 const secondsPerYear = 365.25 * 24 * 60 * 60 // leap year hack
 
-func currentRate(i investment, price float64) float64 {
-	principal := i.Total / i.Units
-	d := time.Now().Sub(i.Date).Seconds() / secondsPerYear
-	r := 100 * (math.Pow(price/principal, 1/d) - 1)
+// currentRate is the annualised return, in percent, of i at price. A lot
+// with no cost has none and rates zero.
+func currentRate(i investment, price decimal.Decimal) float64 {
+	if !i.basis().IsPositive() || !i.Units.IsPositive() {
+		return 0
+	}
+	principal := i.basis().Div(i.Units)
+	d := clock().Sub(i.Date).Seconds() / secondsPerYear
+	r := 100 * (math.Pow(price.Div(principal).InexactFloat64(), 1/d) - 1)
 	return r
 }
 
-func analysis(confFile string) error {
+func analysis(ctx context.Context, confFile string, opts runOptions) error {
+	ctx, cancel := withRunTimeout(ctx)
+	defer cancel()
+	start := time.Now()
+	done := prof.phase("config load")
 	conf, err := parseConfig(confFile)
+	done()
+	if err == nil {
+		err = conf.validate()
+	}
 	if err != nil {
 		return err
 	}
-	if conf.History == nil {
-		conf.History = make(map[string][]performance)
+	var failures []telemetryFailure
+	opts.failures = &failures
+	err = runError(ctx, runAnalysis(ctx, confFile, conf, opts))
+	sendTelemetry(ctx, conf, time.Since(start), err, failures)
+	return err
+}
+
+type runOptions struct {
+	persist   bool // record history and report state
+	force     bool // send the report even if it already went out today
+	asOf      bool // clock is in the past: price from history and only print
+	anonymize bool // scale amounts by a hidden factor and only print
+	// baseCurrency, format and benchmark override the report's base
+	// currency, email format and benchmark
+	baseCurrency, format, benchmark string
+	// output is what to print: the text report, or json or csv; or pdf,
+	// written to out
+	output, out string
+	// priceMode overrides the config's quotes.price_mode
+	priceMode string
+	// dedupe overrides the config's history_dedupe
+	dedupe string
+	// chart prints terminal charts of the history; the report sent has none
+	chart bool
+	// tag limits the report to the lots with this tag, and only prints it
+	tag string
+	// failures, when set, is given the quotes that failed, for telemetry
+	failures *[]telemetryFailure
+}
+
+// runAnalysis fetches prices for conf, records them in the history store,
+// sends any alerts that fired and sends the report. Rerunning on the same
+// day updates that day's history and checks the alerts again, but does not
+// send the report again unless forced.
+func runAnalysis(ctx context.Context, confFile string, conf config, opts runOptions) error {
+	// -dedupe is for this run only, so it stays out of conf, which may be
+	// written back
+	dedupe := conf.HistoryDedupe
+	if opts.dedupe != "" {
+		dedupe = opts.dedupe
 	}
-	for _, i := range conf.Investments {
-		price, err := yquotes.GetPrice(i.Symbol)
+	policy, err := historyPolicy(dedupe)
+	if err != nil {
+		return err
+	}
+	if opts.anonymize {
+		conf = anonymize(conf)
+	}
+	if readOnly || dryRun {
+		opts.persist = false
+	}
+	now, err := conf.Market.date(clock())
+	if err != nil {
+		return err
+	}
+	store := newHistoryStore(confFile, conf)
+	// legacy history is of every portfolio, so it migrates only to the
+	// combined store
+	if opts.persist && len(conf.History) > 0 && selectedPortfolio() == "" {
+		if err := store.migrate(conf.History, policy); err != nil {
+			return err
+		}
+		conf.History = nil
+		if err := writeConfig(confFile, conf); err != nil {
+			return err
+		}
+	}
+	if dryRun && len(conf.History) > 0 {
+		fmt.Fprintf(os.Stderr, conf.tr("would move the history of %d symbols out of the config")+"\n", len(conf.History))
+	}
+	if opts.persist && conf.DetectSplits && !opts.asOf {
+		found, err := detectSplits(ctx, confFile, &conf)
+		if len(found) > 0 {
+			if err := saveActions(confFile, conf, found); err != nil {
+				return err
+			}
+		}
+		for _, a := range found {
+			fmt.Fprintf(os.Stderr, conf.tr("recorded %s")+"\n", a)
+		}
+		// the report goes on with the splits known so far
+		perr(err)
+	}
+	if conf, err = inPortfolio(conf); err != nil {
+		return err
+	}
+	if opts.tag != "" {
+		if conf, err = withTag(conf, opts.tag); err != nil {
+			return err
+		}
+	}
+	if opts.baseCurrency != "" {
+		conf.Report.BaseCurrency = opts.baseCurrency
+	}
+	if opts.priceMode != "" {
+		conf.Quotes.PriceMode = opts.priceMode
+	}
+	if opts.benchmark != "" {
+		conf.Report.Benchmark = strings.ToUpper(opts.benchmark)
+	}
+	if opts.format != "" {
+		conf.Notifications.Format = opts.format
+	}
+	if opts.format != "" || opts.priceMode != "" {
+		if err := conf.validate(); err != nil {
+			return err
+		}
+	}
+	if !opts.asOf && !opts.anonymize && !readOnly {
+		if err := checkCredentials(conf); err != nil {
+			return err
+		}
+	}
+	if conf.fx, err = fxRates(ctx, conf, store, now, opts.asOf); err != nil {
+		return err
+	}
+	done := prof.phase("quotes")
+	prices := fetchPrices(ctx, conf, store, now, opts.asOf)
+	done()
+	// a cancelled run records nothing rather than a history of failures
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if opts.failures != nil && !opts.asOf {
+		*opts.failures = quoteFailures(conf, prices)
+	}
+	if opts.persist && !opts.asOf {
+		inactive, err := trackFailures(confFile, &conf, store, prices, now)
 		if err != nil {
 			return err
 		}
-		r := currentRate(i, price.Last)
+		for _, s := range inactive {
+			fmt.Fprintf(os.Stderr, conf.tr("%s keeps failing to be priced, marked inactive")+"\n", s)
+		}
+	}
+	latest := make(map[string]performance)
+	previous := make(map[string]decimal.Decimal)
+	failed := make(map[string]error)
+	// the combined view also records each portfolio's own history
+	portfolios := make(map[string]map[string]performance)
+	for _, i := range conf.Investments {
+		if i.Date.After(now) || i.Inactive != nil {
+			continue
+		}
+		q := prices[priceKey{i.Symbol, i.Provider}]
+		if q.err != nil {
+			failed[i.Symbol] = q.err
+			continue
+		}
+		if q.previous.IsPositive() {
+			previous[i.Symbol] = q.previous
+		}
+		price, date, priceType := q.price, now, ""
+		if !opts.asOf {
+			if price, date, priceType, err = conf.captured(q, now); err != nil {
+				return err
+			}
+		}
+		done = prof.phase("analytics")
+		units, err := reinvestedUnits(ctx, store, i, now)
+		done()
+		if err != nil {
+			failed[i.Symbol] = err
+			continue
+		}
+		// the total return prices the original units as the reinvested ones
+		total := price.Mul(units).Div(i.Units)
+		r := currentRate(i, total.Add(distributedPerShare(conf, i, now)))
 		perf := performance{
 			Symbol:           i.Symbol,
-			Date:             time.Now(),
+			Date:             date,
 			CompoundInterest: r,
-			Price:            price.Last,
+			Price:            price,
+			PriceType:        priceType,
+			Provider:         q.provider,
+		}
+		latest[i.Symbol] = perf
+		if i.Portfolio != "" && selectedPortfolio() == "" {
+			if portfolios[i.Portfolio] == nil {
+				portfolios[i.Portfolio] = make(map[string]performance)
+			}
+			portfolios[i.Portfolio][i.Symbol] = perf
+		}
+		if opts.persist {
+			if err := store.record(perf, policy); err != nil {
+				return err
+			}
+		}
+	}
+	for _, s := range heldSymbols(conf) {
+		if perf, ok := latest[s]; ok {
+			wouldRecord(conf, "", perf)
+		}
+	}
+
+	if len(conf.Assets) > 0 {
+		perf := performance{Symbol: netWorthSymbol, Date: now, Price: netWorth(conf, latest)}
+		if opts.persist {
+			if err := store.record(perf, policy); err != nil {
+				return err
+			}
+		}
+		wouldRecord(conf, "", perf)
+	}
+	for _, name := range portfolioNames(conf) {
+		for _, s := range heldSymbols(conf) {
+			perf, ok := portfolios[name][s]
+			if !ok {
+				continue
+			}
+			if opts.persist {
+				if err := store.portfolio(name).record(perf, policy); err != nil {
+					return err
+				}
+			}
+			wouldRecord(conf, name, perf)
+		}
+	}
+	if opts.persist && !conf.Retention.Manual {
+		done = prof.phase("compact")
+		err := store.compactAll(nil, conf, policy, now)
+		for name := range portfolios {
+			if err == nil {
+				err = store.portfolio(name).compactAll(nil, conf, policy, now)
+			}
+		}
+		done()
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(latest) == 0 && len(failed) > 0 {
+		var bu bytes.Buffer
+		printFailures(&bu, conf, failed)
+		return errors.New(strings.TrimSpace(bu.String()))
+	}
+
+	done = prof.phase("render")
+	var bu bytes.Buffer
+	var fundamentals map[string]summaryDetail
+	if conf.Report.Fundamentals && !opts.asOf {
+		fundamentals = fetchFundamentals(ctx, conf, store)
+	}
+	var sections bytes.Buffer
+	if !opts.asOf {
+		printSections(ctx, &sections, conf, store, latest, now)
+	}
+	printFailures(&sections, conf, failed)
+	data, err := newReportData(ctx, conf, store, latest, fundamentals, sections.String(), clock())
+	if err == nil {
+		err = printAnalysis(&bu, confFile, conf, data)
+	}
+	var html string
+	if err == nil && conf.Notifications.Format == "html" && !opts.asOf {
+		html, err = renderHTML(confFile, conf, data)
+	}
+	done()
+	if err != nil {
+		return err
+	}
+	if opts.output == "json" || opts.output == "csv" {
+		err = printOutput(os.Stdout, opts.output, conf, store, latest, failed, now)
+	} else if opts.output == "pdf" {
+		err = writePDFFile(opts.out, conf, data)
+		if err == nil {
+			fmt.Printf(conf.tr("wrote %s")+"\n", opts.out)
 		}
-		hPerf := conf.History[i.Symbol]
-		hPerf = append(hPerf, perf)
-		conf.History[i.Symbol] = hPerf
+	} else if opts.chart {
+		err = printAnalysis(os.Stdout, confFile, conf, withCharts(conf, data))
+	} else {
+		_, err = os.Stdout.Write(bu.Bytes())
 	}
-	err = writeConfig(confFile, conf)
 	if err != nil {
 		return err
 	}
+	// the sheet is of the whole portfolio, so filtered runs leave it be
+	if opts.persist && conf.Sheets.SpreadsheetID != "" && selectedPortfolio() == "" {
+		if err := exportSheets(ctx, conf, store, latest, now); err != nil {
+			logWarn("sheets export failed", "error", err)
+		}
+	}
+	if opts.asOf || opts.anonymize || opts.tag != "" || readOnly {
+		return nil
+	}
 
-	printAnalysis(os.Stdout, conf)
-	var bu bytes.Buffer
-	printAnalysis(&bu, conf)
-	b, err := ioutil.ReadAll(&bu)
+	defer prof.phase("notify")()
+	// Alerts are checked on every run; the report goes out once a day.
+	active := append(targetAlerts(conf, latest), vestAlerts(conf, now)...)
+	active = append(active, ruleAlerts(conf, store, latest, previous, now)...)
+	due, err := fireAlerts(store, active, now, opts.persist)
 	if err != nil {
 		return err
 	}
-	return sendEmail(string(b))
+	if err := sendAlerts(ctx, conf, due, now); err != nil {
+		return err
+	}
+	if !opts.force {
+		frequency := conf.Notifications.frequency()
+		sent, err := store.reportedIn(now, frequency)
+		if err != nil {
+			return err
+		}
+		if sent && frequency == frequencyDaily {
+			fmt.Fprintln(os.Stderr, conf.tr("report already sent today, use -force to send it again"))
+			return nil
+		}
+		if sent {
+			fmt.Fprintf(os.Stderr, conf.tr("%s report already sent, use -force to send it again")+"\n", conf.tr(frequency))
+			return nil
+		}
+	}
+	subject := fmt.Sprintf(conf.tr("Investment Report - %s"), now.Format(humanDate))
+	if name := selectedPortfolio(); name != "" {
+		subject += " [" + name + "]"
+	}
+	if err := notify(ctx, conf, subject, bu.String(), html); err != nil {
+		return err
+	}
+	if opts.persist {
+		return store.setReported(now)
+	}
+	return nil
 }
 
-const publicAPIKey = ""
-
-const apiKey = ""
+// wouldRecord prints, in a dry run, the entry a run would record in the
+// history of the named portfolio, or the combined one.
+func wouldRecord(conf config, portfolio string, p performance) {
+	if !dryRun {
+		return
+	}
+	if portfolio != "" {
+		portfolio = " [" + portfolio + "]"
+	}
+	fmt.Fprintf(os.Stderr, conf.tr("would record %s%s %s at %s")+"\n", p.Symbol, portfolio, p.Price.StringFixed(2), p.Date.Format(humanDate))
+}
 
-func sendEmail(body string) error {
-	mg := mailgun.NewMailgun("sheki.in", apiKey, publicAPIKey)
-	resp, _, err := mg.Send(mg.NewMessage(
-		/* From */ "investment@sheki.in",
-		/* Subject */ fmt.Sprintf("Investment Report - %s", time.Now().Format(humanDate)),
-		/* Body */ body,
-		/* To */ "abhishek.kona@gmail.com", "abhishek.kona@sheki.in",
-	))
-	fmt.Println(resp)
-	return err
+// notify sends a message to every notification channel and notify plugin.
+// A channel that fails does not keep the message from the others.
+func notify(ctx context.Context, conf config, subject, body, html string) error {
+	if conf.Paper {
+		subject = "[" + conf.tr("paper") + "] " + subject
+	}
+	ns, err := newNotifiers(conf)
+	if err != nil {
+		return err
+	}
+	names := notifierNames(conf)
+	if dryRun {
+		fmt.Fprintf(os.Stderr, conf.tr("would send %q to %s")+"\n", subject, strings.Join(names, ", "))
+		return nil
+	}
+	var failed []string
+	for k, n := range ns {
+		start := time.Now()
+		if err := n.notify(ctx, subject, body, html); err != nil {
+			logError("notification failed", "channel", names[k], "subject", subject, "duration", time.Since(start), "error", err)
+			failed = append(failed, err.Error())
+			continue
+		}
+		logInfo("notification sent", "channel", names[k], "subject", subject, "duration", time.Since(start))
+	}
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return nil
 }
 
-const humanDate = "02-Jan-06"
+// getPrice returns the latest price of i, from its quote plugin if it names
+// one and from the configured quote provider otherwise.
+func getPrice(ctx context.Context, conf config, i investment) (decimal.Decimal, error) {
+	q, err := getQuote(ctx, conf, i)
+	return q.Price, err
+}
 
-func printAnalysis(writer io.Writer, conf config) {
-	for _, v := range conf.Investments {
-		history := conf.History[v.Symbol]
-		fmt.Fprintf(writer, "===%s %.2f %s ===\n", v.Symbol, v.Total, v.Date.Format(humanDate))
-		if history == nil {
-			continue
+// getQuote is getPrice with the rest of the quote. A symbol without a
+// plugin that the quote provider fails to price is tried with each fallback
+// in turn; the quote names the provider that priced it.
+func getQuote(ctx context.Context, conf config, i investment) (quote, error) {
+	if b, ok := builtinProviders[i.Provider]; ok {
+		return fetchQuote(ctx, b, i.Provider, i.Symbol)
+	} else if i.Provider != "" {
+		p, err := findPlugin(conf.Plugins, i.Provider, pluginQuote)
+		if err != nil {
+			return quote{}, err
 		}
-		seen := make(map[string]struct{})
-		for i := len(history) - 1; i >= 0; i-- {
-			h := history[i]
-			dateStr := h.Date.Format(humanDate)
-			_, ok := seen[dateStr]
-			if ok {
-				continue
+		return fetchQuote(ctx, pluginProvider{p}, i.Provider, i.Symbol)
+	}
+	var errs []error
+	for k, name := range quoteChain(conf) {
+		qp, err := newQuoteProvider(conf, name)
+		if err == nil {
+			var q quote
+			if q, err = fetchQuote(ctx, qp, name, i.Symbol); err == nil {
+				if k > 0 {
+					logInfo("quote failed over", "symbol", i.Symbol, "provider", name)
+				}
+				return q, nil
 			}
-			fmt.Fprintf(writer, "%s %.2f %%\n", dateStr, h.CompoundInterest)
-			seen[dateStr] = struct{}{}
+		} else {
+			logWarn("quote provider unusable", "provider", name, "error", err)
 		}
-		fmt.Fprintf(writer, "\n")
+		errs = append(errs, err)
+	}
+	if len(errs) == 1 {
+		return quote{}, errs[0]
+	}
+	// the symbol is only unknown for good if every provider says so
+	msgs := make([]string, len(errs))
+	permanent := true
+	for k, err := range errs {
+		var perm permanentError
+		permanent = permanent && errors.As(err, &perm)
+		msgs[k] = err.Error()
+	}
+	err := errors.New(strings.Join(msgs, "; "))
+	if permanent {
+		return quote{}, permanentError{err}
 	}
+	return quote{}, err
 }
 
-func parseConfig(file string) (config, error) {
-	f, err := os.Open(file)
+// fetchQuote prices symbol with qp, retrying as configured.
+func fetchQuote(ctx context.Context, qp quoteProvider, name, symbol string) (quote, error) {
+	var q quote
+	start := time.Now()
+	err := fetchRetry.do(ctx, name, func(ctx context.Context) (err error) {
+		q, err = qp.price(ctx, symbol)
+		return err
+	})
 	if err != nil {
-		if os.IsNotExist(err) {
-			return config{}, nil
+		logWarn("quote failed", "symbol", symbol, "provider", name, "duration", time.Since(start), "error", err)
+		return q, err
+	}
+	logInfo("quote fetched", "symbol", symbol, "provider", name, "price", q.Price, "duration", time.Since(start))
+	q.Provider = name
+	return q, nil
+}
+
+// providerName names where the price of i comes from: its quote plugin or
+// the quote provider.
+func providerName(conf config, i investment) string {
+	switch {
+	case i.Provider != "":
+		return i.Provider
+	case quoteSource != "":
+		return quoteSource
+	case conf.Quotes.Provider != "":
+		return conf.Quotes.Provider
+	}
+	return "yahoo"
+}
+
+// historicalPrice returns the last price of symbol on or before t, from the
+// history store if it has one for that day and from Yahoo otherwise.
+func historicalPrice(ctx context.Context, store historyStore, symbol string, t time.Time) (decimal.Decimal, error) {
+	var last *performance
+	err := store.each(symbol, func(p performance) error {
+		if !p.Date.After(t) {
+			last = &p
+		}
+		return nil
+	})
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+	if last != nil && last.Date.Format(isoDate) == t.Format(isoDate) {
+		return last.Price, nil
+	}
+	// a week back covers weekends and holidays
+	prices, err := dailyHistory(ctx, store, symbol, t.AddDate(0, 0, -7), t)
+	if err != nil {
+		return decimal.Decimal{}, err
+	}
+	if len(prices) == 0 {
+		if last != nil {
+			return last.Price, nil
+		}
+		return decimal.Decimal{}, fmt.Errorf("no price for %s on or before %s", symbol, t.Format(isoDate))
+	}
+	latest := prices[0]
+	for _, p := range prices[1:] {
+		if p.Date.After(latest.Date) {
+			latest = p
 		}
-		return config{}, err
 	}
-	defer f.Close()
-	var c config
-	err = json.NewDecoder(f).Decode(&c)
-	return c, err
+	return decimal.NewFromFloat(latest.Close), nil
 }
 
-func writeConfig(file string, conf config) error {
-	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0777)
+// sendEmail sends through the Mailgun account in mc, to its recipients
+// when to is empty.
+func sendEmail(ctx context.Context, mc mailgunConfig, subject, body, html string, to ...string) error {
+	if readOnly {
+		return errReadOnly
+	}
+	a, err := mc.account()
+	if err != nil {
+		return err
+	}
+	if missing := a.missing(len(to) == 0); len(missing) > 0 {
+		return missingCredentials(missing)
+	}
+	if len(to) == 0 {
+		to = a.to
+	}
+	mg := mailgun.NewMailgun(a.domain, a.apiKey, a.publicAPIKey)
+	m := mg.NewMessage(
+		/* From */ a.from,
+		/* Subject */ subject,
+		/* Body */ body,
+		/* To */ to...,
+	)
+	if html != "" {
+		m.SetHtml(html)
+	}
+	resp, err := withContext(ctx, func() (string, error) {
+		resp, _, err := mg.Send(m)
+		return resp, err
+	})
+	fmt.Println(resp)
+	return err
+}
+
+const humanDate = "02-Jan-06"
+
+// printAnalysis writes the plain text report of data, with the configured
+// template or by default each holding with its history, newest first,
+// followed by the optional sections.
+func printAnalysis(writer io.Writer, confFile string, conf config, data reportData) error {
+	t, err := textTemplate(confFile, conf)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-	return json.NewEncoder(f).Encode(conf)
+	return t.Execute(writer, data)
+}
+
+// lotHistory returns the history of the symbol of v recorded up to now,
+// oldest first, including this run's entry from latest.
+func lotHistory(store historyStore, v investment, latest map[string]performance, now time.Time) ([]performance, error) {
+	var history []performance
+	err := store.each(v.Symbol, func(p performance) error {
+		if !p.Date.After(now) {
+			history = append(history, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if p, ok := latest[v.Symbol]; ok {
+		history = append(history, p)
+		history = dedupeHistory(history, keepLast)
+	}
+	return history, nil
+}
+
+// lotHeading names a lot: symbol, cost, date bought and account.
+func lotHeading(v investment) string {
+	account := ""
+	if v.Account != "" {
+		account = " [" + v.Account + "]"
+	}
+	currency := ""
+	if v.Currency != "" {
+		currency = " " + v.Currency
+	}
+	return fmt.Sprintf("%s %s%s %s%s", v.Symbol, v.Total.StringFixed(2), currency, v.Date.Format(humanDate), account)
+}
+
+// lotDetails are the lines shown under a lot's heading before its history,
+// which is oldest first.
+func lotDetails(ctx context.Context, conf config, store historyStore, v investment, history []performance, latest map[string]performance, fundamentals map[string]summaryDetail, now time.Time) []string {
+	var lines []string
+	if p, ok := latest[v.Symbol]; ok && v.Currency != "" && v.Currency != conf.baseCurrency() {
+		lines = append(lines, baseLine(ctx, conf, store, v, p))
+	}
+	if p, ok := latest[v.Symbol]; ok {
+		if line := targetLine(conf, v, p.Price); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if stats, ok := lotStats(v, history, fundamentals, now); ok {
+		lines = append(lines, statsLine(conf, stats))
+	}
+	if d := dividendsReceived(v, now); d.IsPositive() {
+		line := fmt.Sprintf("%s %s", conf.tr("dividends"), d.StringFixed(2))
+		if p, ok := latest[v.Symbol]; ok {
+			line += fmt.Sprintf(" | %s %.2f %%", conf.tr("price-only return"), currentRate(v, p.Price))
+		}
+		lines = append(lines, line)
+	}
+	if d := distributedPerShare(conf, v, now); d.IsPositive() {
+		lines = append(lines, fmt.Sprintf("%s %s", conf.tr("capital gains distributions"), d.Mul(v.Units).StringFixed(2)))
+	}
+	if f, ok := fundamentals[v.Symbol]; ok {
+		lines = append(lines, fmt.Sprintf("P/E %.1f | %s %s | %s %.2f%% | beta %.2f", f.TrailingPE.Raw,
+			conf.tr("market cap"), humanizeNumber(f.MarketCap.Raw), conf.tr("dividend yield"), 100*f.DividendYield.Raw, f.Beta.Raw))
+	}
+	if v.Fees != nil || v.TaxesPaid != nil {
+		var parts []string
+		if v.Fees != nil {
+			parts = append(parts, fmt.Sprintf("%s %s", conf.tr("fees"), v.Fees.StringFixed(2)))
+		}
+		if v.TaxesPaid != nil {
+			parts = append(parts, fmt.Sprintf("%s %s", conf.tr("taxes paid"), v.TaxesPaid.StringFixed(2)))
+		}
+		parts = append(parts, fmt.Sprintf("%s %s", conf.tr("cost basis"), v.basis().StringFixed(2)))
+		lines = append(lines, strings.Join(parts, " | "))
+	}
+	if line := tagLine(v); line != "" {
+		lines = append(lines, line)
+	}
+	return lines
 }
 
 const mmddyy = "1/2/2006"
 
 func parseInvestmentLine(iStr string) (investment, error) {
 	arr := strings.Split(iStr, ",")
-	if len(arr) != 4 {
+	if len(arr) < 4 || len(arr) > 6 {
 		return investment{}, errors.New("investment line format incorrect")
 	}
 	t, err := time.Parse(mmddyy, arr[1])
@@ -180,28 +979,88 @@ func parseInvestmentLine(iStr string) (investment, error) {
 		return investment{}, err
 	}
 
-	total, err := strconv.ParseFloat(arr[2], 64)
+	total, err := decimal.NewFromString(arr[2])
 	if err != nil {
 		return investment{}, err
 	}
-	units, err := strconv.ParseFloat(arr[3], 64)
-	return investment{
+	units, err := decimal.NewFromString(arr[3])
+	i := investment{
 		Symbol: arr[0],
 		Date:   t,
 		Total:  total,
 		Units:  units,
-	}, err
+	}
+	if len(arr) >= 5 {
+		i.Account = arr[4]
+	}
+	if len(arr) == 6 {
+		i.Currency = strings.ToUpper(arr[5])
+	}
+	return i, err
 }
 
-func addInvestment(iStr string, confFile string) error {
+// addInvestment handles "add", pricing the investment with provider when
+// it is not empty. A symbol may also name a built-in provider as a prefix,
+// as in "crypto:BTC-USD". extra holds the fields the line does not carry:
+// tags, note, fees and taxes paid.
+func addInvestment(iStr string, confFile string, provider string, extra investment) error {
 	conf, err := parseConfig(confFile)
 	if err != nil {
 		return err
 	}
+	fmt.Printf(conf.tr("adding %s")+"\n", iStr)
 	i, err := parseInvestmentLine(iStr)
 	if err != nil {
 		return err
 	}
+	i.Tags, i.Note, i.Fees, i.TaxesPaid = extra.Tags, extra.Note, extra.Fees, extra.TaxesPaid
+	if k := strings.Index(i.Symbol, ":"); k > 0 {
+		if _, ok := builtinProviders[i.Symbol[:k]]; ok && (provider == "" || provider == i.Symbol[:k]) {
+			provider, i.Symbol = i.Symbol[:k], i.Symbol[k+1:]
+		}
+	}
+	if provider != "" {
+		b, ok := builtinProviders[provider]
+		if !ok {
+			if _, err := findPlugin(conf.Plugins, provider, pluginQuote); err != nil {
+				return err
+			}
+		}
+		i.Provider = provider
+		if ok {
+			c := b.currency(i.Symbol)
+			if c == "" {
+				return fmt.Errorf("%s cannot price %s", provider, i.Symbol)
+			}
+			if i.Currency == "" && c != conf.baseCurrency() {
+				i.Currency = c
+			}
+		}
+	}
+	return appendInvestment(confFile, i)
+}
+
+// appendInvestment adds i to the investments in confFile.
+func appendInvestment(confFile string, i investment) error {
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	return insertInvestment(confFile, conf, i)
+}
+
+// insertInvestment adds i to conf, read from confFile, and writes it back.
+func insertInvestment(confFile string, conf config, i investment) error {
+	if err := i.checkAmounts(); err != nil {
+		return err
+	}
+	if i.Portfolio == "" {
+		i.Portfolio = selectedPortfolio()
+	}
+	conf.adjustLot(&i)
 	conf.Investments = append(conf.Investments, i)
-	return writeConfig(confFile, conf)
+	if err := writeConfig(confFile, conf); err != nil {
+		return err
+	}
+	return appendAudit(confFile, auditEntry{Action: "add", New: &i})
 }
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const isoDate = "2006-01-02"
+
+// market describes the exchange whose calendar dates the history. With no
+// calendar every day is a trading day and runs are stamped with the local
+// time, as before.
+type market struct {
+	Timezone string   `json:"timezone,omitempty"` // IANA name, e.g. America/New_York
+	Calendar string   `json:"calendar,omitempty"` // "NYSE" or "weekdays"
+	Close    string   `json:"close,omitempty"`    // closing time in Timezone, 15:04; defaults to 16:00
+	Holidays []string `json:"holidays,omitempty"` // extra closures, 2006-01-02
+}
+
+func (m market) validate() error {
+	switch m.Calendar {
+	case "", "weekdays", "NYSE":
+	default:
+		return fmt.Errorf("unknown market calendar %q, want NYSE or weekdays", m.Calendar)
+	}
+	if _, err := m.location(); err != nil {
+		return err
+	}
+	if _, _, err := m.closeTime(); err != nil {
+		return err
+	}
+	for _, h := range m.Holidays {
+		if _, err := time.Parse(isoDate, h); err != nil {
+			return fmt.Errorf("market holiday: %v", err)
+		}
+	}
+	return nil
+}
+
+func (m market) location() (*time.Location, error) {
+	if m.Timezone == "" {
+		return time.Local, nil
+	}
+	return time.LoadLocation(m.Timezone)
+}
+
+func (m market) closeTime() (hour, min int, err error) {
+	if m.Close == "" {
+		return 16, 0, nil
+	}
+	t, err := time.Parse("15:04", m.Close)
+	if err != nil {
+		return 0, 0, fmt.Errorf("market close: %v", err)
+	}
+	return t.Hour(), t.Minute(), nil
+}
+
+// tradingDay reports whether the exchange is open on the day of d.
+func (m market) tradingDay(d time.Time) bool {
+	if m.Calendar == "" {
+		return true
+	}
+	if d.Weekday() == time.Saturday || d.Weekday() == time.Sunday {
+		return false
+	}
+	day := d.Format(isoDate)
+	for _, h := range m.Holidays {
+		if h == day {
+			return false
+		}
+	}
+	return m.Calendar != "NYSE" || !nyseHoliday(d)
+}
+
+// date returns the time a snapshot taken at t is recorded under: t itself on
+// a trading day, or the close of the previous trading day on weekends and
+// holidays, so such runs update that day's entry instead of adding a new one.
+func (m market) date(t time.Time) (time.Time, error) {
+	loc, err := m.location()
+	if err != nil {
+		return time.Time{}, err
+	}
+	t = t.In(loc)
+	if m.tradingDay(t) {
+		return t, nil
+	}
+	hour, min, err := m.closeTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+	d := t
+	for !m.tradingDay(d) {
+		d = d.AddDate(0, 0, -1)
+	}
+	return time.Date(d.Year(), d.Month(), d.Day(), hour, min, 0, 0, loc), nil
+}
+
+// open reports whether the market is trading at t: a trading day before its
+// close. Until the close the day has no official closing price.
+func (m market) open(t time.Time) (bool, error) {
+	loc, err := m.location()
+	if err != nil {
+		return false, err
+	}
+	hour, min, err := m.closeTime()
+	if err != nil {
+		return false, err
+	}
+	t = t.In(loc)
+	c := time.Date(t.Year(), t.Month(), t.Day(), hour, min, 0, 0, loc)
+	return m.tradingDay(t) && t.Before(c), nil
+}
+
+// lastClose returns the latest market close at or before t.
+func (m market) lastClose(t time.Time) (time.Time, error) {
+	loc, err := m.location()
+	if err != nil {
+		return time.Time{}, err
+	}
+	hour, min, err := m.closeTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+	t = t.In(loc)
+	for d := t; ; d = d.AddDate(0, 0, -1) {
+		c := time.Date(d.Year(), d.Month(), d.Day(), hour, min, 0, 0, loc)
+		if !c.After(t) && m.tradingDay(c) {
+			return c, nil
+		}
+	}
+}
+
+// nextClose returns the first market close after t.
+func (m market) nextClose(t time.Time) (time.Time, error) {
+	loc, err := m.location()
+	if err != nil {
+		return time.Time{}, err
+	}
+	hour, min, err := m.closeTime()
+	if err != nil {
+		return time.Time{}, err
+	}
+	t = t.In(loc)
+	for d := t; ; d = d.AddDate(0, 0, 1) {
+		c := time.Date(d.Year(), d.Month(), d.Day(), hour, min, 0, 0, loc)
+		if c.After(t) && m.tradingDay(c) {
+			return c, nil
+		}
+	}
+}
+
+// nyseHoliday reports whether d is a full-day NYSE holiday.
+func nyseHoliday(d time.Time) bool {
+	y, loc := d.Year(), d.Location()
+	date := func(month time.Month, day int) time.Time {
+		return time.Date(y, month, day, 0, 0, 0, 0, loc)
+	}
+	// holidays on a Saturday are observed on Friday, on a Sunday on Monday
+	observed := func(h time.Time) time.Time {
+		switch h.Weekday() {
+		case time.Saturday:
+			return h.AddDate(0, 0, -1)
+		case time.Sunday:
+			return h.AddDate(0, 0, 1)
+		}
+		return h
+	}
+	// nth returns the nth weekday of month, counting from the end when n < 0
+	nth := func(month time.Month, wd time.Weekday, n int) time.Time {
+		if n < 0 {
+			last := date(month+1, 0)
+			return last.AddDate(0, 0, -((int(last.Weekday()) - int(wd) + 7) % 7))
+		}
+		first := date(month, 1)
+		return first.AddDate(0, 0, (int(wd)-int(first.Weekday())+7)%7+7*(n-1))
+	}
+
+	holidays := []time.Time{
+		nth(time.January, time.Monday, 3),    // Martin Luther King Jr. Day
+		nth(time.February, time.Monday, 3),   // Washington's Birthday
+		easter(y, loc).AddDate(0, 0, -2),     // Good Friday
+		nth(time.May, time.Monday, -1),       // Memorial Day
+		observed(date(time.July, 4)),         // Independence Day
+		nth(time.September, time.Monday, 1),  // Labor Day
+		nth(time.November, time.Thursday, 4), // Thanksgiving Day
+		observed(date(time.December, 25)),    // Christmas Day
+	}
+	// New Year's Day on a Saturday is not observed on the Friday before.
+	if ny := date(time.January, 1); ny.Weekday() != time.Saturday {
+		holidays = append(holidays, observed(ny))
+	}
+	if y >= 2022 {
+		holidays = append(holidays, observed(date(time.June, 19))) // Juneteenth
+	}
+	for _, h := range holidays {
+		if h.Month() == d.Month() && h.Day() == d.Day() {
+			return true
+		}
+	}
+	return false
+}
+
+// easter returns Easter Sunday of year y using the anonymous Gregorian
+// algorithm.
+func easter(y int, loc *time.Location) time.Time {
+	a := y % 19
+	b, c := y/100, y%100
+	d, e := b/4, b%4
+	f := (b + 8) / 25
+	g := (b - f + 1) / 3
+	h := (19*a + b - d - g + 15) % 30
+	i, k := c/4, c%4
+	l := (32 + 2*e + 2*i - h - k) % 7
+	m := (a + 11*h + 22*l) / 451
+	month := (h + l - 7*m + 114) / 31
+	day := (h+l-7*m+114)%31 + 1
+	return time.Date(y, time.Month(month), day, 0, 0, 0, 0, loc)
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// asset is something owned outside the brokerage account, such as a bank
+// balance or a house. Debts such as a mortgage are entered with a negative
+// value.
+type asset struct {
+	Name    string          `json:"name"`
+	Value   decimal.Decimal `json:"value"`
+	Updated time.Time       `json:"updated"`
+	// Cash marks a bank balance, kept up to date by the balances command.
+	Cash bool `json:"cash,omitempty"`
+}
+
+// netWorthSymbol is the history the daily net worth is recorded under. The
+// leading dot keeps it from clashing with a ticker.
+const netWorthSymbol = ".networth"
+
+// netWorth adds the external assets to the value of the holdings in latest.
+func netWorth(conf config, latest map[string]performance) decimal.Decimal {
+	var total decimal.Decimal
+	for _, v := range holdingValues(conf, latest) {
+		total = total.Add(v)
+	}
+	for _, a := range conf.Assets {
+		total = total.Add(a.Value)
+	}
+	return total
+}
+
+// netWorthTrend is how far back the net worth section compares against.
+var netWorthTrend = []struct {
+	label        string
+	months, year int
+}{
+	{"1 month", 1, 0},
+	{"3 months", 3, 0},
+	{"1 year", 0, 1},
+}
+
+func printNetWorth(w io.Writer, conf config, store historyStore, latest map[string]performance, now time.Time) {
+	fmt.Fprintf(w, "=== %s ===\n", conf.tr("Net worth"))
+	var brokerage decimal.Decimal
+	for _, v := range holdingValues(conf, latest) {
+		brokerage = brokerage.Add(v)
+	}
+	fmt.Fprintf(w, "%s %s\n", conf.tr("brokerage"), brokerage.StringFixed(2))
+	for _, a := range conf.Assets {
+		fmt.Fprintf(w, "%s %s (%s %s)\n", a.Name, a.Value.StringFixed(2), conf.tr("updated"), a.Updated.Format(humanDate))
+	}
+	total := netWorth(conf, latest)
+	fmt.Fprintf(w, "%s %s\n", conf.tr("total"), total.StringFixed(2))
+
+	history, err := store.load(netWorthSymbol)
+	if err != nil {
+		fmt.Fprintf(w, "%s: %v\n\n", conf.tr("unavailable"), err)
+		return
+	}
+	for _, t := range netWorthTrend {
+		since := now.AddDate(-t.year, -t.months, 0)
+		// The last entry on or before since is what net worth was then.
+		var then *performance
+		for k := range history {
+			if !history[k].Date.After(since) {
+				then = &history[k]
+			}
+		}
+		if then == nil || !then.Price.IsPositive() {
+			continue
+		}
+		was := conf.scaled(then.Price)
+		fmt.Fprintf(w, "%s %s %s (%+.1f%%)\n", conf.tr(t.label), conf.tr("ago"), was.StringFixed(2),
+			100*total.Sub(was).Div(was).InexactFloat64())
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+// setAsset handles "asset NAME VALUE", adding or updating an external
+// asset, and "asset NAME" with -remove to delete one.
+func setAsset(w io.Writer, confFile string, args []string, remove bool) error {
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 || (remove && len(args) != 1) || (!remove && len(args) != 2) {
+		return errors.New("usage: asset NAME VALUE, or -remove asset NAME")
+	}
+	name := args[0]
+	idx := -1
+	for k, a := range conf.Assets {
+		if strings.EqualFold(a.Name, name) {
+			idx = k
+		}
+	}
+	var detail string
+	if remove {
+		if idx < 0 {
+			return fmt.Errorf("no asset named %q", name)
+		}
+		detail = fmt.Sprintf("%s %s removed", name, conf.Assets[idx].Value.StringFixed(2))
+		conf.Assets = append(conf.Assets[:idx], conf.Assets[idx+1:]...)
+	} else {
+		value, err := decimal.NewFromString(args[1])
+		if err != nil {
+			return err
+		}
+		a := asset{Name: name, Value: value, Updated: clock()}
+		if idx < 0 {
+			conf.Assets = append(conf.Assets, a)
+			detail = fmt.Sprintf("%s %s", name, value.StringFixed(2))
+		} else {
+			detail = fmt.Sprintf("%s %s -> %s", name, conf.Assets[idx].Value.StringFixed(2), value.StringFixed(2))
+			a.Name = conf.Assets[idx].Name
+			conf.Assets[idx] = a
+		}
+	}
+	if err := writeConfig(confFile, conf); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, detail)
+	return appendAudit(confFile, auditEntry{Action: "asset", Detail: detail})
+}
+
+// balance is an account balance on a date, as imported from a bank export
+// or a balances plugin.
+type balance struct {
+	Account string          `json:"account"`
+	Date    time.Time       `json:"date"`
+	Balance decimal.Decimal `json:"balance"`
+}
+
+// readBalances reads "account,date(mm/dd/yy),balance" rows. A first row that
+// does not parse is taken to be a header.
+func readBalances(r io.Reader) ([]balance, error) {
+	rows, err := csv.NewReader(r).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	var balances []balance
+	for k, row := range rows {
+		b, err := parseBalance(row)
+		if err != nil {
+			if k == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("row %d: %v", k+1, err)
+		}
+		balances = append(balances, b)
+	}
+	return balances, nil
+}
+
+func parseBalance(row []string) (balance, error) {
+	if len(row) != 3 {
+		return balance{}, errors.New("want account,date,balance")
+	}
+	t, err := time.Parse(mmddyy, strings.TrimSpace(row[1]))
+	if err != nil {
+		return balance{}, err
+	}
+	v, err := decimal.NewFromString(strings.TrimSpace(row[2]))
+	if err != nil {
+		return balance{}, err
+	}
+	return balance{Account: strings.TrimSpace(row[0]), Date: t, Balance: v}, nil
+}
+
+// applyBalances sets the cash asset for each account to its latest balance,
+// ignoring balances older than the asset's or already applied, and
+// describes what changed.
+func applyBalances(conf *config, balances []balance) []string {
+	var changed []string
+	for _, b := range balances {
+		idx := -1
+		for k, a := range conf.Assets {
+			if strings.EqualFold(a.Name, b.Account) {
+				idx = k
+			}
+		}
+		if idx < 0 {
+			conf.Assets = append(conf.Assets, asset{Name: b.Account, Cash: true})
+			idx = len(conf.Assets) - 1
+		} else if a := conf.Assets[idx]; b.Date.Before(a.Updated) || b.Date.Equal(a.Updated) && b.Balance.Equal(a.Value) {
+			continue
+		}
+		a := &conf.Assets[idx]
+		a.Value, a.Updated, a.Cash = b.Balance, b.Date, true
+		changed = append(changed, fmt.Sprintf("%s %s %s", a.Name, b.Balance.StringFixed(2), b.Date.Format(humanDate)))
+	}
+	return changed
+}
+
+// balances handles "balances import FILE" ("-" for stdin) and "balances
+// sync", which asks every balances plugin for its accounts.
+func balances(ctx context.Context, w io.Writer, confFile string, args []string) error {
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	var imported []balance
+	switch {
+	case len(args) == 2 && args[0] == "import":
+		f := os.Stdin
+		if args[1] != "-" {
+			if f, err = os.Open(args[1]); err != nil {
+				return err
+			}
+			defer f.Close()
+		}
+		if imported, err = readBalances(f); err != nil {
+			return fmt.Errorf("%s: %v", args[1], err)
+		}
+	case len(args) == 1 && args[0] == "sync":
+		for _, p := range conf.Plugins {
+			if p.Kind != pluginBalances {
+				continue
+			}
+			bs, err := p.balances(ctx)
+			if err != nil {
+				return err
+			}
+			imported = append(imported, bs...)
+		}
+	default:
+		return errors.New("usage: balances import FILE, or balances sync")
+	}
+	changed := applyBalances(&conf, imported)
+	if len(changed) == 0 {
+		return nil
+	}
+	if err := writeConfig(confFile, conf); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, strings.Join(changed, "\n"))
+	return appendAudit(confFile, auditEntry{Action: "balances", Detail: strings.Join(changed, "; ")})
+}
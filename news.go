@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+)
+
+type rssItem struct {
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+}
+
+// fetchHeadlines returns the items of the RSS feed at u in feed order,
+// which for news feeds is newest first.
+func fetchHeadlines(ctx context.Context, u string) ([]rssItem, error) {
+	var rss struct {
+		Items []rssItem `xml:"channel>item"`
+	}
+	err := fetchRetry.do(ctx, "news", func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("User-Agent", "Mozilla/5.0")
+		resp, err := yahooClient.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+			return permanentError{fmt.Errorf("%s: %s", u, resp.Status)}
+		}
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("%s: %s", u, resp.Status)
+		}
+		return xml.NewDecoder(resp.Body).Decode(&rss)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rss.Items, nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// notifier is a destination for reports and alerts. html is an optional
+// HTML rendering of body that channels able to show it may prefer.
+type notifier interface {
+	notify(ctx context.Context, subject, body, html string) error
+}
+
+// channelConfig is one notification destination. Which fields apply
+// depends on Type:
+//
+//	mailgun   To, sent with the account in notifications.mailgun and by
+//	          default to its recipients
+//	slack     URL (or URLFile), an incoming webhook
+//	telegram  BotToken (or BotTokenFile) and ChatID
+//	webhook   URL (or URLFile), which gets a JSON POST of
+//	          {"subject":"...","body":"...","html":"..."}
+//
+// Secrets resolve like the mailgun keys: from the file, the value with
+// ${ENV} references expanded, or the keyring entry "<type>-<name>".
+type channelConfig struct {
+	Name         string   `json:"name,omitempty"`
+	Type         string   `json:"type"`
+	To           []string `json:"to,omitempty"`
+	URL          string   `json:"url,omitempty"`
+	URLFile      string   `json:"url_file,omitempty"`
+	BotToken     string   `json:"bot_token,omitempty"`
+	BotTokenFile string   `json:"bot_token_file,omitempty"`
+	ChatID       string   `json:"chat_id,omitempty"`
+}
+
+func (c channelConfig) validate() error {
+	switch c.Type {
+	case "mailgun", "slack", "telegram", "webhook":
+	default:
+		return fmt.Errorf("unknown notification channel %q, want mailgun, slack, telegram or webhook", c.Type)
+	}
+	if c.Type == "telegram" && c.ChatID == "" {
+		return errors.New("telegram channel needs a chat_id")
+	}
+	return nil
+}
+
+func (c channelConfig) keyringName() string {
+	if c.Name == "" {
+		return c.Type
+	}
+	return c.Type + "-" + c.Name
+}
+
+// channels returns the configured channels, or the Mailgun recipients when
+// there are none.
+func (n notifications) channels() []channelConfig {
+	if len(n.Channels) == 0 {
+		return []channelConfig{{Type: "mailgun"}}
+	}
+	return n.Channels
+}
+
+// newNotifiers returns every configured destination, the channels followed
+// by the notify plugins.
+func newNotifiers(conf config) ([]notifier, error) {
+	var ns []notifier
+	for _, c := range conf.Notifications.channels() {
+		n, err := newNotifier(conf, c)
+		if err != nil {
+			return nil, err
+		}
+		ns = append(ns, n)
+	}
+	for _, p := range conf.Plugins {
+		if p.Kind == pluginNotify {
+			ns = append(ns, pluginNotifier{p})
+		}
+	}
+	return ns, nil
+}
+
+// notifierNames names the destinations of newNotifiers, in its order.
+func notifierNames(conf config) []string {
+	var names []string
+	for _, c := range conf.Notifications.channels() {
+		names = append(names, c.keyringName())
+	}
+	for _, p := range conf.Plugins {
+		if p.Kind == pluginNotify {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
+
+func newNotifier(conf config, c channelConfig) (notifier, error) {
+	switch c.Type {
+	case "mailgun":
+		return mailgunNotifier{conf.Notifications.Mailgun, c.To}, nil
+	case "slack", "webhook":
+		u, err := secret(c.keyringName(), c.URL, c.URLFile)
+		if err != nil {
+			return nil, err
+		}
+		if u == "" {
+			return nil, fmt.Errorf("%s: no url configured", c.keyringName())
+		}
+		if c.Type == "slack" {
+			return slackNotifier{u}, nil
+		}
+		return webhookNotifier{u}, nil
+	case "telegram":
+		token, err := secret(c.keyringName(), c.BotToken, c.BotTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		if token == "" {
+			return nil, fmt.Errorf("%s: no bot token configured", c.keyringName())
+		}
+		return telegramNotifier{token, c.ChatID}, nil
+	}
+	return nil, c.validate()
+}
+
+type mailgunNotifier struct {
+	mc mailgunConfig
+	to []string
+}
+
+func (n mailgunNotifier) notify(ctx context.Context, subject, body, html string) error {
+	return sendEmail(ctx, n.mc, subject, body, html, n.to...)
+}
+
+var notifyClient = http.Client{Timeout: 30 * time.Second}
+
+// postJSON posts v as JSON to u and fails on any status but 2xx.
+func postJSON(ctx context.Context, u string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", u, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := notifyClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return nil
+}
+
+// slackNotifier posts to a Slack incoming webhook. The report goes in a
+// code block to keep its columns.
+type slackNotifier struct{ url string }
+
+func (n slackNotifier) notify(ctx context.Context, subject, body, html string) error {
+	text := fmt.Sprintf("*%s*\n```\n%s\n```", subject, strings.TrimRight(body, "\n"))
+	if err := postJSON(ctx, n.url, map[string]string{"text": text}); err != nil {
+		return fmt.Errorf("slack: %v", err)
+	}
+	return nil
+}
+
+// telegramMax is the longest message the Telegram Bot API accepts.
+const telegramMax = 4096
+
+// telegramNotifier sends through a Telegram bot, splitting reports longer
+// than a message allows.
+type telegramNotifier struct{ token, chatID string }
+
+func (n telegramNotifier) notify(ctx context.Context, subject, body, html string) error {
+	u := fmt.Sprintf("https://api.telegram.org/bot%s/sendMessage", url.PathEscape(n.token))
+	text := subject + "\n\n" + body
+	for len(text) > 0 {
+		part := text
+		if len(part) > telegramMax {
+			part = part[:telegramMax]
+			if k := strings.LastIndex(part, "\n"); k > 0 {
+				part = part[:k+1]
+			}
+		}
+		text = text[len(part):]
+		if err := postJSON(ctx, u, map[string]string{"chat_id": n.chatID, "text": part}); err != nil {
+			return fmt.Errorf("telegram: %v", err)
+		}
+	}
+	return nil
+}
+
+// webhookNotifier posts the message as JSON to any URL.
+type webhookNotifier struct{ url string }
+
+func (n webhookNotifier) notify(ctx context.Context, subject, body, html string) error {
+	msg := struct {
+		Subject string `json:"subject"`
+		Body    string `json:"body"`
+		HTML    string `json:"html,omitempty"`
+	}{subject, body, html}
+	if err := postJSON(ctx, n.url, msg); err != nil {
+		return fmt.Errorf("webhook: %v", err)
+	}
+	return nil
+}
+
+// pluginNotifier delivers through a notify plugin.
+type pluginNotifier struct{ plugin }
+
+func (p pluginNotifier) notify(ctx context.Context, subject, body, html string) error {
+	return p.plugin.notify(ctx, subject, body)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// optimizeYears is how much daily history the optimizer estimates
+// returns and covariances from.
+const optimizeYears = 3
+
+// tradingDays annualizes daily statistics.
+const tradingDays = 252
+
+// optimize suggests long-only weights on the efficient frontier with an
+// annual volatility of at most risk percent, estimated from the daily
+// closes of the held symbols, and prints the trades to get there.
+func optimize(ctx context.Context, w io.Writer, confFile string, risk float64) error {
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	if risk <= 0 {
+		return fmt.Errorf("risk %g%% must be positive", risk)
+	}
+	held := make(map[string]float64)
+	for _, i := range conf.Investments {
+		held[i.Symbol] += i.Units.InexactFloat64()
+	}
+	var symbols []string
+	for s := range held {
+		symbols = append(symbols, s)
+	}
+	sort.Strings(symbols)
+	if len(symbols) < 2 {
+		return errors.New("need at least two holdings to optimize")
+	}
+
+	end := clock()
+	closes, err := alignedCloses(ctx, newHistoryStore(confFile, conf), symbols, end.AddDate(-optimizeYears, 0, 0), end)
+	if err != nil {
+		return err
+	}
+	returns := dailyReturns(closes)
+	n := len(symbols)
+	mu := make([]float64, n)
+	for k, r := range returns {
+		for _, x := range r {
+			mu[k] += x
+		}
+		mu[k] /= float64(len(r))
+	}
+	cov := make([][]float64, n)
+	for i := range cov {
+		cov[i] = make([]float64, n)
+		for j := range cov[i] {
+			for t := range returns[i] {
+				cov[i][j] += (returns[i][t] - mu[i]) * (returns[j][t] - mu[j])
+			}
+			cov[i][j] *= tradingDays / float64(len(returns[i])-1)
+		}
+		mu[i] *= tradingDays
+	}
+
+	target := risk / 100
+	lo, hi := 1e-3, 1e4
+	weights := frontierWeights(mu, cov, hi)
+	if volatility(cov, weights) <= target {
+		// Bisect the risk aversion for the riskiest portfolio within target.
+		for it := 0; it < 60; it++ {
+			mid := math.Sqrt(lo * hi)
+			if m := frontierWeights(mu, cov, mid); volatility(cov, m) > target {
+				lo = mid
+			} else {
+				hi, weights = mid, m
+			}
+		}
+	}
+
+	last := len(closes[0]) - 1
+	var total float64
+	for k, s := range symbols {
+		total += held[s] * closes[k][last]
+	}
+	var ret float64
+	for k := range symbols {
+		ret += weights[k] * mu[k]
+	}
+	fmt.Fprintf(w, "=== %s, %s %.1f%% ===\n", conf.tr("Optimize"), conf.tr("volatility"), risk)
+	fmt.Fprintf(w, "%s %.1f%% %s, %s %.1f%% %s\n", conf.tr("expected return"), 100*ret, conf.tr("a year"),
+		conf.tr("volatility"), 100*volatility(cov, weights), conf.tr("a year"))
+	for k, s := range symbols {
+		price := closes[k][last]
+		now := held[s] * price
+		diff := weights[k]*total - now
+		action := conf.tr("buy")
+		if diff < 0 {
+			action = conf.tr("sell")
+		}
+		fmt.Fprintf(w, "%s %.1f%% -> %.1f%%", s, 100*now/total, 100*weights[k])
+		if math.Abs(diff) >= 0.005 {
+			fmt.Fprintf(w, ": %s %.4f (%.2f)", action, math.Abs(diff)/price, math.Abs(diff))
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	return nil
+}
+
+// alignedCloses returns the daily closes of symbols from from to to, keeping
+// only the days every symbol traded so that index t is the same day in
+// each series.
+func alignedCloses(ctx context.Context, store historyStore, symbols []string, from, to time.Time) ([][]float64, error) {
+	byDay := make([]map[int64]float64, len(symbols))
+	days := make(map[int64]int)
+	for k, s := range symbols {
+		series, err := dailyCloses(ctx, store, s, from, to)
+		if err != nil {
+			return nil, err
+		}
+		byDay[k] = make(map[int64]float64, len(series))
+		for _, p := range series {
+			byDay[k][p.date.Unix()] = p.close
+			days[p.date.Unix()]++
+		}
+	}
+	var common []int64
+	for d, n := range days {
+		if n == len(symbols) {
+			common = append(common, d)
+		}
+	}
+	sort.Slice(common, func(i, j int) bool { return common[i] < common[j] })
+	if len(common) < 30 {
+		return nil, errors.New("not enough shared price history")
+	}
+	closes := make([][]float64, len(symbols))
+	for k := range symbols {
+		for _, d := range common {
+			closes[k] = append(closes[k], byDay[k][d])
+		}
+	}
+	return closes, nil
+}
+
+// dailyReturns turns each series of closes into its day-over-day returns.
+func dailyReturns(closes [][]float64) [][]float64 {
+	returns := make([][]float64, len(closes))
+	for k, c := range closes {
+		for t := 1; t < len(c); t++ {
+			returns[k] = append(returns[k], c[t]/c[t-1]-1)
+		}
+	}
+	return returns
+}
+
+// frontierWeights maximises mu·w - lambda/2 w·cov·w over long-only
+// weights summing to one by projected gradient ascent.
+func frontierWeights(mu []float64, cov [][]float64, lambda float64) []float64 {
+	n := len(mu)
+	w := make([]float64, n)
+	for i := range w {
+		w[i] = 1 / float64(n)
+	}
+	// The largest absolute row sum bounds the curvature, which keeps the
+	// step stable.
+	var curve float64
+	for i := range cov {
+		var s float64
+		for j := range cov[i] {
+			s += math.Abs(cov[i][j])
+		}
+		curve = math.Max(curve, s)
+	}
+	step := 1 / (lambda*curve + 1e-9)
+	g := make([]float64, n)
+	for it := 0; it < 2000; it++ {
+		for i := range g {
+			g[i] = mu[i]
+			for j := range w {
+				g[i] -= lambda * cov[i][j] * w[j]
+			}
+		}
+		for i := range w {
+			w[i] += step * g[i]
+		}
+		projectSimplex(w)
+	}
+	return w
+}
+
+// projectSimplex replaces v with its closest point whose entries are
+// non-negative and sum to one.
+func projectSimplex(v []float64) {
+	u := append([]float64(nil), v...)
+	sort.Sort(sort.Reverse(sort.Float64Slice(u)))
+	var sum, theta float64
+	for j, x := range u {
+		sum += x
+		if t := (sum - 1) / float64(j+1); x-t > 0 {
+			theta = t
+		}
+	}
+	for i := range v {
+		v[i] = math.Max(v[i]-theta, 0)
+	}
+}
+
+func volatility(cov [][]float64, w []float64) float64 {
+	var v float64
+	for i := range w {
+		for j := range w {
+			v += w[i] * cov[i][j] * w[j]
+		}
+	}
+	return math.Sqrt(v)
+}
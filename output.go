@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// outputVersion is the version of the json and csv report schema. Fields
+// may be added without changing it; it changes when one is renamed,
+// removed or changes meaning.
+const outputVersion = 1
+
+// reportOutput is the report as printed by -output json.
+type reportOutput struct {
+	Version      int               `json:"version"`
+	Date         string            `json:"date"`
+	BaseCurrency string            `json:"base_currency"`
+	Lots         []lotOutput       `json:"lots"`
+	Failed       map[string]string `json:"failed,omitempty"`
+}
+
+// lotOutput is one investment. Price, value and compound interest are set
+// only when the lot could be priced; history is oldest first and includes
+// this run.
+type lotOutput struct {
+	Symbol           string           `json:"symbol"`
+	Date             string           `json:"date"`
+	Account          string           `json:"account,omitempty"`
+	Currency         string           `json:"currency"`
+	Total            decimal.Decimal  `json:"total"`
+	Units            decimal.Decimal  `json:"units"`
+	Fees             *decimal.Decimal `json:"fees,omitempty"`
+	TaxesPaid        *decimal.Decimal `json:"taxes_paid,omitempty"`
+	Price            *decimal.Decimal `json:"price,omitempty"`
+	Value            *decimal.Decimal `json:"value,omitempty"`
+	CompoundInterest *float64         `json:"compound_interest,omitempty"`
+	History          []pointOutput    `json:"history"`
+}
+
+type pointOutput struct {
+	Date             string          `json:"date"`
+	Price            decimal.Decimal `json:"price"`
+	CompoundInterest float64         `json:"compound_interest"`
+}
+
+var outputFormats = []string{"text", "json", "csv", "pdf"}
+
+func validOutput(output string) error {
+	for _, f := range outputFormats {
+		if output == f {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown output %q, want text, json, csv or pdf", output)
+}
+
+func reportLots(conf config, store historyStore, latest map[string]performance, now time.Time) ([]lotOutput, error) {
+	lots := []lotOutput{}
+	for _, v := range conf.Investments {
+		if v.Date.After(now) {
+			continue
+		}
+		history, err := lotHistory(store, v, latest, now)
+		if err != nil {
+			return nil, err
+		}
+		currency := v.Currency
+		if currency == "" {
+			currency = conf.baseCurrency()
+		}
+		l := lotOutput{Symbol: v.Symbol, Date: v.Date.Format(isoDate), Account: v.Account, Currency: currency,
+			Total: v.Total, Units: v.Units, Fees: v.Fees, TaxesPaid: v.TaxesPaid, History: []pointOutput{}}
+		if p, ok := latest[v.Symbol]; ok {
+			price, value, r := p.Price, v.Units.Mul(p.Price), p.CompoundInterest
+			l.Price, l.Value, l.CompoundInterest = &price, &value, &r
+		}
+		for _, h := range history {
+			l.History = append(l.History, pointOutput{h.Date.Format(isoDate), h.Price, h.CompoundInterest})
+		}
+		lots = append(lots, l)
+	}
+	return lots, nil
+}
+
+// printOutput prints the report as json or csv. The csv has a row per
+// lot and history entry, or a single row without a date for a lot with no
+// history; failed quotes go to stderr.
+func printOutput(w io.Writer, output string, conf config, store historyStore, latest map[string]performance, failed map[string]error, now time.Time) error {
+	lots, err := reportLots(conf, store, latest, now)
+	if err != nil {
+		return err
+	}
+	if output == "json" {
+		r := reportOutput{Version: outputVersion, Date: now.Format(isoDate), BaseCurrency: conf.baseCurrency(), Lots: lots}
+		if len(failed) > 0 {
+			r.Failed = make(map[string]string)
+			for s, err := range failed {
+				r.Failed[s] = err.Error()
+			}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+	}
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"symbol", "purchase_date", "account", "currency", "total", "units", "date", "price", "compound_interest"})
+	for _, l := range lots {
+		lot := []string{l.Symbol, l.Date, l.Account, l.Currency, l.Total.String(), l.Units.String()}
+		if len(l.History) == 0 {
+			cw.Write(append(lot, "", "", ""))
+		}
+		for _, h := range l.History {
+			cw.Write(append(lot[:len(lot):len(lot)], h.Date, h.Price.String(), fmt.Sprintf("%.4f", h.CompoundInterest)))
+		}
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	printFailures(os.Stderr, conf, failed)
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// paperConfigFile is the paper-trading config kept next to confFile, e.g.
+// config.paper.json for config.json.
+func paperConfigFile(confFile string) string {
+	ext := filepath.Ext(confFile)
+	return strings.TrimSuffix(confFile, ext) + ".paper" + ext
+}
+
+// ensurePaperConfig returns the paper-trading config file for confFile,
+// creating it if needed with the real config's settings but none of its
+// investments, and a history directory of its own so paper prices and
+// report state never mix with the real ones.
+func ensurePaperConfig(confFile string) (string, error) {
+	file := paperConfigFile(confFile)
+	if _, err := os.Stat(file); err == nil || !os.IsNotExist(err) {
+		return file, err
+	}
+	real, err := parseConfig(confFile)
+	if err != nil {
+		return "", err
+	}
+	paper := config{
+		Paper:         true,
+		HistoryDir:    strings.TrimSuffix(filepath.Base(file), filepath.Ext(file)) + "-history",
+		Notifications: real.Notifications,
+		Language:      real.Language,
+		Market:        real.Market,
+		Report:        real.Report,
+		Plugins:       real.Plugins,
+	}
+	return file, writeConfig(file, paper)
+}
+
+// paperTrade handles "paper buy SYMBOL AMOUNT" and "paper sell SYMBOL
+// UNITS", trading at the latest price in the paper config of confFile.
+// Sells come out of the oldest lots first.
+func paperTrade(ctx context.Context, w io.Writer, confFile string, args []string) error {
+	if len(args) != 3 || (args[0] != "buy" && args[0] != "sell") {
+		return errors.New("usage: paper buy SYMBOL AMOUNT, or paper sell SYMBOL UNITS")
+	}
+	file, err := ensurePaperConfig(confFile)
+	if err != nil {
+		return err
+	}
+	conf, err := parseConfig(file)
+	if err != nil {
+		return err
+	}
+	n, err := decimal.NewFromString(args[2])
+	if err != nil {
+		return err
+	}
+	if !n.IsPositive() {
+		return fmt.Errorf("%s must be positive", args[2])
+	}
+	symbol := strings.ToUpper(strings.TrimSpace(args[1]))
+	var provider string
+	for _, i := range conf.Investments {
+		if i.Symbol == symbol {
+			provider = i.Provider
+		}
+	}
+	price, err := getPrice(ctx, conf, investment{Symbol: symbol, Provider: provider})
+	if err != nil {
+		return err
+	}
+	if !price.IsPositive() {
+		return fmt.Errorf("no price for %s", symbol)
+	}
+
+	var detail string
+	if args[0] == "buy" {
+		i := investment{Symbol: symbol, Date: clock(), Total: n, Units: n.DivRound(price, maxUnitPlaces), Provider: provider}
+		if err := i.checkAmounts(); err != nil {
+			return err
+		}
+		conf.Investments = append(conf.Investments, i)
+		detail = fmt.Sprintf(conf.tr("bought %s %s for %s at %s"), i.Units.StringFixed(4), symbol, n.StringFixed(2), price.StringFixed(2))
+	} else {
+		proceeds := n.Mul(price).Round(2)
+		s, err := sellLots(&conf, symbol, n, proceeds, clock())
+		if err != nil {
+			return err
+		}
+		detail = fmt.Sprintf(conf.tr("sold %s %s for %s at %s, realized %s"), n, symbol, proceeds.StringFixed(2), price.StringFixed(2),
+			proceeds.Sub(s.cost()).StringFixed(2))
+	}
+	if err := writeConfig(file, conf); err != nil {
+		return err
+	}
+	fmt.Fprintln(w, detail)
+	return appendAudit(file, auditEntry{Action: "paper " + args[0], Detail: detail})
+}
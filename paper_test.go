@@ -0,0 +1,47 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestPaperBuyValidates(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the quote plugin is a shell command")
+	}
+	confFile := filepath.Join(t.TempDir(), "config.json")
+	// the symbol's earlier lot has it priced by a plugin, at a price the
+	// amount does not divide evenly by
+	paper := config{
+		Paper:   true,
+		Plugins: []plugin{{Name: "fixed", Kind: pluginQuote, Command: "sh", Args: []string{"-c", `echo '{"price": 187.23}'`}}},
+		Investments: []investment{{Symbol: "AAPL", Date: day("2020-01-02"), Total: decimal.NewFromInt(100),
+			Units: decimal.NewFromInt(1), Provider: "fixed"}},
+	}
+	if err := writeConfig(paperConfigFile(confFile), paper); err != nil {
+		t.Fatal(err)
+	}
+	if err := paperTrade(context.Background(), ioutil.Discard, confFile, []string{"buy", "aapl", "1000"}); err != nil {
+		t.Fatal(err)
+	}
+	conf, err := parseConfig(paperConfigFile(confFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conf.Investments) != 2 {
+		t.Fatalf("%d lots after the buy, want 2", len(conf.Investments))
+	}
+	for _, i := range conf.Investments {
+		if i.Symbol != "AAPL" {
+			t.Errorf("lot of %q, want AAPL", i.Symbol)
+		}
+	}
+	if err := conf.validate(); err != nil {
+		t.Errorf("validate after a paper buy: %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// defaultConfigFile is config.json in the working directory if there is one,
+// as older versions expected, and stockstalk/config.json in the user's
+// config directory ($XDG_CONFIG_HOME, ~/Library/Application Support,
+// %AppData%) otherwise.
+func defaultConfigFile() string {
+	if _, err := os.Stat("config.json"); err == nil {
+		return "config.json"
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "config.json"
+	}
+	return filepath.Join(dir, "stockstalk", "config.json")
+}
+
+// userDataDir returns the base directory for user data: $XDG_DATA_HOME or
+// ~/.local/share on Unix, ~/Library/Application Support on macOS and
+// %LocalAppData% on Windows.
+func userDataDir() (string, error) {
+	switch runtime.GOOS {
+	case "windows":
+		if dir := os.Getenv("LocalAppData"); dir != "" {
+			return dir, nil
+		}
+		return "", errors.New("%LocalAppData% is not defined")
+	case "darwin", "ios":
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(home, "Library", "Application Support"), nil
+	}
+	if dir := os.Getenv("XDG_DATA_HOME"); filepath.IsAbs(dir) {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share"), nil
+}
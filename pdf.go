@@ -0,0 +1,260 @@
+package main
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A4 in points, the unit of PDF, with the margin kept around the page.
+const (
+	pdfWidth, pdfHeight = 595, 842
+	pdfMargin           = 50
+)
+
+// The fonts of a PDF report, all among the standard fonts every reader
+// has, so none is embedded.
+const (
+	pdfRegular = "F1"
+	pdfBold    = "F2"
+	pdfMono    = "F3"
+)
+
+var pdfFonts = []struct{ name, base string }{
+	{pdfRegular, "Helvetica"},
+	{pdfBold, "Helvetica-Bold"},
+	{pdfMono, "Courier"},
+}
+
+// pdfDoc lays out text and charts top to bottom over as many pages as
+// they take.
+type pdfDoc struct {
+	pages []*bytes.Buffer
+	y     float64 // of the next line on the last page, from the bottom
+}
+
+func newPDFDoc() *pdfDoc {
+	d := &pdfDoc{}
+	d.newPage()
+	return d
+}
+
+func (d *pdfDoc) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pdfHeight - pdfMargin
+}
+
+func (d *pdfDoc) page() *bytes.Buffer { return d.pages[len(d.pages)-1] }
+
+// space starts a new page unless height points are left on this one.
+func (d *pdfDoc) space(height float64) {
+	if d.y-height < pdfMargin {
+		d.newPage()
+	}
+}
+
+// pdfText escapes s for a PDF string in WinAnsiEncoding. Runes it cannot
+// hold, such as those of Devanagari, are shown as "?".
+func pdfText(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r == '\t':
+			b.WriteByte(' ')
+		case r < 0x20 || r > 0xff || (r >= 0x7f && r < 0xa0):
+			b.WriteByte('?')
+		case r < 0x80:
+			b.WriteRune(r)
+		default:
+			fmt.Fprintf(&b, "\\%03o", r)
+		}
+	}
+	return b.String()
+}
+
+// textAt writes s at x on the current line, without moving down.
+func (d *pdfDoc) textAt(x float64, font string, size float64, s string) {
+	fmt.Fprintf(d.page(), "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, d.y-size, pdfText(s))
+}
+
+// line writes s on a line of its own, wrapped at width runes.
+func (d *pdfDoc) line(font string, size float64, width int, s string) {
+	for {
+		r := []rune(s)
+		rest := ""
+		if len(r) > width {
+			s, rest = string(r[:width]), string(r[width:])
+		}
+		d.space(size * 1.4)
+		d.textAt(pdfMargin, font, size, s)
+		d.y -= size * 1.4
+		if rest == "" {
+			return
+		}
+		s = rest
+	}
+}
+
+// gap leaves height points empty.
+func (d *pdfDoc) gap(height float64) {
+	d.y -= height
+}
+
+// row writes cells at the x offsets from the margin in cols.
+func (d *pdfDoc) row(font string, size float64, cols []float64, cells ...string) {
+	d.space(size * 1.4)
+	for k, c := range cells {
+		d.textAt(pdfMargin+cols[k], font, size, c)
+	}
+	d.y -= size * 1.4
+}
+
+// chart draws series as a line chart the width of the page and height
+// points high, labelled with its range of dates and values.
+func (d *pdfDoc) chart(series []chartPoint, height int) {
+	width := pdfWidth - 2*pdfMargin
+	d.space(float64(height) + 20)
+	s := newChartScale(series, width, height, 50)
+	top := d.y
+	// chartScale counts y down from the top, PDF up from the bottom
+	at := func(x, y int) (float64, float64) { return pdfMargin + float64(x), top - float64(y) }
+	w := d.page()
+	x0, y0 := at(s.left, s.top)
+	x1, y1 := at(s.right, s.bottom)
+	fmt.Fprintf(w, "0.8 G 0.5 w %.2f %.2f m %.2f %.2f l %.2f %.2f l S\n", x0, y0, x0, y1, x1, y1)
+	fmt.Fprintf(w, "0.122 0.467 0.706 RG 1.2 w")
+	for k, p := range series {
+		x, y := at(s.point(p))
+		op := "l"
+		if k == 0 {
+			op = "m"
+		}
+		fmt.Fprintf(w, " %.2f %.2f %s", x, y, op)
+	}
+	fmt.Fprintf(w, " S 0 G\n")
+	label := func(x, y float64, s string) {
+		fmt.Fprintf(w, "BT /%s 7 Tf %.2f %.2f Td (%s) Tj ET\n", pdfRegular, x, y, pdfText(s))
+	}
+	label(pdfMargin, y0-7, fmt.Sprintf("%.2f", s.max))
+	label(pdfMargin, y1, fmt.Sprintf("%.2f", s.min))
+	label(x0, y1-10, s.from.Format(humanDate))
+	label(x1-35, y1-10, s.to.Format(humanDate))
+	d.y = top - float64(height) - 4
+}
+
+// writeTo writes the document as a PDF file.
+func (d *pdfDoc) writeTo(w io.Writer) error {
+	var b bytes.Buffer
+	var offsets []int
+	obj := func(format string, args ...interface{}) {
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n", len(offsets))
+		fmt.Fprintf(&b, format, args...)
+		fmt.Fprintf(&b, "\nendobj\n")
+	}
+	b.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+	// 1 is the catalog, 2 the page tree, then the fonts, then each page
+	// followed by its contents
+	first := 3 + len(pdfFonts)
+	var kids, fonts []string
+	for k := range d.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", first+2*k))
+	}
+	for k, f := range pdfFonts {
+		fonts = append(fonts, fmt.Sprintf("/%s %d 0 R", f.name, 3+k))
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages))
+	for _, f := range pdfFonts {
+		obj("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", f.base)
+	}
+	for k, p := range d.pages {
+		obj("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << %s >> >> /Contents %d 0 R >>",
+			pdfWidth, pdfHeight, strings.Join(fonts, " "), first+2*k+1)
+		var z bytes.Buffer
+		zw := zlib.NewWriter(&z)
+		zw.Write(p.Bytes())
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		obj("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", z.Len(), z.Bytes())
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// writePDF renders the report as a PDF for archiving: the portfolio's
+// invested amount, value and gain, a table of the symbols, then each
+// holding with a chart of its recorded history and its recent days, and
+// last the optional sections as plain text.
+func writePDF(w io.Writer, conf config, data reportData) error {
+	d := newPDFDoc()
+	d.line(pdfBold, 16, 60, fmt.Sprintf("stockstalk %s", data.Date.Format(humanDate)))
+	d.gap(6)
+	d.line(pdfBold, 12, 80, conf.tr("Portfolio"))
+	d.line(pdfRegular, 10, 100, fmt.Sprintf("%s %.2f %s, %s %.2f, %s %+.2f", conf.tr("invested"), data.Portfolio.Invested,
+		data.BaseCurrency, conf.tr("Value"), data.Portfolio.Value, conf.tr("gain"), data.Portfolio.Gain))
+	d.gap(6)
+	cols := []float64{0, 90, 190, 300, 380}
+	d.row(pdfBold, 9, cols, conf.tr("Symbol"), conf.tr("Price"), conf.tr("Value"), conf.tr("Weight"), conf.tr("Return"))
+	for _, s := range data.Symbols {
+		d.row(pdfRegular, 9, cols, s.Symbol, s.Price.StringFixed(2), fmt.Sprintf("%.2f", s.Value),
+			fmt.Sprintf("%.2f %%", s.Weight), fmt.Sprintf("%.2f %%", s.CompoundInterest))
+	}
+	for _, h := range data.Holdings {
+		d.gap(10)
+		// keep a holding's heading with what follows it
+		d.space(60)
+		if h.Position != nil {
+			d.line(pdfBold, 11, 80, strings.TrimSpace(h.Position.Line))
+		}
+		d.line(pdfBold, 11, 80, strings.TrimSpace(h.Heading))
+		for _, l := range h.Details {
+			d.line(pdfRegular, 9, 105, l)
+		}
+		if len(h.History) >= 2 {
+			series := make([]chartPoint, len(h.History))
+			for k, p := range h.History {
+				// History is newest first
+				series[len(series)-1-k] = chartPoint{date: p.Date, value: p.CompoundInterest}
+			}
+			d.gap(4)
+			d.chart(series, 120)
+		}
+		history := h.History
+		if len(history) > historyRows {
+			history = history[:historyRows]
+		}
+		for _, p := range history {
+			d.row(pdfMono, 8, []float64{0, 80}, p.Date.Format(humanDate), fmt.Sprintf("%.2f %%", p.CompoundInterest))
+		}
+	}
+	if s := strings.TrimSpace(data.Sections); s != "" {
+		d.gap(10)
+		for _, l := range strings.Split(s, "\n") {
+			d.line(pdfMono, 8, 100, l)
+		}
+	}
+	return d.writeTo(w)
+}
+
+// writePDFFile writes the report as a PDF to file, leaving no partial file
+// behind on failure.
+func writePDFFile(file string, conf config, data reportData) error {
+	var b bytes.Buffer
+	if err := writePDF(&b, conf, data); err != nil {
+		return err
+	}
+	return writeFileAtomic(file, b.Bytes(), 0644)
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+
+	"github.com/shopspring/decimal"
+)
+
+const (
+	pluginQuote    = "quote"
+	pluginNotify   = "notify"
+	pluginBalances = "balances"
+)
+
+// plugin is an external program that supplies quotes or delivers reports.
+// Each call runs the command once, writes a single JSON request to its
+// stdin and reads a single JSON response from its stdout. Anything the
+// plugin writes to stderr is passed through.
+//
+// Quote plugins receive {"method":"quote","symbol":"X"} and answer
+// {"price":12.34}. Notify plugins receive
+// {"method":"notify","subject":"...","body":"..."} and answer {}. Balances
+// plugins receive {"method":"balances"} and answer
+// {"balances":[{"account":"Checking","date":"2006-01-02T00:00:00Z","balance":12.34}]}.
+// Any of them may answer {"error":"..."} to report a failure.
+type plugin struct {
+	Name    string   `json:"name"`
+	Kind    string   `json:"kind"` // quote, notify or balances
+	Command string   `json:"command"`
+	Args    []string `json:"args,omitempty"`
+}
+
+type pluginRequest struct {
+	Method  string `json:"method"`
+	Symbol  string `json:"symbol,omitempty"`
+	Subject string `json:"subject,omitempty"`
+	Body    string `json:"body,omitempty"`
+}
+
+type pluginResponse struct {
+	Price    decimal.Decimal `json:"price"`
+	Balances []balance       `json:"balances,omitempty"`
+	Error    string          `json:"error,omitempty"`
+}
+
+func findPlugin(plugins []plugin, name, kind string) (plugin, error) {
+	for _, p := range plugins {
+		if p.Name == name && p.Kind == kind {
+			return p, nil
+		}
+	}
+	return plugin{}, fmt.Errorf("no %s plugin named %q", kind, name)
+}
+
+func (p plugin) call(ctx context.Context, req pluginRequest) (pluginResponse, error) {
+	in, err := json.Marshal(req)
+	if err != nil {
+		return pluginResponse{}, err
+	}
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, p.Command, p.Args...)
+	cmd.Stdin = bytes.NewReader(in)
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return pluginResponse{}, fmt.Errorf("plugin %s: %w", p.Name, err)
+	}
+	var resp pluginResponse
+	if err := json.Unmarshal(out.Bytes(), &resp); err != nil {
+		return pluginResponse{}, fmt.Errorf("plugin %s: bad response: %v", p.Name, err)
+	}
+	if resp.Error != "" {
+		return pluginResponse{}, fmt.Errorf("plugin %s: %s", p.Name, resp.Error)
+	}
+	return resp, nil
+}
+
+func (p plugin) quote(ctx context.Context, symbol string) (decimal.Decimal, error) {
+	resp, err := p.call(ctx, pluginRequest{Method: "quote", Symbol: symbol})
+	return resp.Price, err
+}
+
+func (p plugin) notify(ctx context.Context, subject, body string) error {
+	_, err := p.call(ctx, pluginRequest{Method: "notify", Subject: subject, Body: body})
+	return err
+}
+
+func (p plugin) balances(ctx context.Context) ([]balance, error) {
+	resp, err := p.call(ctx, pluginRequest{Method: "balances"})
+	return resp.Balances, err
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// cashFlow is money paid into the portfolio, negative, or taken out of or
+// still held in it, positive.
+type cashFlow struct {
+	date   time.Time
+	amount float64
+}
+
+// npv is the value of flows discounted at rate to the date of the first.
+// It and its derivative are what xirr solves on.
+func npv(flows []cashFlow, rate float64) (value, slope float64) {
+	for _, f := range flows {
+		t := f.date.Sub(flows[0].date).Seconds() / secondsPerYear
+		d := math.Pow(1+rate, -t)
+		value += f.amount * d
+		slope -= t * f.amount * d / (1 + rate)
+	}
+	return value, slope
+}
+
+// xirr returns the money-weighted annual return, in percent, of flows
+// sorted by date: the rate at which they are worth nothing today. Newton's
+// method from a 10% guess usually gets there in a few steps; when it
+// wanders off, as it can with flows that change sign more than once, the
+// rate is found by bisection instead.
+func xirr(flows []cashFlow) (float64, error) {
+	if len(flows) < 2 {
+		return 0, errors.New("xirr needs at least two cash flows")
+	}
+	if rate, ok := xirrNewton(flows); ok {
+		return rate, nil
+	}
+	return xirrBisect(flows)
+}
+
+// xirrNewton finds the rate of flows by Newton's method, reporting whether
+// it converged.
+func xirrNewton(flows []cashFlow) (float64, bool) {
+	rate := 0.1
+	for n := 0; n < 100; n++ {
+		v, slope := npv(flows, rate)
+		if slope == 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			break
+		}
+		next := rate - v/slope
+		if next <= -1 {
+			next = (rate - 1) / 2
+		}
+		if math.Abs(next-rate) < 1e-9 {
+			return 100 * next, true
+		}
+		rate = next
+	}
+	return 0, false
+}
+
+// xirrBisect finds the rate of flows by bisection between just above -100%
+// and a rate far enough up for the value to change sign.
+func xirrBisect(flows []cashFlow) (float64, error) {
+	lo, hi := -0.999999, 1.0
+	vlo, _ := npv(flows, lo)
+	vhi, _ := npv(flows, hi)
+	for vlo*vhi > 0 {
+		if hi > 1e6 {
+			return 0, errors.New("xirr has no solution")
+		}
+		hi *= 2
+		vhi, _ = npv(flows, hi)
+	}
+	for n := 0; n < 200 && hi-lo > 1e-10; n++ {
+		mid := (lo + hi) / 2
+		v, _ := npv(flows, mid)
+		if v*vlo > 0 {
+			lo, vlo = mid, v
+		} else {
+			hi = mid
+		}
+	}
+	return 100 * (lo + hi) / 2, nil
+}
+
+// lotCost is what i cost in the base currency, at the rate of the day it
+// was bought.
+func lotCost(ctx context.Context, conf config, store historyStore, i investment) (float64, error) {
+	if i.Currency == "" || i.Currency == conf.baseCurrency() {
+		return i.basis().InexactFloat64(), nil
+	}
+	rate, err := historicalFxRate(ctx, store, i.Currency, conf.baseCurrency(), i.Date)
+	return i.basis().InexactFloat64() * rate, err
+}
+
+// printPortfolio sums up the holdings priced in latest: what was put in,
+// what it is worth and the money- and time-weighted returns over all
+// purchases, then the weight and returns of each symbol across its lots.
+func printPortfolio(ctx context.Context, w io.Writer, conf config, store historyStore, latest map[string]performance, now time.Time) {
+	var invested, value float64
+	var flows []cashFlow
+	symbolFlows := make(map[string][]cashFlow)
+	var priced []investment
+	symbolLots := make(map[string][]investment)
+	for _, i := range conf.Investments {
+		if _, ok := latest[i.Symbol]; !ok || i.Date.After(now) {
+			continue
+		}
+		cost, err := lotCost(ctx, conf, store, i)
+		if err != nil {
+			fmt.Fprintf(w, "%s %s: %v\n", i.Symbol, conf.tr("unavailable"), err)
+			continue
+		}
+		invested += cost
+		priced = append(priced, i)
+		symbolLots[i.Symbol] = append(symbolLots[i.Symbol], i)
+		flows = append(flows, cashFlow{i.Date, -cost})
+		symbolFlows[i.Symbol] = append(symbolFlows[i.Symbol], cashFlow{i.Date, -cost})
+	}
+	values := holdingValues(conf, latest)
+	for _, v := range values {
+		value += v.InexactFloat64()
+	}
+	if invested == 0 {
+		return
+	}
+	fmt.Fprintf(w, "=== %s ===\n", conf.tr("Portfolio"))
+	fmt.Fprintf(w, "%s %.2f, %s %.2f, %s %+.2f (%+.2f%%)\n", conf.tr("invested"), invested, conf.tr("value"), value,
+		conf.tr("gain"), value-invested, 100*(value-invested)/invested)
+	fmt.Fprintf(w, "%s %s, %s %s\n", conf.tr("money-weighted return"), xirrString(conf, flows, now, value),
+		conf.tr("time-weighted"), twrString(conf, store, priced, latest, now))
+	symbols := heldSymbols(conf)
+	sort.SliceStable(symbols, func(a, b int) bool { return values[symbols[a]].GreaterThan(values[symbols[b]]) })
+	for _, s := range symbols {
+		v, ok := values[s]
+		if !ok || value <= 0 || symbolFlows[s] == nil {
+			continue
+		}
+		fmt.Fprintf(w, "%s %.1f%%, %s %s, %s %s\n", s, 100*v.InexactFloat64()/value,
+			conf.tr("money-weighted return"), xirrString(conf, symbolFlows[s], now, v.InexactFloat64()),
+			conf.tr("time-weighted"), twrString(conf, store, symbolLots[s], latest, now))
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+// twrString formats the time-weighted return of lots.
+func twrString(conf config, store historyStore, lots []investment, latest map[string]performance, now time.Time) string {
+	r, err := twr(conf, store, lots, latest, now)
+	if err != nil {
+		return fmt.Sprintf("%s: %v", conf.tr("unavailable"), err)
+	}
+	return fmt.Sprintf("%.2f %%", r)
+}
+
+// xirrString formats the money-weighted return of buying with flows and
+// holding value at now.
+func xirrString(conf config, flows []cashFlow, now time.Time, value float64) string {
+	all := append([]cashFlow(nil), flows...)
+	sort.Slice(all, func(a, b int) bool { return all[a].date.Before(all[b].date) })
+	r, err := xirr(append(all, cashFlow{now, value}))
+	if err != nil {
+		return fmt.Sprintf("%s: %v", conf.tr("unavailable"), err)
+	}
+	return fmt.Sprintf("%.2f %%", r)
+}
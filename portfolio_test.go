@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func day(s string) time.Time {
+	t, err := time.Parse(isoDate, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// fromSpreadsheet converts an XIRR result, a fraction over 365-day years,
+// to the percent over 365.25-day years xirr returns.
+func fromSpreadsheet(rate float64) float64 {
+	return 100 * (math.Pow(1+rate, 365.25/365) - 1)
+}
+
+var xirrTests = []struct {
+	name  string
+	flows []cashFlow
+	want  float64 // in percent
+}{
+	{
+		// the example of Excel's XIRR documentation, =XIRR(...) 0.373362535
+		name: "excel example",
+		flows: []cashFlow{
+			{day("2008-01-01"), -10000},
+			{day("2008-03-01"), 2750},
+			{day("2008-10-30"), 4250},
+			{day("2009-02-15"), 3250},
+			{day("2009-04-01"), 2750},
+		},
+		want: fromSpreadsheet(0.373362535),
+	},
+	{
+		// 365 days apart, =XIRR({-1000,1100},{...}) is exactly 10%
+		name:  "one year",
+		flows: []cashFlow{{day("2019-01-01"), -1000}, {day("2020-01-01"), 1100}},
+		want:  fromSpreadsheet(0.1),
+	},
+	{
+		// =XIRR({-1000,500},{...}) 1461 days apart is 0.5^(365/1461)-1
+		name:  "loss over four years",
+		flows: []cashFlow{{day("2000-01-01"), -1000}, {day("2004-01-01"), 500}},
+		want:  fromSpreadsheet(math.Pow(0.5, 365.0/1461) - 1),
+	},
+	{
+		// paying in twice four years apart: with u the discount over four
+		// years, 2500u² - 5000u - 1000 = 0, so u = 1 + sqrt(1.4)
+		name: "bisection",
+		flows: []cashFlow{
+			{day("2000-01-01"), -1000},
+			{day("2004-01-01"), -5000},
+			{day("2008-01-01"), 2500},
+		},
+		want: 100 * (math.Pow(1+math.Sqrt(1.4), -0.25) - 1),
+	},
+}
+
+func TestXIRR(t *testing.T) {
+	for _, tt := range xirrTests {
+		got, err := xirr(tt.flows)
+		if err != nil {
+			t.Errorf("%s: xirr: %v", tt.name, err)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-5 {
+			t.Errorf("%s: xirr = %.7f %%, want %.7f %%", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestXIRRBisect(t *testing.T) {
+	for _, tt := range xirrTests {
+		got, err := xirrBisect(tt.flows)
+		if err != nil {
+			t.Errorf("%s: xirrBisect: %v", tt.name, err)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-5 {
+			t.Errorf("%s: xirrBisect = %.7f %%, want %.7f %%", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestXIRRNewtonFails(t *testing.T) {
+	flows := xirrTests[len(xirrTests)-1].flows
+	if rate, ok := xirrNewton(flows); ok {
+		t.Fatalf("xirrNewton converged to %.7f %%, want it to fail so bisection is tested", rate)
+	}
+}
+
+func TestXIRRNoSolution(t *testing.T) {
+	for _, flows := range [][]cashFlow{
+		{{day("2020-01-01"), -1000}},
+		{{day("2020-01-01"), -1000}, {day("2021-01-01"), -1000}},
+	} {
+		if rate, err := xirr(flows); err == nil {
+			t.Errorf("xirr(%v) = %.7f %%, want an error", flows, rate)
+		}
+	}
+}
+
+// syntheticPortfolio is a portfolio of symbols each bought lotsPer times
+// over days, with a price recorded for every one of those days.
+func syntheticPortfolio(tb testing.TB, symbols, lotsPer, days int) (config, historyStore, time.Time) {
+	store := historyStore{dir: tb.TempDir()}
+	start := day("2020-01-01")
+	var conf config
+	for s := 0; s < symbols; s++ {
+		symbol := fmt.Sprintf("SYM%d", s)
+		history := make([]performance, days)
+		for d := range history {
+			price := 100 + 20*math.Sin(float64(d)/30+float64(s)) + float64(d)/10
+			history[d] = performance{Symbol: symbol, Price: decimal.NewFromFloat(price).Round(2), Date: start.AddDate(0, 0, d)}
+		}
+		if err := store.write(symbol, history); err != nil {
+			tb.Fatal(err)
+		}
+		for l := 0; l < lotsPer; l++ {
+			p := history[l*days/lotsPer]
+			conf.Investments = append(conf.Investments, investment{Symbol: symbol, Date: p.Date,
+				Units: decimal.NewFromInt(10), Total: p.Price.Mul(decimal.NewFromInt(10))})
+		}
+	}
+	return conf, store, start.AddDate(0, 0, days)
+}
+
+func BenchmarkXIRR(b *testing.B) {
+	conf, _, now := syntheticPortfolio(b, 50, 20, 3*365)
+	var flows []cashFlow
+	for _, i := range conf.Investments {
+		flows = append(flows, cashFlow{i.Date, -i.Total.InexactFloat64()})
+	}
+	sort.Slice(flows, func(a, c int) bool { return flows[a].date.Before(flows[c].date) })
+	flows = append(flows, cashFlow{now, 1.3 * float64(len(flows)) * 1000})
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := xirr(flows); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkXIRRBisect(b *testing.B) {
+	flows := xirrTests[0].flows
+	for n := 0; n < b.N; n++ {
+		if _, err := xirrBisect(flows); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// allPortfolios names the combined view of every portfolio.
+const allPortfolios = "all"
+
+// portfolioName is set by -portfolio: the report then covers only the
+// investments of that portfolio and keeps its own history, and added
+// investments go into it. Empty or "all" is every investment.
+var portfolioName string
+
+func selectedPortfolio() string {
+	if portfolioName == allPortfolios {
+		return ""
+	}
+	return portfolioName
+}
+
+// validPortfolio checks that name can name a portfolio and its history
+// directory.
+func validPortfolio(name string) error {
+	if name == allPortfolios || name == "." || name == ".." {
+		return fmt.Errorf("%q cannot name a portfolio", name)
+	}
+	return nil
+}
+
+// inPortfolio returns conf with only the investments and sales of the
+// selected portfolio, or conf itself when none is selected. The result must
+// not be written back, as it would drop the other portfolios.
+func inPortfolio(conf config) (config, error) {
+	name := selectedPortfolio()
+	if name == "" {
+		return conf, nil
+	}
+	var investments []investment
+	for _, i := range conf.Investments {
+		if i.Portfolio == name {
+			investments = append(investments, i)
+		}
+	}
+	if len(investments) == 0 {
+		return conf, fmt.Errorf("no investments in portfolio %q", name)
+	}
+	var sales []sale
+	for _, s := range conf.Sales {
+		if len(s.Lots) > 0 && s.Lots[0].Portfolio == name {
+			sales = append(sales, s)
+		}
+	}
+	conf.Investments, conf.Sales = investments, sales
+	return conf, nil
+}
+
+// portfolioNames returns the named portfolios in conf, sorted.
+func portfolioNames(conf config) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, i := range conf.Investments {
+		if i.Portfolio != "" && !seen[i.Portfolio] {
+			seen[i.Portfolio] = true
+			names = append(names, i.Portfolio)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// portfolio returns the store keeping the history of the named portfolio,
+// under the portfolios directory of s.
+func (s historyStore) portfolio(name string) historyStore {
+	s.dir = filepath.Join(s.dir, "portfolios", url.PathEscape(name))
+	return s
+}
+
+// subtotal is what a group of lots, such as a portfolio, cost and is worth.
+type subtotal struct {
+	invested, value float64
+	flows           []cashFlow
+}
+
+// subtotals adds up the priced lots held at now by the groups groups puts
+// them in; a lot may be in several groups or none.
+func subtotals(ctx context.Context, conf config, store historyStore, latest map[string]performance, now time.Time, groups func(investment) []string) map[string]*subtotal {
+	totals := make(map[string]*subtotal)
+	for _, i := range conf.Investments {
+		p, ok := latest[i.Symbol]
+		if !ok || i.Date.After(now) {
+			continue
+		}
+		cost, err := lotCost(ctx, conf, store, i)
+		if err != nil {
+			continue // reported in the portfolio section
+		}
+		for _, g := range groups(i) {
+			t := totals[g]
+			if t == nil {
+				t = &subtotal{}
+				totals[g] = t
+			}
+			t.invested += cost
+			t.value += conf.toBase(i.Currency, i.Units.Mul(p.Price)).InexactFloat64()
+			t.flows = append(t.flows, cashFlow{i.Date, -cost})
+		}
+	}
+	return totals
+}
+
+// printSubtotal prints the line of one group of lots.
+func printSubtotal(w io.Writer, conf config, label string, t *subtotal, now time.Time) {
+	fmt.Fprintf(w, "%s: %s %.2f, %s %.2f, %s %+.2f (%+.2f%%), %s %s\n", label,
+		conf.tr("invested"), t.invested, conf.tr("value"), t.value,
+		conf.tr("gain"), t.value-t.invested, 100*(t.value-t.invested)/t.invested,
+		conf.tr("money-weighted return"), xirrString(conf, t.flows, now, t.value))
+}
+
+// printPortfolios prints the subtotals of each portfolio in the combined
+// view, lots in none of them under "unassigned".
+func printPortfolios(ctx context.Context, w io.Writer, conf config, store historyStore, latest map[string]performance, now time.Time) {
+	totals := subtotals(ctx, conf, store, latest, now, func(i investment) []string { return []string{i.Portfolio} })
+	if len(totals) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "=== %s ===\n", conf.tr("Portfolios"))
+	for _, name := range append(portfolioNames(conf), "") {
+		t := totals[name]
+		if t == nil || t.invested == 0 {
+			continue
+		}
+		label := name
+		if label == "" {
+			label = conf.tr("unassigned")
+		}
+		printSubtotal(w, conf, label, t, now)
+	}
+	fmt.Fprintf(w, "\n")
+}
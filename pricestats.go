@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// priceStats are the range and falls of a lot's price. Drawdowns are
+// percentages below the peak, 0 at a new high.
+type priceStats struct {
+	High52, Low52 decimal.Decimal
+	// Drawdown is how far the latest price is below the highest since the
+	// lot was bought, and MaxDrawdown the deepest fall from a peak since.
+	Drawdown, MaxDrawdown float64
+}
+
+// lotStats computes the price stats of v from the recorded history of its
+// symbol, oldest first. The 52-week range is the provider's when
+// fundamentals has it, since the history may not go back a year. It
+// reports false when no price was recorded since v was bought.
+func lotStats(v investment, history []performance, fundamentals map[string]summaryDetail, now time.Time) (priceStats, bool) {
+	var s priceStats
+	yearAgo := now.AddDate(-1, 0, 0)
+	var peak decimal.Decimal
+	held := false
+	for _, p := range history {
+		if !p.Price.IsPositive() {
+			continue
+		}
+		if !p.Date.Before(yearAgo) {
+			if s.High52.IsZero() || p.Price.GreaterThan(s.High52) {
+				s.High52 = p.Price
+			}
+			if s.Low52.IsZero() || p.Price.LessThan(s.Low52) {
+				s.Low52 = p.Price
+			}
+		}
+		if p.Date.Before(startOfDay(v.Date)) {
+			continue
+		}
+		held = true
+		if p.Price.GreaterThan(peak) {
+			peak = p.Price
+		}
+		s.Drawdown = 100 * (1 - p.Price.Div(peak).InexactFloat64())
+		if s.Drawdown > s.MaxDrawdown {
+			s.MaxDrawdown = s.Drawdown
+		}
+	}
+	if f, ok := fundamentals[v.Symbol]; ok && f.FiftyTwoWeekHigh.Raw > 0 {
+		s.High52 = decimal.NewFromFloat(f.FiftyTwoWeekHigh.Raw)
+		s.Low52 = decimal.NewFromFloat(f.FiftyTwoWeekLow.Raw)
+	}
+	return s, held
+}
+
+// statsLine shows s under a lot's heading.
+func statsLine(conf config, s priceStats) string {
+	return fmt.Sprintf("%s %s-%s | %s %.2f %% | %s %.2f %%", conf.tr("52w"), s.Low52.StringFixed(2), s.High52.StringFixed(2),
+		conf.tr("drawdown"), s.Drawdown, conf.tr("max drawdown since purchase"), s.MaxDrawdown)
+}
@@ -0,0 +1,21 @@
+package main
+
+import "testing"
+
+func BenchmarkLotStats(b *testing.B) {
+	conf, store, now := syntheticPortfolio(b, 50, 20, 3*365)
+	histories := make(map[string][]performance)
+	for _, s := range heldSymbols(conf) {
+		h, err := store.load(s)
+		if err != nil {
+			b.Fatal(err)
+		}
+		histories[s] = h
+	}
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		for _, i := range conf.Investments {
+			lotStats(i, histories[i.Symbol], nil, now)
+		}
+	}
+}
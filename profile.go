@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"time"
+)
+
+// prof collects per-phase timings when -profile is set and is nil otherwise.
+var prof *profiler
+
+type profiler struct {
+	start time.Time
+	order []string
+	took  map[string]time.Duration
+}
+
+// phase starts timing name and returns a func that stops it. Time spent in
+// a phase over several calls adds up.
+func (p *profiler) phase(name string) func() {
+	if p == nil {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		if _, ok := p.took[name]; !ok {
+			p.order = append(p.order, name)
+		}
+		p.took[name] += time.Since(start)
+	}
+}
+
+func (p *profiler) print(w io.Writer) {
+	for _, name := range p.order {
+		fmt.Fprintf(w, "%-12s %v\n", name, p.took[name])
+	}
+	fmt.Fprintf(w, "%-12s %v\n", "total", time.Since(p.start))
+}
+
+// startProfile starts a CPU profile in dir. The returned func stops it,
+// writes a heap profile next to it and prints the phase timings to stderr.
+func startProfile(dir string) (func() error, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	cpu, err := os.Create(filepath.Join(dir, "cpu.pprof"))
+	if err != nil {
+		return nil, err
+	}
+	if err := pprof.StartCPUProfile(cpu); err != nil {
+		cpu.Close()
+		return nil, err
+	}
+	prof = &profiler{start: time.Now(), took: make(map[string]time.Duration)}
+	return func() error {
+		pprof.StopCPUProfile()
+		cpu.Close()
+		prof.print(os.Stderr)
+
+		heap, err := os.Create(filepath.Join(dir, "heap.pprof"))
+		if err != nil {
+			return err
+		}
+		defer heap.Close()
+		runtime.GC()
+		return pprof.WriteHeapProfile(heap)
+	}, nil
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/doneland/yquotes"
+	"github.com/shopspring/decimal"
+)
+
+// quote is the latest price of a symbol.
+type quote struct {
+	Price         decimal.Decimal
+	PreviousClose decimal.Decimal
+	Time          time.Time
+	// Provider names the provider that supplied the quote.
+	Provider string
+}
+
+// quoteProvider is a source of latest prices.
+type quoteProvider interface {
+	price(ctx context.Context, symbol string) (quote, error)
+}
+
+// quotesConfig picks the quote provider and holds its credentials, which
+// resolve like the mailgun keys: from a file, the value with ${ENV}
+// references expanded, or the keyring entries "iex" and "alphavantage".
+type quotesConfig struct {
+	Provider string `json:"provider,omitempty"` // yahoo (default), iex or alphavantage
+	// Fallback are the providers tried in turn when the provider fails to
+	// price a symbol, e.g. ["iex", "alphavantage"].
+	Fallback            []string `json:"fallback,omitempty"`
+	IEXToken            string   `json:"iex_token,omitempty"`
+	IEXTokenFile        string   `json:"iex_token_file,omitempty"`
+	AlphaVantageKey     string   `json:"alphavantage_key,omitempty"`
+	AlphaVantageKeyFile string   `json:"alphavantage_key_file,omitempty"`
+	// PriceMode is which price is recorded while the market is open:
+	// "last" (default), the latest trade, or "close", the previous
+	// official close, which keeps intraday noise out of the history.
+	PriceMode string `json:"price_mode,omitempty"`
+	// Retry is how failed fetches are retried.
+	Retry retryConfig `json:"retry"`
+	// InactiveAfter is how many runs in a row a symbol may fail to be
+	// priced in, outages aside, before its lots are made inactive: 5 by
+	// default, and never when negative.
+	InactiveAfter int `json:"inactive_after,omitempty"`
+	// CacheTTL is how long a fetched quote is reused, e.g. "1h"; 15m by
+	// default and "0s" to always fetch. Daily prices of past days are
+	// cached for good.
+	CacheTTL string `json:"cache_ttl,omitempty"`
+}
+
+const defaultCacheTTL = 15 * time.Minute
+
+func (q quotesConfig) cacheTTL() (time.Duration, error) {
+	if q.CacheTTL == "" {
+		return defaultCacheTTL, nil
+	}
+	ttl, err := time.ParseDuration(q.CacheTTL)
+	if err != nil || ttl < 0 {
+		return 0, fmt.Errorf("quotes cache_ttl %q: want a duration such as 15m", q.CacheTTL)
+	}
+	return ttl, nil
+}
+
+// The types of price a performance entry records.
+const (
+	priceClose = "close"
+	priceLast  = "last"
+)
+
+// captured picks the price to record from a quote fetched at now, with the
+// time to record it under and its type. Outside market hours the latest
+// price is the close. In close mode while the market is open it is the
+// previous close, recorded at that close, unless the provider does not
+// give one.
+func (c config) captured(q priceResult, now time.Time) (decimal.Decimal, time.Time, string, error) {
+	open, err := c.Market.open(now)
+	if err != nil || !open {
+		return q.price, now, priceClose, err
+	}
+	if c.Quotes.PriceMode != priceClose || !q.previous.IsPositive() {
+		return q.price, now, priceLast, nil
+	}
+	t, err := c.Market.lastClose(now)
+	return q.previous, t, priceClose, err
+}
+
+// builtinProvider is a quote provider an investment can name as its
+// provider, for symbols the configured one cannot price. A plugin of the
+// same name is not used.
+type builtinProvider struct {
+	quoteProvider
+	// currency is what a symbol is priced in.
+	currency func(symbol string) string
+}
+
+var builtinProviders = map[string]builtinProvider{
+	"amfi":   {amfiProvider{}, func(string) string { return "INR" }},
+	"crypto": {cryptoProvider{}, cryptoCurrency},
+}
+
+// quoteSource is set by -provider and takes priority over the config.
+var quoteSource string
+
+// noCache is set by -no-cache: nothing is read from the cache, so every
+// quote is fetched afresh, though what is fetched is still cached.
+var noCache bool
+
+// quoteChain returns the names of the quote providers to try in order: the
+// one set by -provider or the config, then the fallbacks.
+func quoteChain(conf config) []string {
+	name := quoteSource
+	if name == "" {
+		name = conf.Quotes.Provider
+	}
+	if name == "" {
+		name = "yahoo"
+	}
+	chain := []string{name}
+	for _, f := range conf.Quotes.Fallback {
+		dup := false
+		for _, n := range chain {
+			dup = dup || n == f
+		}
+		if !dup {
+			chain = append(chain, f)
+		}
+	}
+	return chain
+}
+
+func newQuoteProvider(conf config, name string) (quoteProvider, error) {
+	switch name {
+	case "", "yahoo":
+		return yahooProvider{}, nil
+	case "iex":
+		token, err := secret("iex", conf.Quotes.IEXToken, conf.Quotes.IEXTokenFile)
+		if err != nil {
+			return nil, err
+		}
+		if token == "" {
+			return nil, errors.New("iex: no token configured")
+		}
+		return iexProvider{token: token}, nil
+	case "alphavantage":
+		key, err := secret("alphavantage", conf.Quotes.AlphaVantageKey, conf.Quotes.AlphaVantageKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if key == "" {
+			return nil, errors.New("alphavantage: no key configured")
+		}
+		return alphaVantageProvider{key: key}, nil
+	}
+	return nil, fmt.Errorf("unknown quote provider %q, want yahoo, iex or alphavantage", name)
+}
+
+type yahooProvider struct{}
+
+func (yahooProvider) price(ctx context.Context, symbol string) (quote, error) {
+	q, err := withContext(ctx, func() (*yquotes.Price, error) {
+		return yquotes.GetPrice(symbol)
+	})
+	if err != nil {
+		return quote{}, err
+	}
+	return quote{
+		Price:         decimal.NewFromFloat(q.Last),
+		PreviousClose: decimal.NewFromFloat(q.PreviousClose),
+		Time:          q.Date,
+	}, nil
+}
+
+// dailyHistory fetches the daily prices of symbol from Yahoo, through the
+// store's cache. Prices up to a day before today no longer change and are
+// kept for good; a range ending later is kept for the quote cache TTL.
+func dailyHistory(ctx context.Context, store historyStore, symbol string, from, to time.Time) ([]yquotes.PriceH, error) {
+	var prices []yquotes.PriceH
+	key := fmt.Sprintf("daily-%s-%s-%s", symbol, from.Format(isoDate), to.Format(isoDate))
+	ttl := time.Duration(math.MaxInt64)
+	if !to.Before(startOfDay(clock())) {
+		ttl = store.quoteTTL
+	}
+	if ttl > 0 {
+		fresh, err := store.loadCache(key, ttl, &prices)
+		if err != nil || fresh {
+			return prices, err
+		}
+	}
+	err := fetchRetry.do(ctx, "yahoo", func(ctx context.Context) (err error) {
+		prices, err = withContext(ctx, func() ([]yquotes.PriceH, error) {
+			return yquotes.GetDailyHistory(symbol, from, to)
+		})
+		return err
+	})
+	if err != nil || ttl == 0 {
+		return prices, err
+	}
+	return prices, store.saveCache(key, prices)
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+var quoteClient http.Client
+
+// getJSON decodes the JSON body of a GET of u into v. Client errors other
+// than rate limiting are permanent.
+func getJSON(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := quoteClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+		return permanentError{fmt.Errorf("%s", resp.Status)}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// iexProvider uses IEX Cloud.
+type iexProvider struct{ token string }
+
+func (p iexProvider) price(ctx context.Context, symbol string) (quote, error) {
+	var body struct {
+		LatestPrice   decimal.Decimal `json:"latestPrice"`
+		PreviousClose decimal.Decimal `json:"previousClose"`
+		LatestUpdate  int64           `json:"latestUpdate"` // Unix milliseconds
+	}
+	u := fmt.Sprintf("https://cloud.iexapis.com/stable/stock/%s/quote?token=%s", url.PathEscape(symbol), url.QueryEscape(p.token))
+	if err := getJSON(ctx, u, &body); err != nil {
+		return quote{}, fmt.Errorf("iex %s: %w", symbol, err)
+	}
+	return quote{
+		Price:         body.LatestPrice,
+		PreviousClose: body.PreviousClose,
+		Time:          time.Unix(0, body.LatestUpdate*int64(time.Millisecond)),
+	}, nil
+}
+
+// alphaVantageProvider uses Alpha Vantage's global quote.
+type alphaVantageProvider struct{ key string }
+
+func (p alphaVantageProvider) price(ctx context.Context, symbol string) (quote, error) {
+	var body struct {
+		Quote struct {
+			Price         string `json:"05. price"`
+			PreviousClose string `json:"08. previous close"`
+			Day           string `json:"07. latest trading day"`
+		} `json:"Global Quote"`
+		// Rate limits and bad symbols come back as a 200 with one of these.
+		Note  string `json:"Note"`
+		Info  string `json:"Information"`
+		Error string `json:"Error Message"`
+	}
+	u := fmt.Sprintf("https://www.alphavantage.co/query?function=GLOBAL_QUOTE&symbol=%s&apikey=%s", url.QueryEscape(symbol), url.QueryEscape(p.key))
+	if err := getJSON(ctx, u, &body); err != nil {
+		return quote{}, fmt.Errorf("alphavantage %s: %w", symbol, err)
+	}
+	// Notes and information are rate limits, which may pass.
+	if body.Error != "" {
+		return quote{}, permanentError{fmt.Errorf("alphavantage %s: %s", symbol, body.Error)}
+	}
+	for _, msg := range []string{body.Note, body.Info} {
+		if msg != "" {
+			return quote{}, fmt.Errorf("alphavantage %s: %s", symbol, msg)
+		}
+	}
+	price, err := decimal.NewFromString(body.Quote.Price)
+	if err != nil {
+		return quote{}, fmt.Errorf("alphavantage %s: no price", symbol)
+	}
+	prev, _ := decimal.NewFromString(body.Quote.PreviousClose)
+	day, _ := time.Parse(isoDate, body.Quote.Day)
+	return quote{Price: price, PreviousClose: prev, Time: day}, nil
+}
+
+// pluginProvider prices symbols with a quote plugin.
+type pluginProvider struct{ plugin }
+
+func (p pluginProvider) price(ctx context.Context, symbol string) (quote, error) {
+	// The plugin is killed when ctx is done, but anything it started may
+	// hold its output open, so do not wait for that either.
+	price, err := withContext(ctx, func() (decimal.Decimal, error) {
+		return p.quote(ctx, symbol)
+	})
+	return quote{Price: price, Time: clock()}, err
+}
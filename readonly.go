@@ -0,0 +1,14 @@
+package main
+
+import "errors"
+
+// readOnly is set by -read-only or by loading a config with read_only set.
+// It stays set for the rest of the process: nothing may then write a
+// config, audit log or history, or send a notification.
+var readOnly bool
+
+// dryRun is set by "report -dry-run": the report is fetched and analyzed
+// as usual, but what it would record or send is printed instead.
+var dryRun bool
+
+var errReadOnly = errors.New("read-only mode: nothing may be written or sent")
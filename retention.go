@@ -0,0 +1,169 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// retention is how finely old history is kept. Every day is kept for
+// DailyDays, then the last point of each week for WeeklyDays, then the last
+// point of each month.
+type retention struct {
+	// DailyDays defaults to 90.
+	DailyDays int `json:"daily_days,omitempty"`
+	// WeeklyDays of 0 keeps weekly points for good.
+	WeeklyDays int `json:"weekly_days,omitempty"`
+	// Manual stops compaction after each run; the compact command still
+	// compacts.
+	Manual bool `json:"manual,omitempty"`
+}
+
+func (r retention) validate() error {
+	if r.DailyDays < 0 || r.WeeklyDays < 0 {
+		return fmt.Errorf("retention: daily_days and weekly_days must not be negative")
+	}
+	return nil
+}
+
+// bucket names the period p is kept one point for, as of now.
+func (r retention) bucket(p performance, now time.Time) string {
+	daily := r.DailyDays
+	if daily == 0 {
+		daily = 90
+	}
+	age := now.Sub(p.Date)
+	switch {
+	case age < time.Duration(daily)*24*time.Hour:
+		return "d" + p.Date.Format(isoDate)
+	case r.WeeklyDays == 0 || age < time.Duration(daily+r.WeeklyDays)*24*time.Hour:
+		y, w := p.Date.ISOWeek()
+		return fmt.Sprintf("w%d-%02d", y, w)
+	}
+	return "m" + p.Date.Format("2006-01")
+}
+
+// symbols lists the symbols with a history file.
+func (s historyStore) symbols() ([]string, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var symbols []string
+	for _, f := range files {
+		name := f.Name()
+		if f.IsDir() || !strings.HasSuffix(name, ".jsonl") {
+			continue
+		}
+		symbol, err := url.PathUnescape(strings.TrimSuffix(name, ".jsonl"))
+		if err != nil {
+			continue
+		}
+		symbols = append(symbols, symbol)
+	}
+	sort.Strings(symbols)
+	return symbols, nil
+}
+
+// compact drops the points of symbol's history that r no longer keeps,
+// keeping the last point of each period, or under the keep-all policy
+// every point of the days kept in full. The history is streamed into a new
+// file that replaces the old one only if anything was dropped. It returns
+// how many points were kept and how many there were.
+func (s historyStore) compact(symbol string, r retention, policy string, now time.Time) (kept, total int, err error) {
+	if !s.writable() {
+		return 0, 0, errReadOnly
+	}
+	// in the same directory so the rename stays on one file system
+	tmp, err := ioutil.TempFile(s.dir, ".compact-")
+	if err != nil {
+		return 0, 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	enc := json.NewEncoder(tmp)
+	bucket := func(p performance) string {
+		b := r.bucket(p, now)
+		if policy == keepAll && strings.HasPrefix(b, "d") {
+			b += p.Date.Format(time.RFC3339Nano)
+		}
+		return b
+	}
+	// A point is kept when the next one falls in another period, so each
+	// is written once the one after it has been seen.
+	var pending *performance
+	err = s.each(symbol, func(p performance) error {
+		total++
+		if pending != nil && bucket(*pending) != bucket(p) {
+			kept++
+			if err := enc.Encode(pending); err != nil {
+				return err
+			}
+		}
+		pending = &p
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	if pending != nil {
+		kept++
+		if err := enc.Encode(pending); err != nil {
+			return 0, 0, err
+		}
+	}
+	if kept == total {
+		return kept, total, nil
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, 0, err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return 0, 0, err
+	}
+	return kept, total, os.Rename(tmp.Name(), s.path(symbol))
+}
+
+// compactAll compacts the history of every symbol to conf's retention and
+// the dedupe policy, writing a line to w for each one that shrank when w is
+// set.
+func (s historyStore) compactAll(w io.Writer, conf config, policy string, now time.Time) error {
+	symbols, err := s.symbols()
+	if err != nil {
+		return err
+	}
+	for _, symbol := range symbols {
+		kept, total, err := s.compact(symbol, conf.Retention, policy, now)
+		if err != nil {
+			return err
+		}
+		if w != nil && kept < total {
+			fmt.Fprintf(w, conf.tr("%s: kept %d of %d points")+"\n", symbol, kept, total)
+		}
+	}
+	return nil
+}
+
+// compactHistory handles "compact", applying the retention policy to the
+// whole history now rather than waiting for the next run.
+func compactHistory(w io.Writer, confFile string) error {
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	policy, err := historyPolicy(conf.HistoryDedupe)
+	if err != nil {
+		return err
+	}
+	store := newHistoryStore(confFile, conf)
+	return store.compactAll(w, conf, policy, clock())
+}
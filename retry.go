@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+// retryConfig is how fetches from quote providers are retried. Durations
+// are written as in Go, e.g. "500ms" or "2s".
+type retryConfig struct {
+	// Attempts is how many times a fetch is tried, 3 by default.
+	Attempts int `json:"attempts,omitempty"`
+	// Backoff is the wait before the first retry, doubling before each
+	// one after; 1s by default.
+	Backoff string `json:"backoff,omitempty"`
+	// Jitter is the fraction of each wait that is random, so runs failing
+	// together do not retry together; 0.5 by default.
+	Jitter *float64 `json:"jitter,omitempty"`
+	// Timeout bounds each attempt, 30s by default.
+	Timeout string `json:"timeout,omitempty"`
+}
+
+type retryPolicy struct {
+	attempts         int
+	backoff, timeout time.Duration
+	jitter           float64
+}
+
+var defaultRetry = retryPolicy{attempts: 3, backoff: time.Second, timeout: 30 * time.Second, jitter: 0.5}
+
+// fetchRetry is the policy of the config loaded last.
+var fetchRetry = defaultRetry
+
+func (c retryConfig) policy() (retryPolicy, error) {
+	p := defaultRetry
+	if c.Attempts < 0 {
+		return p, errors.New("retry: attempts must not be negative")
+	}
+	if c.Attempts > 0 {
+		p.attempts = c.Attempts
+	}
+	var err error
+	if c.Backoff != "" {
+		if p.backoff, err = time.ParseDuration(c.Backoff); err != nil {
+			return p, fmt.Errorf("retry backoff: %v", err)
+		}
+	}
+	if c.Timeout != "" {
+		if p.timeout, err = time.ParseDuration(c.Timeout); err != nil || p.timeout <= 0 {
+			return p, fmt.Errorf("retry timeout %q: want a positive duration", c.Timeout)
+		}
+	}
+	if c.Jitter != nil {
+		if *c.Jitter < 0 || *c.Jitter > 1 {
+			return p, errors.New("retry: jitter must be between 0 and 1")
+		}
+		p.jitter = *c.Jitter
+	}
+	return p, nil
+}
+
+// fetchError reports a fetch from a provider that failed on every attempt,
+// or on one whose failure retrying cannot fix.
+type fetchError struct {
+	Provider string
+	Attempts int
+	Err      error // of the last attempt
+}
+
+func (e *fetchError) Error() string {
+	if e.Attempts == 1 {
+		return fmt.Sprintf("%s: %v", e.Provider, e.Err)
+	}
+	return fmt.Sprintf("%s: failed %d times, last: %v", e.Provider, e.Attempts, e.Err)
+}
+
+func (e *fetchError) Unwrap() error { return e.Err }
+
+// permanentError marks a failure that would recur if retried, such as an
+// unknown symbol or a rejected key.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+
+func (e permanentError) Unwrap() error { return e.err }
+
+// do calls fetch from provider until it succeeds, up to p.attempts times,
+// each with its own timeout, backing off exponentially between attempts.
+// It gives up as soon as ctx is done.
+func (p retryPolicy) do(ctx context.Context, provider string, fetch func(ctx context.Context) error) error {
+	wait := p.backoff
+	for n := 1; ; n++ {
+		attempt, cancel := context.WithTimeout(ctx, p.timeout)
+		err := fetch(attempt)
+		if err != nil && attempt.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+			err = fmt.Errorf("timed out after %v", p.timeout)
+		}
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var perm permanentError
+		if n >= p.attempts || errors.As(err, &perm) {
+			return &fetchError{Provider: provider, Attempts: n, Err: err}
+		}
+		logDebug("fetch attempt failed, retrying", "provider", provider, "attempt", n, "error", err)
+		select {
+		case <-time.After(time.Duration(float64(wait) * (1 - p.jitter*rand.Float64()))):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		wait *= 2
+	}
+}
+
+// withContext runs fn, which cannot be cancelled, giving up on it when ctx
+// is done first. fn is left to finish in the background, and since its
+// result comes back only through here, one given up on cannot write into
+// the caller's variables when it does.
+func withContext[T any](ctx context.Context, fn func() (T, error)) (T, error) {
+	type result struct {
+		v   T
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		v, err := fn()
+		done <- result{v, err}
+	}()
+	select {
+	case r := <-done:
+		return r.v, r.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
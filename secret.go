@@ -0,0 +1,224 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+)
+
+const keyringService = "stockstalk"
+
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// secret resolves the credential called name from its config value and the
+// matching *_file path. The file wins when set; otherwise ${ENV_VAR}
+// references in the value are expanded. When neither is configured the OS
+// keyring is consulted. Secrets are resolved at use, never at load, so
+// writeConfig cannot persist them in plaintext.
+func secret(name, value, file string) (string, error) {
+	if file != "" {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(b)), nil
+	}
+	if value != "" {
+		return interpolateEnv(value)
+	}
+	s, err := keyring.Get(keyringService, name)
+	if err == keyring.ErrNotFound {
+		return "", nil
+	}
+	return s, err
+}
+
+// interpolateEnv replaces ${ENV_VAR} references with their values. Unlike
+// os.ExpandEnv a bare $ is left alone, and unset variables are an error
+// rather than silently becoming empty credentials.
+func interpolateEnv(s string) (string, error) {
+	var missing []string
+	out := envRef.ReplaceAllStringFunc(s, func(ref string) string {
+		name := envRef.FindStringSubmatch(ref)[1]
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			missing = append(missing, name)
+		}
+		return v
+	})
+	if len(missing) > 0 {
+		return "", fmt.Errorf("environment variable %s not set", strings.Join(missing, ", "))
+	}
+	return out, nil
+}
+
+const authUsage = "usage: stockstalk auth set|delete <name> (names: mailgun, mailgun-public, api, config, sheets)"
+
+// auth manages secrets in the OS keyring. The value for "set" is read from
+// stdin so it never shows up in shell history or the process list.
+func auth(args []string) error {
+	if len(args) != 2 {
+		return errors.New(authUsage)
+	}
+	name := args[1]
+	switch args[0] {
+	case "set":
+		fmt.Fprintf(os.Stderr, "%s secret: ", name)
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return err
+		}
+		v := strings.TrimSpace(line)
+		if v == "" {
+			return errors.New("empty secret")
+		}
+		return keyring.Set(keyringService, name, v)
+	case "delete":
+		return keyring.Delete(keyringService, name)
+	}
+	return errors.New(authUsage)
+}
+
+// The environment variables overriding the Mailgun config. MAILGUN_TO is a
+// comma-separated list.
+const (
+	envMailgunAPIKey       = "MAILGUN_API_KEY"
+	envMailgunPublicAPIKey = "MAILGUN_PUBLIC_API_KEY"
+	envMailgunDomain       = "MAILGUN_DOMAIN"
+	envMailgunFrom         = "MAILGUN_FROM"
+	envMailgunTo           = "MAILGUN_TO"
+)
+
+// mailgunAccount is a mailgunConfig with its secrets resolved and the
+// environment applied.
+type mailgunAccount struct {
+	apiKey, publicAPIKey, domain, from string
+	to                                 []string
+}
+
+func (mc mailgunConfig) account() (mailgunAccount, error) {
+	var a mailgunAccount
+	var err error
+	if a.apiKey = os.Getenv(envMailgunAPIKey); a.apiKey == "" {
+		if a.apiKey, err = secret("mailgun", mc.APIKey, mc.APIKeyFile); err != nil {
+			return a, fmt.Errorf("mailgun api key: %v", err)
+		}
+	}
+	if a.publicAPIKey = os.Getenv(envMailgunPublicAPIKey); a.publicAPIKey == "" {
+		if a.publicAPIKey, err = secret("mailgun-public", mc.PublicAPIKey, mc.PublicAPIKeyFile); err != nil {
+			return a, fmt.Errorf("mailgun public api key: %v", err)
+		}
+	}
+	a.domain, a.from, a.to = mc.Domain, mc.From, mc.To
+	if v := os.Getenv(envMailgunDomain); v != "" {
+		a.domain = v
+	}
+	if v := os.Getenv(envMailgunFrom); v != "" {
+		a.from = v
+	}
+	if v := os.Getenv(envMailgunTo); v != "" {
+		a.to = nil
+		for _, t := range strings.Split(v, ",") {
+			if t = strings.TrimSpace(t); t != "" {
+				a.to = append(a.to, t)
+			}
+		}
+	}
+	return a, nil
+}
+
+// missing lists what the account lacks to send, and the recipients too
+// when needTo is set, naming where each can be given.
+func (a mailgunAccount) missing(needTo bool) []string {
+	var m []string
+	if a.apiKey == "" {
+		m = append(m, "notifications.mailgun.api_key (or "+envMailgunAPIKey+", or auth set mailgun)")
+	}
+	if a.domain == "" {
+		m = append(m, "notifications.mailgun.domain (or "+envMailgunDomain+")")
+	}
+	if a.from == "" {
+		m = append(m, "notifications.mailgun.from (or "+envMailgunFrom+")")
+	}
+	if needTo && len(a.to) == 0 {
+		m = append(m, "notifications.mailgun.to (or "+envMailgunTo+")")
+	}
+	return m
+}
+
+func missingCredentials(missing []string) error {
+	return fmt.Errorf("missing credentials:\n  %s", strings.Join(missing, "\n  "))
+}
+
+// checkCredentials makes sure every notification channel and the daemon's
+// failure alerts can be sent and the Sheets export signed in, so a run
+// fails at the start rather than after fetching every quote. All missing
+// credentials are listed at once.
+func checkCredentials(conf config) error {
+	var missing []string
+	seen := make(map[string]bool)
+	add := func(m ...string) {
+		for _, s := range m {
+			if !seen[s] {
+				seen[s] = true
+				missing = append(missing, s)
+			}
+		}
+	}
+	mailgun := func(needTo bool) error {
+		a, err := conf.Notifications.Mailgun.account()
+		if err != nil {
+			return err
+		}
+		add(a.missing(needTo)...)
+		return nil
+	}
+	for k, c := range conf.Notifications.channels() {
+		switch c.Type {
+		case "mailgun":
+			if err := mailgun(len(c.To) == 0); err != nil {
+				return err
+			}
+		case "slack", "webhook":
+			u, err := secret(c.keyringName(), c.URL, c.URLFile)
+			if err != nil {
+				return fmt.Errorf("%s: %v", c.keyringName(), err)
+			}
+			if u == "" {
+				add(fmt.Sprintf("notifications.channels[%d].url (or url_file, or auth set %s)", k, c.keyringName()))
+			}
+		case "telegram":
+			token, err := secret(c.keyringName(), c.BotToken, c.BotTokenFile)
+			if err != nil {
+				return fmt.Errorf("%s: %v", c.keyringName(), err)
+			}
+			if token == "" {
+				add(fmt.Sprintf("notifications.channels[%d].bot_token (or bot_token_file, or auth set %s)", k, c.keyringName()))
+			}
+		}
+	}
+	if len(conf.Notifications.Alerts.To) > 0 {
+		if err := mailgun(false); err != nil {
+			return err
+		}
+	}
+	if conf.Sheets.SpreadsheetID != "" {
+		s, err := secret("sheets", conf.Sheets.Credentials, conf.Sheets.CredentialsFile)
+		if err != nil {
+			return fmt.Errorf("sheets: %v", err)
+		}
+		if s == "" {
+			add(sheetsMissing)
+		}
+	}
+	if len(missing) > 0 {
+		return missingCredentials(missing)
+	}
+	return nil
+}
@@ -0,0 +1,449 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// reportConfig turns optional report sections on. Each one costs extra
+// requests per symbol, so they are off by default.
+type reportConfig struct {
+	Earnings bool `json:"earnings,omitempty"`
+	// News is the number of headlines to show per holding, taken from
+	// NewsFeed: an RSS URL with {symbol} in place of the symbol, Yahoo
+	// Finance's feed by default.
+	News     int    `json:"news,omitempty"`
+	NewsFeed string `json:"news_feed,omitempty"`
+	// Analysts shows consensus ratings and price targets, refreshed weekly.
+	Analysts bool `json:"analysts,omitempty"`
+	// ESG shows sustainability risk scores per holding and weighted by value
+	// for the portfolio, refreshed weekly.
+	ESG bool `json:"esg,omitempty"`
+	// Insiders lists open-market insider buys and sells worth at least
+	// InsiderMinValue (default 100000) filed in the last 30 days.
+	Insiders        bool    `json:"insiders,omitempty"`
+	InsiderMinValue float64 `json:"insider_min_value,omitempty"`
+	// Fundamentals adds P/E, market cap, dividend yield and beta to each
+	// holding, refreshed daily.
+	Fundamentals bool `json:"fundamentals,omitempty"`
+	// Fees shows each fund's expense ratio, what it costs a year at the
+	// current value, and the portfolio's value-weighted expense ratio.
+	Fees bool `json:"fees,omitempty"`
+	// Currency shows the share of the portfolio in each currency, converted
+	// to BaseCurrency, and the effect of foreign currencies moving against
+	// it, to judge whether hedging is worth it. BaseCurrency (default USD)
+	// is also what lots held in another currency are totalled in.
+	Currency     bool   `json:"currency,omitempty"`
+	BaseCurrency string `json:"base_currency,omitempty"`
+	// TaxLoss lists lots with an unrealized loss of at least TaxLossMin,
+	// the tax a sale would save at TaxRate percent, and when the symbol can
+	// be bought back without a wash sale. TaxRate also estimates the tax
+	// on distributions.
+	TaxLoss    bool    `json:"tax_loss,omitempty"`
+	TaxLossMin float64 `json:"tax_loss_min,omitempty"`
+	TaxRate    float64 `json:"tax_rate,omitempty"`
+	// Benchmark, e.g. "SPY", compares each lot and the portfolio with
+	// having bought it instead on the same days.
+	Benchmark string `json:"benchmark,omitempty"`
+	// Template and HTMLTemplate are files of Go text/template and
+	// html/template, relative to the config file, that the plain text and
+	// HTML reports are rendered with instead of the built-in ones. They are
+	// executed with a reportData.
+	Template     string `json:"template,omitempty"`
+	HTMLTemplate string `json:"html_template,omitempty"`
+}
+
+// printSections writes the portfolio summary and the optional report
+// sections enabled in conf. Data that cannot be fetched is noted in its
+// section rather than failing the report.
+func printSections(ctx context.Context, w io.Writer, conf config, store historyStore, latest map[string]performance, now time.Time) {
+	if conf.Notifications.frequency() != frequencyDaily {
+		printDigest(ctx, w, conf, store, latest, now)
+	}
+	printPortfolio(ctx, w, conf, store, latest, now)
+	if selectedPortfolio() == "" && len(portfolioNames(conf)) > 0 {
+		printPortfolios(ctx, w, conf, store, latest, now)
+	}
+	if len(tagNames(conf)) > 0 {
+		printTags(ctx, w, conf, store, latest, now)
+	}
+	if len(conf.Goals) > 0 {
+		printGoals(ctx, w, conf, store, latest, now)
+	}
+	if len(conf.Assets) > 0 {
+		printNetWorth(w, conf, store, latest, now)
+	}
+	if len(conf.Vests) > 0 {
+		printVests(w, conf, latest, now)
+	}
+	if conf.Report.Earnings {
+		printEarnings(ctx, w, conf, now)
+	}
+	if conf.Report.News > 0 {
+		printNews(ctx, w, conf)
+	}
+	if conf.Report.Analysts {
+		printAnalysts(ctx, w, conf, store, latest)
+	}
+	if conf.Report.ESG {
+		printESG(ctx, w, conf, store, latest)
+	}
+	if conf.Report.Insiders {
+		printInsiders(ctx, w, conf, store, now)
+	}
+	if conf.Report.Fees {
+		printFees(ctx, w, conf, store, latest)
+	}
+	if conf.Report.Currency {
+		printCurrencyExposure(ctx, w, conf, store, latest)
+	}
+	if conf.Report.TaxLoss {
+		printTaxLoss(w, conf, latest, now)
+	}
+	if len(conf.Sales) > 0 {
+		printClosedPositions(ctx, w, conf, store, latest, now)
+	}
+	if conf.Report.Benchmark != "" {
+		printBenchmark(ctx, w, conf, store, latest, now)
+	}
+	if len(conf.Allocation.Targets) > 0 {
+		printAllocation(w, conf, store, latest)
+	}
+	for _, i := range conf.Investments {
+		if i.Inactive != nil {
+			printInactive(w, conf)
+			break
+		}
+	}
+	if len(conf.Watchlist) > 0 {
+		printWatchlist(ctx, w, conf, store, now)
+	}
+	printScreener(ctx, w, conf)
+}
+
+// heldSymbols returns each symbol in the portfolio once, in config order.
+func heldSymbols(conf config) []string {
+	var symbols []string
+	seen := make(map[string]bool)
+	for _, i := range conf.Investments {
+		if !seen[i.Symbol] {
+			seen[i.Symbol] = true
+			symbols = append(symbols, i.Symbol)
+		}
+	}
+	return symbols
+}
+
+// watchedSymbols returns heldSymbols followed by the watched symbols not
+// held, each once.
+func watchedSymbols(conf config) []string {
+	symbols := heldSymbols(conf)
+	seen := make(map[string]bool)
+	for _, s := range symbols {
+		seen[s] = true
+	}
+	for _, w := range conf.Watchlist {
+		if !seen[w.Symbol] {
+			seen[w.Symbol] = true
+			symbols = append(symbols, w.Symbol)
+		}
+	}
+	return symbols
+}
+
+func printEarnings(ctx context.Context, w io.Writer, conf config, now time.Time) {
+	type earnings struct {
+		symbol string
+		date   time.Time
+	}
+	var upcoming []earnings
+	fmt.Fprintf(w, "=== %s ===\n", conf.tr("Upcoming earnings"))
+	for _, s := range watchedSymbols(conf) {
+		qs, err := fetchQuoteSummary(ctx, s, "calendarEvents")
+		if err != nil {
+			fmt.Fprintf(w, "%s %s: %v\n", s, conf.tr("unavailable"), err)
+			continue
+		}
+		for _, d := range qs.CalendarEvents.Earnings.EarningsDate {
+			if t := d.time(); t.After(now) {
+				upcoming = append(upcoming, earnings{s, t})
+				break
+			}
+		}
+	}
+	sort.Slice(upcoming, func(i, j int) bool {
+		return upcoming[i].date.Before(upcoming[j].date)
+	})
+	for _, e := range upcoming {
+		fmt.Fprintf(w, "%s %s\n", e.date.Format(humanDate), e.symbol)
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+const yahooNewsFeed = "https://feeds.finance.yahoo.com/rss/2.0/headline?s={symbol}&region=US&lang=en-US"
+
+func printNews(ctx context.Context, w io.Writer, conf config) {
+	feed := conf.Report.NewsFeed
+	if feed == "" {
+		feed = yahooNewsFeed
+	}
+	fmt.Fprintf(w, "=== %s ===\n", conf.tr("News"))
+	for _, s := range heldSymbols(conf) {
+		items, err := fetchHeadlines(ctx, strings.Replace(feed, "{symbol}", url.QueryEscape(s), -1))
+		if err != nil {
+			fmt.Fprintf(w, "%s %s: %v\n", s, conf.tr("unavailable"), err)
+			continue
+		}
+		if len(items) == 0 {
+			continue
+		}
+		if len(items) > conf.Report.News {
+			items = items[:conf.Report.News]
+		}
+		fmt.Fprintf(w, "%s\n", s)
+		for _, it := range items {
+			fmt.Fprintf(w, "  %s\n  %s\n", strings.TrimSpace(it.Title), strings.TrimSpace(it.Link))
+		}
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+// weeklyRefresh is how long slow-moving data such as analyst ratings is
+// cached, to stay within free API quotas.
+const weeklyRefresh = 7 * 24 * time.Hour
+
+// cachedSummary returns the quoteSummary module for symbol, from the store's
+// cache while it is younger than ttl.
+func cachedSummary(ctx context.Context, store historyStore, symbol, module string, ttl time.Duration) (quoteSummary, error) {
+	var qs quoteSummary
+	key := module + "-" + symbol
+	fresh, err := store.loadCache(key, ttl, &qs)
+	if err != nil || fresh {
+		return qs, err
+	}
+	qs, err = fetchQuoteSummary(ctx, symbol, module)
+	if err != nil {
+		return qs, err
+	}
+	return qs, store.saveCache(key, qs)
+}
+
+// holdingValues returns the market value of each held symbol at the prices
+// in latest, summed over its lots, in the base currency.
+func holdingValues(conf config, latest map[string]performance) map[string]decimal.Decimal {
+	values := make(map[string]decimal.Decimal)
+	for _, i := range conf.Investments {
+		if p, ok := latest[i.Symbol]; ok {
+			values[i.Symbol] = values[i.Symbol].Add(conf.toBase(i.Currency, i.Units.Mul(p.Price)))
+		}
+	}
+	return values
+}
+
+func printAnalysts(ctx context.Context, w io.Writer, conf config, store historyStore, latest map[string]performance) {
+	fmt.Fprintf(w, "=== %s ===\n", conf.tr("Analyst ratings"))
+	for _, s := range heldSymbols(conf) {
+		qs, err := cachedSummary(ctx, store, s, "financialData", weeklyRefresh)
+		if err != nil {
+			fmt.Fprintf(w, "%s %s: %v\n", s, conf.tr("unavailable"), err)
+			continue
+		}
+		fd := qs.FinancialData
+		if fd.NumberOfAnalystOpinions.Raw == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%s %s (%.1f, %d %s) %s %.2f",
+			s, fd.RecommendationKey, fd.RecommendationMean.Raw, int(fd.NumberOfAnalystOpinions.Raw), conf.tr("analysts"),
+			conf.tr("target"), fd.TargetMeanPrice.Raw)
+		if p, ok := latest[s]; ok && p.Price.IsPositive() {
+			price := p.Price.InexactFloat64()
+			fmt.Fprintf(w, ", %s %.2f, %s %.1f%%", conf.tr("price"), price, conf.tr("upside"), 100*(fd.TargetMeanPrice.Raw/price-1))
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+func printESG(ctx context.Context, w io.Writer, conf config, store historyStore, latest map[string]performance) {
+	fmt.Fprintf(w, "=== %s ===\n", conf.tr("ESG risk (lower is better)"))
+	values := holdingValues(conf, latest)
+	var weighted, total float64
+	for _, s := range heldSymbols(conf) {
+		qs, err := cachedSummary(ctx, store, s, "esgScores", weeklyRefresh)
+		if err != nil {
+			fmt.Fprintf(w, "%s %s: %v\n", s, conf.tr("unavailable"), err)
+			continue
+		}
+		esg := qs.ESGScores
+		if esg.TotalESG.Raw == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%s %.1f (E %.1f S %.1f G %.1f)\n", s, esg.TotalESG.Raw,
+			esg.EnvironmentScore.Raw, esg.SocialScore.Raw, esg.GovernanceScore.Raw)
+		v := values[s].InexactFloat64()
+		weighted += v * esg.TotalESG.Raw
+		total += v
+	}
+	if total > 0 {
+		fmt.Fprintf(w, "%s %.1f\n", conf.tr("Portfolio"), weighted/total)
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+// insiderCluster is how many distinct insiders selling within the window
+// gets called out as a cluster.
+const insiderCluster = 3
+
+func printInsiders(ctx context.Context, w io.Writer, conf config, store historyStore, now time.Time) {
+	minValue := conf.Report.InsiderMinValue
+	if minValue == 0 {
+		minValue = 100000
+	}
+	since := now.AddDate(0, 0, -30)
+	fmt.Fprintf(w, "=== %s ===\n", conf.tr("Insider transactions (30 days)"))
+	for _, s := range heldSymbols(conf) {
+		qs, err := cachedSummary(ctx, store, s, "insiderTransactions", 24*time.Hour)
+		if err != nil {
+			fmt.Fprintf(w, "%s %s: %v\n", s, conf.tr("unavailable"), err)
+			continue
+		}
+		sellers := make(map[string]bool)
+		for _, t := range qs.InsiderTransactions.Transactions {
+			if t.StartDate.time().Before(since) {
+				continue
+			}
+			var kind string
+			switch {
+			case strings.Contains(t.TransactionText, "Sale"):
+				kind = conf.tr("sold")
+				sellers[t.FilerName] = true
+			case strings.Contains(t.TransactionText, "Purchase"):
+				kind = conf.tr("bought")
+			default:
+				continue
+			}
+			if t.Value.Raw < minValue {
+				continue
+			}
+			fmt.Fprintf(w, "%s %s %s (%s) %s %.0f %s %.0f\n", t.StartDate.time().Format(humanDate), s,
+				t.FilerName, t.FilerRelation, kind, t.Shares.Raw, conf.tr("shares worth"), t.Value.Raw)
+		}
+		if len(sellers) >= insiderCluster {
+			fmt.Fprintf(w, "%s: "+conf.tr("%d insiders sold")+"\n", s, len(sellers))
+		}
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+// expenseRatio returns the annual expense ratio of symbol in percent, from
+// the config or Yahoo's fund profile, or 0 if it is not a fund.
+func expenseRatio(ctx context.Context, conf config, store historyStore, symbol string) (float64, error) {
+	if r, ok := conf.ExpenseRatios[symbol]; ok {
+		return r, nil
+	}
+	qs, err := cachedSummary(ctx, store, symbol, "fundProfile", weeklyRefresh)
+	if err != nil {
+		return 0, err
+	}
+	return 100 * qs.FundProfile.FeesExpensesInvestment.AnnualReportExpenseRatio.Raw, nil
+}
+
+func printFees(ctx context.Context, w io.Writer, conf config, store historyStore, latest map[string]performance) {
+	fmt.Fprintf(w, "=== %s ===\n", conf.tr("Fund fees"))
+	values := holdingValues(conf, latest)
+	var cost, total float64
+	for _, s := range heldSymbols(conf) {
+		v := values[s].InexactFloat64()
+		total += v
+		r, err := expenseRatio(ctx, conf, store, s)
+		if err != nil {
+			fmt.Fprintf(w, "%s %s: %v\n", s, conf.tr("unavailable"), err)
+			continue
+		}
+		if r == 0 {
+			continue
+		}
+		fmt.Fprintf(w, "%s %.2f%%, %.2f %s\n", s, r, v*r/100, conf.tr("a year"))
+		cost += v * r / 100
+	}
+	if total > 0 {
+		fmt.Fprintf(w, "%s %.2f %s, %s %.3f%%\n", conf.tr("Portfolio"), cost, conf.tr("a year"),
+			conf.tr("weighted expense ratio"), 100*cost/total)
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+// washSaleDays is how long before or after a loss sale buying the same
+// symbol disallows the loss.
+const washSaleDays = 30
+
+func printTaxLoss(w io.Writer, conf config, latest map[string]performance, now time.Time) {
+	fmt.Fprintf(w, "=== %s (%s %g%%) ===\n", conf.tr("Tax-loss harvesting"), conf.tr("tax rate"), conf.Report.TaxRate)
+	found := false
+	for _, i := range conf.Investments {
+		p, ok := latest[i.Symbol]
+		if !ok || i.Date.After(now) {
+			continue
+		}
+		loss := i.basis().Sub(i.Units.Mul(p.Price)).InexactFloat64()
+		if loss <= 0 || loss < conf.Report.TaxLossMin {
+			continue
+		}
+		found = true
+		fmt.Fprintf(w, "%s %s %s %.2f, %s %.2f; %s %s", i.Symbol, i.Date.Format(humanDate), conf.tr("loss"), loss,
+			conf.tr("saves"), loss*conf.Report.TaxRate/100, conf.tr("buy back after"),
+			now.AddDate(0, 0, washSaleDays).Format(humanDate))
+		// A purchase of the symbol in the last 30 days would already wash
+		// a sale made today.
+		var recent time.Time
+		for _, o := range conf.Investments {
+			if o.Symbol == i.Symbol && !o.Date.After(now) && now.Sub(o.Date) < washSaleDays*24*time.Hour && o.Date.After(recent) {
+				recent = o.Date
+			}
+		}
+		if !recent.IsZero() {
+			sellAfter := recent.AddDate(0, 0, washSaleDays)
+			fmt.Fprintf(w, " (%s %s, %s %s)", conf.tr("last bought"), recent.Format(humanDate), conf.tr("sell after"), sellAfter.Format(humanDate))
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	if !found {
+		fmt.Fprintln(w, conf.tr("no losses to harvest"))
+	}
+}
+
+// fetchFundamentals returns valuation figures for each held symbol. Symbols
+// that cannot be fetched are reported on stderr and left out.
+func fetchFundamentals(ctx context.Context, conf config, store historyStore) map[string]summaryDetail {
+	fundamentals := make(map[string]summaryDetail)
+	for _, s := range heldSymbols(conf) {
+		qs, err := cachedSummary(ctx, store, s, "summaryDetail", 24*time.Hour)
+		if err != nil {
+			perr(err)
+			continue
+		}
+		fundamentals[s] = qs.SummaryDetail
+	}
+	return fundamentals
+}
+
+// humanizeNumber abbreviates large numbers, e.g. 2.91T or 350.2B.
+func humanizeNumber(n float64) string {
+	for _, u := range []struct {
+		scale  float64
+		suffix string
+	}{{1e12, "T"}, {1e9, "B"}, {1e6, "M"}, {1e3, "K"}} {
+		if math.Abs(n) >= u.scale {
+			return fmt.Sprintf("%.2f%s", n/u.scale, u.suffix)
+		}
+	}
+	return fmt.Sprintf("%.0f", n)
+}
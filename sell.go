@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// sale records units sold out of the portfolio. Lots are the parts of the
+// lots they came from, oldest first, with their dates and share of the
+// cost, so the realized gain and holding period survive the sale.
+type sale struct {
+	Symbol   string          `json:"symbol"`
+	Date     time.Time       `json:"date"`
+	Units    decimal.Decimal `json:"units"`
+	Proceeds decimal.Decimal `json:"proceeds"`
+	Lots     []investment    `json:"lots"`
+}
+
+func (s sale) cost() decimal.Decimal {
+	var c decimal.Decimal
+	for _, l := range s.Lots {
+		c = c.Add(l.basis())
+	}
+	return c
+}
+
+// sellLots takes units of symbol out of conf's lots bought on or before
+// date, oldest first, and records the sale.
+func sellLots(conf *config, symbol string, units, proceeds decimal.Decimal, date time.Time) (sale, error) {
+	kept, taken, err := takeLots(conf.Investments, func(i investment) bool {
+		return i.Symbol == symbol && !i.Date.After(date)
+	}, units)
+	if err != nil {
+		return sale{}, fmt.Errorf("%s: %v", symbol, err)
+	}
+	s := sale{Symbol: symbol, Date: date, Units: units, Proceeds: proceeds, Lots: taken}
+	conf.Investments = kept
+	conf.Sales = append(conf.Sales, s)
+	return s, nil
+}
+
+// sell handles "sell SYMBOL UNITS PROCEEDS", selling the oldest lots first.
+func sell(w io.Writer, confFile string, args []string, date string) error {
+	if len(args) != 3 {
+		return errUsage
+	}
+	symbol := strings.ToUpper(args[0])
+	units, err := decimal.NewFromString(args[1])
+	if err != nil {
+		return err
+	}
+	proceeds, err := decimal.NewFromString(args[2])
+	if err != nil {
+		return err
+	}
+	if !units.IsPositive() || proceeds.IsNegative() {
+		return fmt.Errorf("units must be positive and proceeds not negative")
+	}
+	t := clock()
+	if date != "" {
+		if t, err = time.Parse(mmddyy, date); err != nil {
+			return err
+		}
+	}
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	s, err := sellLots(&conf, symbol, units, proceeds, t)
+	if err != nil {
+		return err
+	}
+	if err := writeConfig(confFile, conf); err != nil {
+		return err
+	}
+	detail := fmt.Sprintf(conf.tr("sold %s %s for %s, realized %s"), units, symbol, proceeds.StringFixed(2),
+		proceeds.Sub(s.cost()).StringFixed(2))
+	fmt.Fprintln(w, detail)
+	return appendAudit(confFile, auditEntry{Action: "sell", Detail: detail})
+}
+
+// printClosedPositions lists the sales with their realized gains and
+// totals them against the unrealized gain of the lots still held.
+func printClosedPositions(ctx context.Context, w io.Writer, conf config, store historyStore, latest map[string]performance, now time.Time) {
+	fmt.Fprintf(w, "=== %s ===\n", conf.tr("Closed positions"))
+	var realized float64
+	for _, s := range conf.Sales {
+		if s.Date.After(now) {
+			continue
+		}
+		gain := s.Proceeds.Sub(s.cost())
+		realized += conf.toBase(currencyOf(s.Lots), gain).InexactFloat64()
+		fmt.Fprintf(w, "%s %s %s %s, %s %s, %s %s, %s %s\n", s.Date.Format(humanDate), s.Symbol, s.Units, conf.tr("units"),
+			conf.tr("cost"), s.cost().StringFixed(2), conf.tr("proceeds"), s.Proceeds.StringFixed(2), conf.tr("realized"), gain.StringFixed(2))
+	}
+	var unrealized float64
+	for _, i := range conf.Investments {
+		p, ok := latest[i.Symbol]
+		if !ok || i.Date.After(now) {
+			continue
+		}
+		cost, err := lotCost(ctx, conf, store, i)
+		if err != nil {
+			continue
+		}
+		unrealized += conf.toBase(i.Currency, i.Units.Mul(p.Price)).InexactFloat64() - cost
+	}
+	fmt.Fprintf(w, "%s %.2f, %s %.2f\n\n", conf.tr("realized"), realized, conf.tr("unrealized"), unrealized)
+}
+
+// currencyOf is the currency lots taken from one symbol were held in.
+func currencyOf(lots []investment) string {
+	if len(lots) == 0 {
+		return ""
+	}
+	return lots[0].Currency
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"html/template"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// dashboardChart sizes the history chart on a symbol's page.
+const (
+	dashboardChartWidth  = 720
+	dashboardChartHeight = 300
+)
+
+// pageText translates the text of a page to the config's language.
+type pageText struct{ conf config }
+
+func (p pageText) T(s string) string { return p.conf.tr(s) }
+
+type dashboardLot struct {
+	investment
+	Price, Value decimal.Decimal
+	Priced       bool
+	// Rate is the lot's own compound interest; the history records the
+	// rate of the symbol's last lot.
+	Rate      float64
+	Sparkline template.HTML
+}
+
+var dashboardFuncs = template.FuncMap{
+	"day":   func(t time.Time) string { return t.Format(humanDate) },
+	"rate":  func(r float64) string { return fmt.Sprintf("%.2f %%", r) },
+	"up":    func(r float64) bool { return r >= 0 },
+	"money": func(d decimal.Decimal) string { return d.StringFixed(2) },
+	"path":  url.PathEscape,
+}
+
+const dashboardStyle = `<style>
+body{font-family:sans-serif;font-size:14px;max-width:960px;margin:auto;padding:8px}
+table{border-collapse:collapse}td,th{padding:4px 8px;border-bottom:1px solid #ddd}
+td.n{text-align:right}.up{color:#1a7f37}.down{color:#cf222e}.err{color:#cf222e}
+</style>`
+
+var dashboardPage = template.Must(template.New("dashboard").Funcs(dashboardFuncs).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width"><title>stockstalk</title>` + dashboardStyle + `</head>
+<body>
+<h1>{{.T "Portfolio"}}</h1>
+{{if .Error}}<p class="err">{{.Error}}</p>{{end}}
+<table>
+<tr><th>{{.T "Symbol"}}</th><th>{{.T "Bought"}}</th><th>{{.T "Account"}}</th><th>{{.T "Units"}}</th><th>{{.T "Cost"}}</th><th>{{.T "Price"}}</th><th>{{.T "Value"}}</th><th>{{.T "Return"}}</th><th></th></tr>
+{{range .Lots}}<tr>
+<td><a href="/symbol/{{path .Symbol}}">{{.Symbol}}</a></td><td>{{day .Date}}</td><td>{{.Account}}</td><td class="n">{{.Units}}</td><td class="n">{{money .Total}} {{.Currency}}</td>
+{{if .Priced}}<td class="n">{{money .Price}}</td><td class="n">{{money .Value}}</td><td class="n {{if up .Rate}}up{{else}}down{{end}}">{{rate .Rate}}</td>{{else}}<td></td><td></td><td></td>{{end}}
+<td>{{.Sparkline}}</td>
+</tr>
+{{end}}<tr><th colspan="4">{{.T "Total"}} ({{.Base}})</th><th class="n">{{money .Cost}}</th><th></th><th class="n">{{money .Value}}</th><th colspan="2"></th></tr>
+</table>
+<p>{{.T "Prices as last recorded by the report."}}</p>
+{{if not .ReadOnly}}<h2>{{.T "Add an investment"}}</h2>
+<form method="post" action="/add">
+<input name="symbol" placeholder="{{.T "Symbol"}}" required>
+<input name="date" type="date" required>
+<input name="total" placeholder="{{.T "Cost"}}" inputmode="decimal" required>
+<input name="units" placeholder="{{.T "Units"}}" inputmode="decimal" required>
+<input name="account" placeholder="{{.T "Account"}}">
+<input name="currency" placeholder="{{.T "Currency"}}" size="4">
+<button>{{.T "Add"}}</button>
+</form>{{end}}
+</body></html>
+`))
+
+var symbolPage = template.Must(template.New("symbol").Funcs(dashboardFuncs).Parse(`<!DOCTYPE html>
+<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width"><title>{{.Symbol}}</title>` + dashboardStyle + `</head>
+<body>
+<p><a href="/">{{.T "Portfolio"}}</a></p>
+<h1>{{.Symbol}}</h1>
+{{.Chart}}
+<table>
+<tr><th>{{.T "Date"}}</th><th>{{.T "Price"}}</th><th>{{.T "Return"}}</th></tr>
+{{range .History}}<tr><td>{{day .Date}}</td><td class="n">{{money .Price}}</td><td class="n {{if up .CompoundInterest}}up{{else}}down{{end}}">{{rate .CompoundInterest}}</td></tr>
+{{end}}</table>
+</body></html>
+`))
+
+// dashboard serves the portfolio to a browser. The config and history are
+// read afresh for every page, so it shows what the report last recorded
+// and any change made elsewhere; it never fetches quotes itself. Pages are
+// served at the same time, so they read the config with loadConfig: the
+// globals parseConfig sets are set once, when the server starts.
+type dashboard struct {
+	confFile string
+	// mu keeps two additions from both writing the config they read.
+	mu sync.Mutex
+}
+
+// serve handles "serve", running the dashboard and the REST API on addr
+// until it fails or ctx is done. On an address other machines can reach,
+// the dashboard asks for the API key too, so one must be configured.
+func serve(ctx context.Context, confFile, addr string) error {
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	d := &dashboard{confFile: confFile}
+	page := func(h http.HandlerFunc) http.HandlerFunc { return h }
+	if !loopback(addr) {
+		key, err := secret("api", conf.API.Key, conf.API.KeyFile)
+		if err != nil {
+			return err
+		}
+		if key == "" {
+			return fmt.Errorf("serving on %s, beyond this machine, needs an api key", addr)
+		}
+		page = d.signedIn
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", page(d.portfolio))
+	mux.HandleFunc("/symbol/", page(d.symbol))
+	mux.HandleFunc("/add", page(d.add))
+	d.registerAPI(mux)
+	srv := &http.Server{Addr: addr, Handler: mux, BaseContext: func(net.Listener) context.Context { return ctx }}
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
+	fmt.Printf("serving on http://%s\n", addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		return err
+	}
+	return nil
+}
+
+// loopback reports whether addr listens only on this machine.
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// signedIn lets a browser through to h only with the API key as the
+// password of basic authentication, whatever the user name.
+func (d *dashboard) signedIn(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conf, err := loadConfig(d.confFile)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		key, err := secret("api", conf.API.Key, conf.API.KeyFile)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if key == "" {
+			http.Error(w, "no api key configured", http.StatusServiceUnavailable)
+			return
+		}
+		_, pass, _ := r.BasicAuth()
+		if subtle.ConstantTimeCompare([]byte(pass), []byte(key)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Basic realm="stockstalk"`)
+			http.Error(w, "missing or wrong api key", http.StatusUnauthorized)
+			return
+		}
+		h(w, r)
+	}
+}
+
+func (d *dashboard) portfolio(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	d.render(r.Context(), w, http.StatusOK, "")
+}
+
+// render writes the portfolio page, with msg shown above the table.
+func (d *dashboard) render(ctx context.Context, w http.ResponseWriter, status int, msg string) {
+	conf, err := loadConfig(d.confFile)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	store := newHistoryStore(d.confFile, conf)
+	now := clock()
+	if conf.fx, err = fxRates(ctx, conf, store, now, false); err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	page := struct {
+		pageText
+		Error, Base string
+		ReadOnly    bool
+		Lots        []dashboardLot
+		Cost, Value decimal.Decimal
+	}{pageText: pageText{conf}, Error: msg, Base: conf.baseCurrency(), ReadOnly: readOnly || conf.ReadOnly}
+	for _, v := range conf.Investments {
+		if v.Date.After(now) {
+			continue
+		}
+		history, err := lotHistory(store, v, nil, now)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		l := dashboardLot{investment: v, Sparkline: sparkline(history)}
+		page.Cost = page.Cost.Add(conf.toBase(v.Currency, v.basis()))
+		if len(history) > 0 {
+			l.Priced, l.Price = true, history[len(history)-1].Price
+			l.Value, l.Rate = v.Units.Mul(l.Price), currentRate(v, l.Price)
+			page.Value = page.Value.Add(conf.toBase(v.Currency, l.Value))
+		}
+		page.Lots = append(page.Lots, l)
+	}
+	writePage(w, status, dashboardPage, page)
+}
+
+func (d *dashboard) symbol(w http.ResponseWriter, r *http.Request) {
+	symbol := strings.TrimPrefix(r.URL.Path, "/symbol/")
+	conf, err := loadConfig(d.confFile)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	history, err := newHistoryStore(d.confFile, conf).load(symbol)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(history) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	var chart bytes.Buffer
+	if len(history) >= 2 {
+		series := make([]chartPoint, len(history))
+		for k, p := range history {
+			series[k] = chartPoint{date: p.Date, value: p.Price.InexactFloat64()}
+		}
+		if err := writeSVG(&chart, symbol, series, dashboardChartWidth, dashboardChartHeight); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+	// newest first, as in the report
+	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
+		history[i], history[j] = history[j], history[i]
+	}
+	writePage(w, http.StatusOK, symbolPage, struct {
+		pageText
+		Symbol  string
+		Chart   template.HTML
+		History []performance
+	}{pageText{conf}, symbol, template.HTML(chart.String()), history})
+}
+
+// add handles the form adding an investment, then shows the portfolio
+// again. Posts from other sites are refused, so a page elsewhere cannot add
+// to the portfolio through the browser.
+func (d *dashboard) add(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if o := r.Header.Get("Origin"); o != "" {
+		if u, err := url.Parse(o); err != nil || u.Host != r.Host {
+			http.Error(w, "cross-origin request refused", http.StatusForbidden)
+			return
+		}
+	}
+	if readOnly {
+		http.Error(w, errReadOnly.Error(), http.StatusForbidden)
+		return
+	}
+	i, err := formInvestment(r)
+	if err == nil {
+		err = d.addLot(i)
+	}
+	if err != nil {
+		d.render(r.Context(), w, http.StatusBadRequest, err.Error())
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// addLot adds i to the config as it is now, one addition at a time.
+func (d *dashboard) addLot(i investment) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	conf, err := loadConfig(d.confFile)
+	if err != nil {
+		return err
+	}
+	if conf.ReadOnly {
+		return errReadOnly
+	}
+	return insertInvestment(d.confFile, conf, i)
+}
+
+// formInvestment reads an investment from the add form, checked as the
+// API checks one.
+func formInvestment(r *http.Request) (investment, error) {
+	field := func(name string) string { return strings.TrimSpace(r.FormValue(name)) }
+	in := investmentInput{Symbol: field("symbol"), Date: field("date"), Account: field("account"), Currency: field("currency")}
+	var err error
+	if in.Total, err = decimal.NewFromString(field("total")); err != nil {
+		return investment{}, fmt.Errorf("bad cost %q", field("total"))
+	}
+	if in.Units, err = decimal.NewFromString(field("units")); err != nil {
+		return investment{}, fmt.Errorf("bad units %q", field("units"))
+	}
+	return in.investment()
+}
+
+func writePage(w http.ResponseWriter, status int, t *template.Template, data interface{}) {
+	var b bytes.Buffer
+	if err := t.Execute(&b, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write(b.Bytes())
+}
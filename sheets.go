@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// sheetsConfig exports the portfolio to a Google Sheet after every report
+// run, for people who follow it without running stockstalk.
+type sheetsConfig struct {
+	// SpreadsheetID is the ID in the sheet's URL, .../spreadsheets/d/ID/.
+	// The export is off when it is empty.
+	SpreadsheetID string `json:"spreadsheet_id,omitempty"`
+	// Credentials is the JSON key of a Google service account the sheet is
+	// shared with as an editor. It resolves like the other secrets: from
+	// CredentialsFile, the value with ${ENV} references expanded, or the
+	// keyring entry "sheets".
+	Credentials     string `json:"credentials,omitempty"`
+	CredentialsFile string `json:"credentials_file,omitempty"`
+}
+
+// The tabs the export writes, created when missing. Anything else in the
+// spreadsheet is left alone.
+const (
+	snapshotSheet = "Snapshot"
+	historySheet  = "History"
+)
+
+var (
+	sheetsAPI    = "https://sheets.googleapis.com/v4/spreadsheets/"
+	sheetsScope  = "https://www.googleapis.com/auth/spreadsheets"
+	sheetsClient = http.Client{Timeout: 30 * time.Second}
+)
+
+// serviceAccount is the part of a service account's JSON key used to get
+// an access token.
+type serviceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+const sheetsMissing = "sheets.credentials (or credentials_file, or auth set sheets)"
+
+func (c sheetsConfig) account() (serviceAccount, error) {
+	var a serviceAccount
+	s, err := secret("sheets", c.Credentials, c.CredentialsFile)
+	if err != nil {
+		return a, err
+	}
+	if s == "" {
+		return a, missingCredentials([]string{sheetsMissing})
+	}
+	if err := json.Unmarshal([]byte(s), &a); err != nil {
+		return a, fmt.Errorf("sheets credentials: %v", err)
+	}
+	if a.ClientEmail == "" || a.PrivateKey == "" {
+		return a, errors.New("sheets credentials: not a service account key")
+	}
+	if a.TokenURI == "" {
+		a.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	return a, nil
+}
+
+// token gets an access token for the Sheets API with a JWT signed by the
+// account's key, good for an hour.
+func (a serviceAccount) token(ctx context.Context, now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(a.PrivateKey))
+	if block == nil {
+		return "", errors.New("sheets credentials: private_key is not PEM")
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("sheets credentials: %v", err)
+	}
+	key, ok := k.(*rsa.PrivateKey)
+	if !ok {
+		return "", errors.New("sheets credentials: private_key is not an RSA key")
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   a.ClientEmail,
+		"scope": sheetsScope,
+		"aud":   a.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	jwt := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." + enc.EncodeToString(claims)
+	sum := sha256.Sum256([]byte(jwt))
+	sig, err := rsa.SignPKCS1v15(nil, key, crypto.SHA256, sum[:])
+	if err != nil {
+		return "", err
+	}
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {jwt + "." + enc.EncodeToString(sig)},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", a.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := sheetsClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var r struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+		return "", fmt.Errorf("sheets token: %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK || r.AccessToken == "" {
+		return "", fmt.Errorf("sheets token: %s %s", resp.Status, r.Error)
+	}
+	return r.AccessToken, nil
+}
+
+// sheetsCall sends body as JSON to the spreadsheet's API at path and
+// decodes the response into out, unless nil.
+func sheetsCall(ctx context.Context, token, method, id, path string, body, out interface{}) error {
+	var b []byte
+	if body != nil {
+		var err error
+		if b, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequestWithContext(ctx, method, sheetsAPI+url.PathEscape(id)+path, bytes.NewReader(b))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := sheetsClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("sheets: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// sheetRows lays out the export: the snapshot has a row per lot priced or
+// not, the history a row per recorded day of each symbol. Amounts are
+// numbers so the sheet can chart them.
+func sheetRows(conf config, store historyStore, latest map[string]performance, now time.Time) (snapshot, history [][]interface{}, err error) {
+	lots, err := reportLots(conf, store, latest, now)
+	if err != nil {
+		return nil, nil, err
+	}
+	snapshot = [][]interface{}{
+		{"updated", now.Format(isoDate), "base currency", conf.baseCurrency()},
+		{"symbol", "purchase_date", "account", "currency", "total", "units", "price", "value", "compound_interest"},
+	}
+	history = [][]interface{}{{"symbol", "date", "price", "compound_interest"}}
+	seen := make(map[string]bool)
+	for _, l := range lots {
+		row := []interface{}{l.Symbol, l.Date, l.Account, l.Currency, l.Total.InexactFloat64(), l.Units.InexactFloat64(), "", "", ""}
+		if l.Price != nil {
+			row[6], row[7], row[8] = l.Price.InexactFloat64(), l.Value.InexactFloat64(), *l.CompoundInterest
+		}
+		snapshot = append(snapshot, row)
+		if seen[l.Symbol] {
+			continue
+		}
+		seen[l.Symbol] = true
+		for _, h := range l.History {
+			history = append(history, []interface{}{l.Symbol, h.Date, h.Price.InexactFloat64(), h.CompoundInterest})
+		}
+	}
+	return snapshot, history, nil
+}
+
+// exportSheets replaces the Snapshot and History tabs of the configured
+// spreadsheet with the lots in conf priced in latest and their history.
+func exportSheets(ctx context.Context, conf config, store historyStore, latest map[string]performance, now time.Time) error {
+	c := conf.Sheets
+	a, err := c.account()
+	if err != nil {
+		return err
+	}
+	snapshot, history, err := sheetRows(conf, store, latest, now)
+	if err != nil {
+		return err
+	}
+	token, err := a.token(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	var meta struct {
+		Sheets []struct {
+			Properties struct {
+				Title string `json:"title"`
+			} `json:"properties"`
+		} `json:"sheets"`
+	}
+	if err := sheetsCall(ctx, token, "GET", c.SpreadsheetID, "?fields=sheets.properties.title", nil, &meta); err != nil {
+		return err
+	}
+	missing := map[string]bool{snapshotSheet: true, historySheet: true}
+	for _, s := range meta.Sheets {
+		delete(missing, s.Properties.Title)
+	}
+	var add []interface{}
+	for _, title := range []string{snapshotSheet, historySheet} {
+		if missing[title] {
+			add = append(add, map[string]interface{}{"addSheet": map[string]interface{}{"properties": map[string]string{"title": title}}})
+		}
+	}
+	if len(add) > 0 {
+		if err := sheetsCall(ctx, token, "POST", c.SpreadsheetID, ":batchUpdate", map[string]interface{}{"requests": add}, nil); err != nil {
+			return err
+		}
+	}
+	tabs := []string{snapshotSheet, historySheet}
+	if err := sheetsCall(ctx, token, "POST", c.SpreadsheetID, "/values:batchClear", map[string]interface{}{"ranges": tabs}, nil); err != nil {
+		return err
+	}
+	return sheetsCall(ctx, token, "POST", c.SpreadsheetID, "/values:batchUpdate", map[string]interface{}{
+		"valueInputOption": "RAW",
+		"data": []map[string]interface{}{
+			{"range": snapshotSheet + "!A1", "values": snapshot},
+			{"range": historySheet + "!A1", "values": history},
+		},
+	}, nil)
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+func notifyReload(c chan<- os.Signal) { signal.Notify(c, syscall.SIGHUP) }
+
+func notifyRun(c chan<- os.Signal) { signal.Notify(c, syscall.SIGUSR1) }
+
+func notifyStop(c chan<- os.Signal) { signal.Notify(c, syscall.SIGTERM, os.Interrupt) }
@@ -0,0 +1,14 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+)
+
+// Windows has no SIGHUP or SIGUSR1; the daemon relies on the file watch.
+
+func notifyReload(c chan<- os.Signal) {}
+
+func notifyRun(c chan<- os.Signal) {}
+
+func notifyStop(c chan<- os.Signal) { signal.Notify(c, os.Interrupt) }
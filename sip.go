@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// recurringInvestment is a fixed amount invested every month, a SIP. The
+// daemon adds a lot for each month's Day on or after Start, bought with
+// Amount at that day's price.
+type recurringInvestment struct {
+	Symbol string          `json:"symbol"`
+	Amount decimal.Decimal `json:"amount"`
+	// Day is the day of the month, 1 to 31; months without it use their
+	// last day.
+	Day   int       `json:"day"`
+	Start time.Time `json:"start"`
+	// Provider, Account, Portfolio and Currency are given to every lot.
+	Provider  string `json:"provider,omitempty"`
+	Account   string `json:"account,omitempty"`
+	Portfolio string `json:"portfolio,omitempty"`
+	Currency  string `json:"currency,omitempty"`
+	// Last is the day of the latest lot added, kept by the daemon.
+	Last time.Time `json:"last,omitempty"`
+}
+
+func (r recurringInvestment) validate() error {
+	switch {
+	case r.Symbol == "":
+		return errors.New("recurring investment without a symbol")
+	case !r.Amount.IsPositive():
+		return fmt.Errorf("recurring %s: amount %s must be positive", r.Symbol, r.Amount)
+	case r.Day < 1 || r.Day > 31:
+		return fmt.Errorf("recurring %s: day %d must be 1 to 31", r.Symbol, r.Day)
+	case r.Start.IsZero():
+		return fmt.Errorf("recurring %s: no start date", r.Symbol)
+	}
+	if err := validPortfolio(r.Portfolio); r.Portfolio != "" && err != nil {
+		return fmt.Errorf("recurring %s: %v", r.Symbol, err)
+	}
+	return nil
+}
+
+// dayIn is the day r invests in the month of t.
+func (r recurringInvestment) dayIn(t time.Time) time.Time {
+	last := time.Date(t.Year(), t.Month()+1, 0, 0, 0, 0, 0, time.UTC).Day()
+	d := r.Day
+	if d > last {
+		d = last
+	}
+	return time.Date(t.Year(), t.Month(), d, 0, 0, 0, 0, time.UTC)
+}
+
+// due returns the days r invests on, oldest first, that have come by today
+// and have no lot yet.
+func (r recurringInvestment) due(today time.Time) []time.Time {
+	from := r.Start
+	if !r.Last.IsZero() {
+		from = r.Last.AddDate(0, 0, 1)
+	}
+	var days []time.Time
+	for m := time.Date(from.Year(), from.Month(), 1, 0, 0, 0, 0, time.UTC); !m.After(today); m = m.AddDate(0, 1, 0) {
+		if d := r.dayIn(m); !d.Before(startOfDay(from)) && !d.After(today) {
+			days = append(days, d)
+		}
+	}
+	return days
+}
+
+// addRecurring adds the lots of the recurring investments in conf that
+// have come due by now and writes the config, returning the lots added.
+// Today's lot is bought at the latest price and a missed day's at its
+// close, or also at the latest price when a provider other than Yahoo
+// prices the symbol. A day that cannot be priced is reported and left for
+// the next run, along with the days after it.
+func addRecurring(ctx context.Context, confFile string, conf *config, store historyStore, now time.Time) ([]investment, error) {
+	if readOnly {
+		return nil, nil
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	investments, recurring := conf.Investments, append([]recurringInvestment(nil), conf.Recurring...)
+	var added []investment
+	for n := range conf.Recurring {
+		r := &conf.Recurring[n]
+		for _, day := range r.due(today) {
+			i := investment{Symbol: r.Symbol, Date: day, Total: r.Amount, Provider: r.Provider,
+				Account: r.Account, Portfolio: r.Portfolio, Currency: r.Currency}
+			var price decimal.Decimal
+			var err error
+			if day.Equal(today) || r.Provider != "" {
+				var q quote
+				q, err = cachedQuote(ctx, *conf, store, i, now)
+				price = q.Price
+			} else {
+				price, err = historicalPrice(ctx, store, r.Symbol, day)
+			}
+			if err == nil && !price.IsPositive() {
+				err = fmt.Errorf("no price for %s on %s", r.Symbol, day.Format(isoDate))
+			}
+			if err != nil {
+				perr(fmt.Errorf("recurring %s: %v", r.Symbol, err))
+				break
+			}
+			i.Units = r.Amount.DivRound(price, 4)
+			conf.adjustLot(&i)
+			conf.Investments = append(conf.Investments, i)
+			r.Last = day
+			added = append(added, i)
+		}
+	}
+	if len(added) == 0 {
+		return nil, nil
+	}
+	if err := writeConfig(confFile, *conf); err != nil {
+		conf.Investments, conf.Recurring = investments, recurring
+		return nil, err
+	}
+	for k := range added {
+		logInfo("recurring investment added", "symbol", added[k].Symbol, "date", added[k].Date.Format(isoDate),
+			"total", added[k].Total, "units", added[k].Units)
+		if err := appendAudit(confFile, auditEntry{Action: "recurring", New: &added[k]}); err != nil {
+			return added, err
+		}
+	}
+	return added, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// strategy decides what a simulated portfolio does with new money and
+// how it trades at each close.
+type strategy interface {
+	name(conf config) string
+	// contribute is called when tx's amount has just been added to cash.
+	contribute(h *holdings, tx transaction)
+	// trade is called once per close, after any contributions.
+	trade(h *holdings, day time.Time)
+}
+
+// buyAndHold invests every transaction the day it happens and never
+// trades; it is the actual record the other strategies are compared with.
+type buyAndHold struct{}
+
+func (buyAndHold) name(conf config) string { return conf.tr("buy and hold") }
+
+func (buyAndHold) contribute(h *holdings, tx transaction) {
+	h.buy(tx.Symbol, tx.Amount.InexactFloat64())
+}
+
+func (buyAndHold) trade(*holdings, time.Time) {}
+
+// rebalance invests like buyAndHold but on the first close of every
+// quarter trades the held symbols back to their target weights.
+type rebalance struct {
+	weights map[string]float64
+	quarter int
+}
+
+// newRebalance targets each symbol's share of the total amount in txs.
+func newRebalance(txs []transaction) *rebalance {
+	r := &rebalance{weights: make(map[string]float64)}
+	var total float64
+	for _, tx := range txs {
+		total += tx.Amount.InexactFloat64()
+	}
+	for _, tx := range txs {
+		r.weights[tx.Symbol] += tx.Amount.InexactFloat64() / total
+	}
+	return r
+}
+
+func (r *rebalance) name(conf config) string { return conf.tr("rebalance quarterly") }
+
+func (r *rebalance) contribute(h *holdings, tx transaction) {
+	h.buy(tx.Symbol, tx.Amount.InexactFloat64())
+}
+
+func (r *rebalance) trade(h *holdings, day time.Time) {
+	q := day.Year()*4 + (int(day.Month())-1)/3
+	if r.quarter == 0 || q == r.quarter {
+		r.quarter = q
+		return
+	}
+	r.quarter = q
+	// Only symbols already bought share the money, so nothing is bought
+	// ahead of the record being compared with.
+	var held float64
+	for s, w := range r.weights {
+		if h.units[s] > 0 {
+			held += w
+		}
+	}
+	if held == 0 {
+		return
+	}
+	total := h.value() - h.cash
+	for s, w := range r.weights {
+		if h.units[s] > 0 {
+			h.units[s] = total * w / held / h.price[s]
+		}
+	}
+}
+
+// buyDip holds each transaction's money as cash until its symbol closes
+// drop below the highest close since the money came in. Money still
+// waiting at the end stays in cash.
+type buyDip struct {
+	drop    float64
+	waiting []dipOrder
+}
+
+type dipOrder struct {
+	symbol       string
+	amount, peak float64
+}
+
+func (d *buyDip) name(conf config) string {
+	return fmt.Sprintf("%s (%g%%)", conf.tr("buy the dip"), 100*d.drop)
+}
+
+func (d *buyDip) contribute(h *holdings, tx transaction) {
+	d.waiting = append(d.waiting, dipOrder{symbol: tx.Symbol, amount: tx.Amount.InexactFloat64(), peak: h.price[tx.Symbol]})
+}
+
+func (d *buyDip) trade(h *holdings, day time.Time) {
+	kept := d.waiting[:0]
+	for _, o := range d.waiting {
+		p := h.price[o.symbol]
+		if p > o.peak {
+			o.peak = p
+		}
+		if p <= o.peak*(1-d.drop) {
+			h.buy(o.symbol, o.amount)
+			continue
+		}
+		kept = append(kept, o)
+	}
+	d.waiting = kept
+}
+
+// compareStrategies runs the same money through buy-and-hold and the
+// rule-based strategies and prints their outcomes side by side. dip is
+// the percentage drop buyDip waits for.
+func compareStrategies(ctx context.Context, w io.Writer, confFile string, args []string, shift string, dip float64) error {
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	txs, err := loadTransactions(conf, args, shift)
+	if err != nil {
+		return err
+	}
+	if dip <= 0 || dip >= 100 {
+		return fmt.Errorf("dip %g%% out of range, want between 0 and 100", dip)
+	}
+	sort.SliceStable(txs, func(i, j int) bool { return txs[i].Date.Before(txs[j].Date) })
+	end := clock()
+	store := newHistoryStore(confFile, conf)
+	strategies := []strategy{buyAndHold{}, newRebalance(txs), &buyDip{drop: dip / 100}}
+	for k, s := range strategies {
+		res, err := simulate(ctx, store, txs, end, s)
+		if err != nil {
+			return err
+		}
+		if k == 0 {
+			fmt.Fprintf(w, "=== %s %s - %s ===\n", conf.tr("Strategies"), res.start.Format(humanDate), res.end.Format(humanDate))
+		}
+		fmt.Fprintf(w, "%s: %s %.2f (%+.1f%%), %.2f %% %s, %s %.1f%%", s.name(conf), conf.tr("value"), res.value,
+			100*(res.value/res.invested-1), annualized(res.nav, res.start, res.end), conf.tr("a year"),
+			conf.tr("max drawdown"), 100*res.maxDrawdown)
+		if res.cash > 0.005 {
+			fmt.Fprintf(w, ", %s %.2f", conf.tr("uninvested cash"), res.cash)
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// parseTags splits a comma-separated list of tags, such as
+// "tech,dividend", lower-casing them and dropping blanks and repeats.
+func parseTags(s string) []string {
+	var tags []string
+	seen := make(map[string]bool)
+	for _, t := range strings.Split(s, ",") {
+		t = strings.ToLower(strings.TrimSpace(t))
+		if t != "" && !seen[t] {
+			seen[t] = true
+			tags = append(tags, t)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+func (i investment) hasTag(tag string) bool {
+	for _, t := range i.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// withTag returns conf with only the investments tagged tag and the sales
+// of them. Like inPortfolio's, the result must not be written back.
+func withTag(conf config, tag string) (config, error) {
+	var investments []investment
+	for _, i := range conf.Investments {
+		if i.hasTag(tag) {
+			investments = append(investments, i)
+		}
+	}
+	if len(investments) == 0 {
+		return conf, fmt.Errorf("no investments tagged %q", tag)
+	}
+	var sales []sale
+	for _, s := range conf.Sales {
+		if len(s.Lots) > 0 && s.Lots[0].hasTag(tag) {
+			sales = append(sales, s)
+		}
+	}
+	conf.Investments, conf.Sales = investments, sales
+	return conf, nil
+}
+
+// tagNames returns the tags of the investments in conf, sorted.
+func tagNames(conf config) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, i := range conf.Investments {
+		for _, t := range i.Tags {
+			if t = strings.ToLower(t); !seen[t] {
+				seen[t] = true
+				names = append(names, t)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tagLine shows the tags and note of i, or is empty when it has neither.
+func tagLine(i investment) string {
+	var fields []string
+	for _, t := range i.Tags {
+		fields = append(fields, "#"+t)
+	}
+	if i.Note != "" {
+		fields = append(fields, i.Note)
+	}
+	return strings.Join(fields, " ")
+}
+
+// printTags prints the subtotals of each tag. A lot with several tags
+// counts in each, so the subtotals may add up to more than the portfolio.
+func printTags(ctx context.Context, w io.Writer, conf config, store historyStore, latest map[string]performance, now time.Time) {
+	totals := subtotals(ctx, conf, store, latest, now, func(i investment) []string {
+		var tags []string
+		for _, t := range i.Tags {
+			tags = append(tags, strings.ToLower(t))
+		}
+		return tags
+	})
+	if len(totals) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "=== %s ===\n", conf.tr("Tags"))
+	for _, tag := range tagNames(conf) {
+		if t := totals[tag]; t != nil && t.invested != 0 {
+			printSubtotal(w, conf, "#"+tag, t, now)
+		}
+	}
+	fmt.Fprintf(w, "\n")
+}
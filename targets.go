@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// targetLine describes how far price is from the targets of i, or returns
+// "" if it has none.
+func targetLine(conf config, i investment, price decimal.Decimal) string {
+	if !price.IsPositive() {
+		return ""
+	}
+	var parts []string
+	distance := func(target decimal.Decimal) float64 {
+		return 100 * (target.Div(price).InexactFloat64() - 1)
+	}
+	if i.BuyBelow != nil {
+		parts = append(parts, fmt.Sprintf("%s %s (%+.1f%%)", conf.tr("buy below"), i.BuyBelow.StringFixed(2), distance(*i.BuyBelow)))
+	}
+	if i.SellAbove != nil {
+		parts = append(parts, fmt.Sprintf("%s %s (%+.1f%%)", conf.tr("take profit above"), i.SellAbove.StringFixed(2), distance(*i.SellAbove)))
+	}
+	return strings.Join(parts, " | ")
+}
+
+// targetAlerts returns an alert for every target the price in latest is
+// beyond.
+func targetAlerts(conf config, latest map[string]performance) []alert {
+	var active []alert
+	seen := make(map[string]bool)
+	add := func(a alert) {
+		if !seen[a.ID] {
+			seen[a.ID] = true
+			active = append(active, a)
+		}
+	}
+	for _, i := range conf.Investments {
+		cur, ok := latest[i.Symbol]
+		if !ok {
+			continue
+		}
+		if t := i.BuyBelow; t != nil && cur.Price.LessThanOrEqual(*t) {
+			add(alert{
+				ID: i.Symbol + "-buy-below-" + t.String(),
+				Message: fmt.Sprintf(conf.tr("%s fell to %s, below your buy target of %s"),
+					i.Symbol, cur.Price.StringFixed(2), t.StringFixed(2)),
+			})
+		}
+		if t := i.SellAbove; t != nil && cur.Price.GreaterThanOrEqual(*t) {
+			add(alert{
+				ID: i.Symbol + "-sell-above-" + t.String(),
+				Message: fmt.Sprintf(conf.tr("%s rose to %s, above your take-profit target of %s"),
+					i.Symbol, cur.Price.StringFixed(2), t.StringFixed(2)),
+			})
+		}
+	}
+	return active
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// taxConfig sets how the tax command classifies and taxes unrealized
+// gains. Rates are in percent.
+type taxConfig struct {
+	// LongTermDays is how long a lot must be held, in days, before its gain
+	// is long-term: more than 365 by default, as in the US.
+	LongTermDays  int     `json:"long_term_days,omitempty"`
+	ShortTermRate float64 `json:"short_term_rate,omitempty"`
+	LongTermRate  float64 `json:"long_term_rate,omitempty"`
+}
+
+const defaultLongTermDays = 365
+
+func (t taxConfig) longTermDays() int {
+	if t.LongTermDays > 0 {
+		return t.LongTermDays
+	}
+	return defaultLongTermDays
+}
+
+func (t taxConfig) validate() error {
+	if t.LongTermDays < 0 {
+		return errors.New("tax: long_term_days must not be negative")
+	}
+	if t.ShortTermRate < 0 || t.ShortTermRate > 100 || t.LongTermRate < 0 || t.LongTermRate > 100 {
+		return errors.New("tax: rates must be between 0 and 100")
+	}
+	return nil
+}
+
+// longTermOn is the first day the gain of a lot bought on bought is
+// long-term.
+func (t taxConfig) longTermOn(bought time.Time) time.Time {
+	return bought.AddDate(0, 0, t.longTermDays()+1)
+}
+
+// taxReport handles "tax": the unrealized gain of each lot at today's
+// prices, whether it is short- or long-term, and the tax due on selling
+// everything. Lots turning long-term within soon days are marked, as
+// waiting for them may lower the tax. Losses offset gains of the same term.
+func taxReport(ctx context.Context, w io.Writer, confFile string, soon int) error {
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	if conf, err = inPortfolio(conf); err != nil {
+		return err
+	}
+	if err := conf.Tax.validate(); err != nil {
+		return err
+	}
+	if soon < 0 {
+		return fmt.Errorf("soon %d must not be negative", soon)
+	}
+	store := newHistoryStore(confFile, conf)
+	now, err := conf.Market.date(clock())
+	if err != nil {
+		return err
+	}
+	if conf.fx, err = fxRates(ctx, conf, store, now, false); err != nil {
+		return err
+	}
+	prices := fetchPrices(ctx, conf, store, now, false)
+	var short, long float64
+	for _, i := range conf.Investments {
+		if i.Date.After(now) {
+			continue
+		}
+		q := prices[priceKey{i.Symbol, i.Provider}]
+		if q.err != nil {
+			fmt.Fprintf(w, "%s %s: %v\n", i.Symbol, conf.tr("unavailable"), q.err)
+			continue
+		}
+		cost, err := lotCost(ctx, conf, store, i)
+		if err != nil {
+			fmt.Fprintf(w, "%s %s: %v\n", i.Symbol, conf.tr("unavailable"), err)
+			continue
+		}
+		gain := conf.toBase(i.Currency, i.Units.Mul(q.price)).InexactFloat64() - cost
+		on := conf.Tax.longTermOn(i.Date)
+		term, rate := conf.tr("short-term"), conf.Tax.ShortTermRate
+		if !now.Before(on) {
+			term, rate = conf.tr("long-term"), conf.Tax.LongTermRate
+			long += gain
+		} else {
+			short += gain
+		}
+		fmt.Fprintf(w, "%s %s %s %s, %s %+.2f, %s, %s %.2f", i.Symbol, i.Date.Format(humanDate), i.Units, conf.tr("units"),
+			conf.tr("gain"), gain, term, conf.tr("tax"), gain*rate/100)
+		if days := int(on.Sub(now).Hours()/24 + 0.5); now.Before(on) && days <= soon {
+			fmt.Fprintf(w, " ! "+conf.tr("long-term in %d days, on %s"), days, on.Format(humanDate))
+		}
+		fmt.Fprintf(w, "\n")
+	}
+	due := func(gain, rate float64) float64 {
+		if gain <= 0 {
+			return 0
+		}
+		return gain * rate / 100
+	}
+	tax := due(short, conf.Tax.ShortTermRate) + due(long, conf.Tax.LongTermRate)
+	fmt.Fprintf(w, "%s %+.2f, %s %+.2f, %s %.2f %s\n", conf.tr("short-term"), short, conf.tr("long-term"), long,
+		conf.tr("tax"), tax, conf.baseCurrency())
+	return nil
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"os/exec"
+	"runtime"
+	"sort"
+	"time"
+)
+
+type telemetryConfig struct {
+	// Endpoint receives one JSON telemetryEvent per run via POST. Telemetry
+	// is disabled when it is empty.
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// telemetryEvent is everything telemetry ever sends. It deliberately holds
+// no symbols, amounts, dates or credentials.
+type telemetryEvent struct {
+	Version    string   `json:"version"`
+	OS         string   `json:"os"`
+	Arch       string   `json:"arch"`
+	DurationMS int64    `json:"duration_ms"`
+	Providers  []string `json:"providers"`       // "yahoo", "iex", "alphavantage", "amfi", "crypto" and/or "plugin"
+	Error      string   `json:"error,omitempty"` // category, see errorCategory
+	// Failures counts the symbols each provider failed to price.
+	Failures []telemetryFailure `json:"failures,omitempty"`
+}
+
+// telemetryFailure is how many symbols a provider failed to price in a run
+// with errors of one category.
+type telemetryFailure struct {
+	Provider string `json:"provider"`
+	Error    string `json:"error"`
+	Count    int    `json:"count"`
+}
+
+// telemetryProvider names the provider of lots with provider as telemetry
+// does: the quote source, a built-in provider, or "plugin" for any plugin.
+func telemetryProvider(conf config, provider string) string {
+	if provider == "" {
+		if provider = quoteSource; provider == "" {
+			provider = conf.Quotes.Provider
+		}
+		if provider == "" {
+			provider = "yahoo"
+		}
+		return provider
+	}
+	if _, ok := builtinProviders[provider]; ok {
+		return provider
+	}
+	return "plugin"
+}
+
+// quoteFailures counts the failed quotes of prices by provider and error
+// category. Lots already inactive are not fetched, so they do not count.
+func quoteFailures(conf config, prices map[priceKey]priceResult) []telemetryFailure {
+	counts := make(map[telemetryFailure]int)
+	for k, r := range prices {
+		var inactive inactiveError
+		if r.err == nil || errors.As(r.err, &inactive) {
+			continue
+		}
+		counts[telemetryFailure{Provider: telemetryProvider(conf, k.provider), Error: errorCategory(r.err)}]++
+	}
+	var failures []telemetryFailure
+	for f, n := range counts {
+		f.Count = n
+		failures = append(failures, f)
+	}
+	sort.Slice(failures, func(a, b int) bool {
+		if failures[a].Provider != failures[b].Provider {
+			return failures[a].Provider < failures[b].Provider
+		}
+		return failures[a].Error < failures[b].Error
+	})
+	return failures
+}
+
+// sendTelemetry reports a finished run if telemetry is enabled, unless the
+// run was not to change anything: -dry-run or read-only. Failures are
+// ignored: telemetry must never get in the way of a run.
+func sendTelemetry(ctx context.Context, conf config, took time.Duration, runErr error, failures []telemetryFailure) {
+	if conf.Telemetry.Endpoint == "" || dryRun || readOnly {
+		return
+	}
+	seen := make(map[string]bool)
+	for _, i := range conf.Investments {
+		seen[telemetryProvider(conf, i.Provider)] = true
+	}
+	ev := telemetryEvent{
+		Version:    version,
+		OS:         runtime.GOOS,
+		Arch:       runtime.GOARCH,
+		DurationMS: took.Milliseconds(),
+		Error:      errorCategory(runErr),
+		Failures:   failures,
+	}
+	for p := range seen {
+		ev.Providers = append(ev.Providers, p)
+	}
+	sort.Strings(ev.Providers)
+
+	b, err := json.Marshal(ev)
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "POST", conf.Telemetry.Endpoint, bytes.NewReader(b))
+	if err != nil {
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return
+	}
+	resp.Body.Close()
+}
+
+// errorCategory reduces an error to a coarse category so that no message
+// text, which may name symbols or paths, leaves the machine.
+func errorCategory(err error) string {
+	var (
+		cfgErr   *configError
+		panicErr *panicError
+		exitErr  *exec.ExitError
+		netErr   net.Error
+	)
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &cfgErr):
+		return "config"
+	case errors.As(err, &panicErr):
+		return "panic"
+	case errors.As(err, &exitErr):
+		return "plugin"
+	case errors.As(err, &netErr):
+		return "network"
+	}
+	return "other"
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// reportData is what the report templates are executed with. Amounts in
+// Portfolio and Symbols are in BaseCurrency; those of a holding are in its
+// own currency.
+type reportData struct {
+	Date         time.Time
+	BaseCurrency string
+	Portfolio    struct {
+		Invested, Value, Gain float64
+	}
+	Holdings []reportHolding
+	Symbols  []reportSymbol
+	// Sections is the text of the optional report sections followed by any
+	// quotes that could not be fetched.
+	Sections string
+}
+
+// reportHolding is a lot with what the report shows of it. The fields of
+// the investment, such as .Symbol and .Units, are promoted.
+type reportHolding struct {
+	investment
+	// Heading and Details are the lines the built-in report shows above
+	// the history.
+	Heading string
+	Details []string
+	// Price and Value are at the latest price, when there is one.
+	Priced       bool
+	Price, Value decimal.Decimal
+	// History is the recorded history of the symbol, newest first.
+	History   []performance
+	Sparkline template.HTML
+	// Chart is terminal charts of the history, set on the first lot of a
+	// symbol when printing to a terminal.
+	Chart string
+	// Stats is nil when no price was recorded since the lot was bought.
+	Stats *priceStats
+	// Position sums up all the lots of the symbol. It is set on the first
+	// lot of a priced symbol held in more than one.
+	Position *reportPosition
+}
+
+// reportPosition is the lots of one symbol taken together, in
+// BaseCurrency.
+type reportPosition struct {
+	Symbol      string
+	Lots        int
+	Units       decimal.Decimal
+	AverageCost float64 // per unit
+	Value       float64
+	// Return is the money-weighted annual return of the lots, in percent,
+	// when it could be solved for.
+	Return   float64
+	ReturnOK bool
+	// Line is how the built-in report shows it.
+	Line string
+}
+
+// reportSymbol sums up the lots of one symbol.
+type reportSymbol struct {
+	Symbol string
+	Price  decimal.Decimal
+	Value  float64
+	Weight float64 // percent of the portfolio's value
+	// CompoundInterest is the latest recorded for the symbol.
+	CompoundInterest float64
+}
+
+// reportFuncs are the functions the report templates can call.
+var reportFuncs = map[string]interface{}{
+	"day":   func(t time.Time) string { return t.Format(humanDate) },
+	"rate":  func(r float64) string { return fmt.Sprintf("%.2f %%", r) },
+	"up":    func(r float64) bool { return r >= 0 },
+	"money": func(d decimal.Decimal) string { return d.StringFixed(2) },
+	// recent is the first historyRows entries of a history.
+	"recent": func(history []performance) []performance {
+		if len(history) > historyRows {
+			return history[:historyRows]
+		}
+		return history
+	},
+}
+
+// textReport is the built-in plain text report.
+var textReport = texttemplate.Must(texttemplate.New("report").Funcs(reportFuncs).Parse(
+	`{{range .Holdings}}{{with .Position}}==={{.Line}} ===
+
+{{end}}==={{.Heading}} ===
+{{range .Details}}{{.}}
+{{end}}{{.Chart}}{{if .History}}{{range .History}}{{day .Date}} {{rate .CompoundInterest}}
+{{end}}
+{{end}}{{end}}{{.Sections}}`))
+
+// newReportData gathers what the report shows of the lots in conf held at
+// now, priced in latest.
+func newReportData(ctx context.Context, conf config, store historyStore, latest map[string]performance, fundamentals map[string]summaryDetail, sections string, now time.Time) (reportData, error) {
+	data := reportData{Date: now, BaseCurrency: conf.baseCurrency(), Sections: sections}
+	values := holdingValues(conf, latest)
+	positions := positionsOf(ctx, conf, store, latest, values, now)
+	for _, v := range conf.Investments {
+		if v.Date.After(now) {
+			continue
+		}
+		history, err := lotHistory(store, v, latest, now)
+		if err != nil {
+			return data, err
+		}
+		h := reportHolding{
+			investment: v,
+			Heading:    lotHeading(v),
+			Details:    lotDetails(ctx, conf, store, v, history, latest, fundamentals, now),
+			Sparkline:  sparkline(history),
+		}
+		if stats, ok := lotStats(v, history, fundamentals, now); ok {
+			h.Stats = &stats
+		}
+		if p, ok := positions[v.Symbol]; ok {
+			h.Position = p
+			delete(positions, v.Symbol)
+		}
+		for i := len(history) - 1; i >= 0; i-- {
+			h.History = append(h.History, history[i])
+		}
+		if p, ok := latest[v.Symbol]; ok {
+			h.Priced, h.Price, h.Value = true, p.Price, v.Units.Mul(p.Price)
+			if cost, err := lotCost(ctx, conf, store, v); err == nil {
+				data.Portfolio.Invested += cost
+			}
+		}
+		data.Holdings = append(data.Holdings, h)
+	}
+	for _, v := range values {
+		data.Portfolio.Value += v.InexactFloat64()
+	}
+	data.Portfolio.Gain = data.Portfolio.Value - data.Portfolio.Invested
+	for _, s := range heldSymbols(conf) {
+		p, ok := latest[s]
+		if !ok {
+			continue
+		}
+		sym := reportSymbol{Symbol: s, Price: p.Price, Value: values[s].InexactFloat64(), CompoundInterest: p.CompoundInterest}
+		if data.Portfolio.Value > 0 {
+			sym.Weight = 100 * sym.Value / data.Portfolio.Value
+		}
+		data.Symbols = append(data.Symbols, sym)
+	}
+	return data, nil
+}
+
+// positionsOf sums up the lots of each priced symbol held at now in more
+// than one lot, given the values of the symbols.
+func positionsOf(ctx context.Context, conf config, store historyStore, latest map[string]performance, values map[string]decimal.Decimal, now time.Time) map[string]*reportPosition {
+	positions := make(map[string]*reportPosition)
+	flows := make(map[string][]cashFlow)
+	for _, v := range conf.Investments {
+		if _, ok := latest[v.Symbol]; !ok || v.Date.After(now) {
+			continue
+		}
+		cost, err := lotCost(ctx, conf, store, v)
+		if err != nil {
+			continue
+		}
+		p, ok := positions[v.Symbol]
+		if !ok {
+			p = &reportPosition{Symbol: v.Symbol}
+			positions[v.Symbol] = p
+		}
+		p.Lots++
+		p.Units = p.Units.Add(v.Units)
+		p.AverageCost += cost
+		flows[v.Symbol] = append(flows[v.Symbol], cashFlow{v.Date, -cost})
+	}
+	for s, p := range positions {
+		if p.Lots < 2 || !p.Units.IsPositive() {
+			delete(positions, s)
+			continue
+		}
+		p.AverageCost /= p.Units.InexactFloat64()
+		p.Value = values[s].InexactFloat64()
+		all := append(flows[s], cashFlow{now, p.Value})
+		sort.Slice(all, func(a, b int) bool { return all[a].date.Before(all[b].date) })
+		r, err := xirr(all)
+		ret := fmt.Sprintf("%.2f %%", r)
+		if err == nil {
+			p.Return, p.ReturnOK = r, true
+		} else {
+			ret = fmt.Sprintf("%s: %v", conf.tr("unavailable"), err)
+		}
+		p.Line = fmt.Sprintf("%s %d %s: %s %s, %s %.2f, %s %.2f, %s %s", s, p.Lots, conf.tr("lots"),
+			p.Units.String(), conf.tr("units"), conf.tr("average cost"), p.AverageCost, conf.tr("value"), p.Value,
+			conf.tr("money-weighted return"), ret)
+	}
+	return positions
+}
+
+// templatePath resolves a template file named in the config, relative to
+// the config file.
+func templatePath(confFile, file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(filepath.Dir(confFile), file)
+}
+
+// textTemplate is the template of the plain text report: the configured
+// one, or the built-in one.
+func textTemplate(confFile string, conf config) (*texttemplate.Template, error) {
+	if conf.Report.Template == "" {
+		return textReport, nil
+	}
+	b, err := ioutil.ReadFile(templatePath(confFile, conf.Report.Template))
+	if err != nil {
+		return nil, err
+	}
+	t, err := texttemplate.New("report").Funcs(reportFuncs).Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("report template: %v", err)
+	}
+	return t, nil
+}
+
+// htmlTemplate is the template of the HTML report: the configured one, or
+// the built-in one.
+func htmlTemplate(confFile string, conf config) (*template.Template, error) {
+	if conf.Report.HTMLTemplate == "" {
+		return htmlReport, nil
+	}
+	b, err := ioutil.ReadFile(templatePath(confFile, conf.Report.HTMLTemplate))
+	if err != nil {
+		return nil, err
+	}
+	t, err := template.New("report").Funcs(reportFuncs).Parse(string(b))
+	if err != nil {
+		return nil, fmt.Errorf("html report template: %v", err)
+	}
+	return t, nil
+}
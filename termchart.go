@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"strings"
+)
+
+// termChartWidth and termChartRows size a terminal chart in characters;
+// each braille character holds 2 by 4 dots.
+const (
+	termChartWidth = 60
+	termChartRows  = 3
+)
+
+// isTerminal reports whether f is an interactive terminal rather than a
+// file or pipe.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// brailleDots are the bits of the braille dots of a character by column
+// and row.
+var brailleDots = [2][4]rune{{0x01, 0x02, 0x04, 0x40}, {0x08, 0x10, 0x20, 0x80}}
+
+// termChart draws series as a line of braille characters rows high and
+// width wide, under title with the dates it spans, with the highest and
+// lowest values to the right of the top and bottom rows.
+func termChart(title string, series []chartPoint, width, rows int) string {
+	s := newChartScale(series, 2*width-1, 4*rows-1, 0)
+	img := image.NewRGBA(image.Rect(0, 0, 2*width, 4*rows))
+	on := color.RGBA{0, 0, 0, 0xff}
+	x0, y0 := s.point(series[0])
+	for _, p := range series[1:] {
+		x1, y1 := s.point(p)
+		drawLine(img, x0, y0, x1, y1, on)
+		x0, y0 = x1, y1
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s..%s\n", title, s.from.Format(humanDate), s.to.Format(humanDate))
+	for row := 0; row < rows; row++ {
+		for col := 0; col < width; col++ {
+			c := rune(0x2800)
+			for dx := 0; dx < 2; dx++ {
+				for dy := 0; dy < 4; dy++ {
+					if img.RGBAAt(2*col+dx, 4*row+dy).A != 0 {
+						c |= brailleDots[dx][dy]
+					}
+				}
+			}
+			b.WriteRune(c)
+		}
+		switch row {
+		case 0:
+			fmt.Fprintf(&b, " %.2f", s.max)
+		case rows - 1:
+			fmt.Fprintf(&b, " %.2f", s.min)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// withCharts returns data with terminal charts of the recorded price and
+// compound interest of each symbol under its first lot.
+func withCharts(conf config, data reportData) reportData {
+	holdings := make([]reportHolding, len(data.Holdings))
+	charted := make(map[string]bool)
+	for k, h := range data.Holdings {
+		if len(h.History) >= 2 && !charted[h.Symbol] {
+			charted[h.Symbol] = true
+			price := make([]chartPoint, len(h.History))
+			rate := make([]chartPoint, len(h.History))
+			for n, p := range h.History {
+				// History is newest first
+				price[len(price)-1-n] = chartPoint{date: p.Date, value: p.Price.InexactFloat64()}
+				rate[len(rate)-1-n] = chartPoint{date: p.Date, value: p.CompoundInterest}
+			}
+			h.Chart = termChart(conf.tr("price"), price, termChartWidth, termChartRows) +
+				termChart(conf.tr("compound interest"), rate, termChartWidth, termChartRows)
+		}
+		holdings[k] = h
+	}
+	data.Holdings = holdings
+	return data
+}
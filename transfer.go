@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// takeLots removes units from the lots matching match, oldest first,
+// splitting a lot if only part of it is needed. It returns the lots left
+// and the parts taken, each keeping its date and its share of the cost.
+func takeLots(lots []investment, match func(investment) bool, units decimal.Decimal) (kept, taken []investment, err error) {
+	sorted := append([]investment(nil), lots...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Date.Before(sorted[j].Date) })
+	left := units
+	for _, i := range sorted {
+		if !match(i) || !left.IsPositive() {
+			kept = append(kept, i)
+			continue
+		}
+		part := i
+		part.Units = decimal.Min(left, i.Units)
+		part.Total = i.Total.Mul(part.Units).Div(i.Units).Round(2)
+		part.Fees, i.Fees = splitCost(i.Fees, part.Units, i.Units)
+		part.TaxesPaid, i.TaxesPaid = splitCost(i.TaxesPaid, part.Units, i.Units)
+		taken = append(taken, part)
+		left = left.Sub(part.Units)
+		i.Units, i.Total = i.Units.Sub(part.Units), i.Total.Sub(part.Total)
+		if i.Units.IsPositive() {
+			kept = append(kept, i)
+		}
+	}
+	if left.IsPositive() {
+		return nil, nil, fmt.Errorf("only %s units held", units.Sub(left))
+	}
+	return kept, taken, nil
+}
+
+// transfer handles "transfer SYMBOL UNITS FROM TO", moving units of symbol
+// from account FROM to account TO, oldest lots first. The lots keep their
+// dates and cost basis, so returns and taxes are unaffected. An empty
+// account is written "".
+func transfer(w io.Writer, confFile string, args []string) error {
+	if len(args) != 4 {
+		return errors.New(`usage: transfer SYMBOL UNITS FROM TO ("" for no account)`)
+	}
+	symbol, from, to := strings.ToUpper(args[0]), args[2], args[3]
+	if from == to {
+		return errors.New("transfer to the same account")
+	}
+	units, err := decimal.NewFromString(args[1])
+	if err != nil {
+		return err
+	}
+	if !units.IsPositive() {
+		return fmt.Errorf("%s must be positive", args[1])
+	}
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	kept, taken, err := takeLots(conf.Investments, func(i investment) bool {
+		return i.Symbol == symbol && i.Account == from
+	}, units)
+	if err != nil {
+		return fmt.Errorf("%s in %q: %v", symbol, from, err)
+	}
+	for _, i := range taken {
+		i.Account = to
+		kept = append(kept, i)
+	}
+	conf.Investments = kept
+	if err := writeConfig(confFile, conf); err != nil {
+		return err
+	}
+	detail := fmt.Sprintf(conf.tr("moved %s %s in %d lots from %q to %q"), units, symbol, len(taken), from, to)
+	fmt.Fprintln(w, detail)
+	return appendAudit(confFile, auditEntry{Action: "transfer", Detail: detail})
+}
@@ -0,0 +1,467 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"golang.org/x/term"
+)
+
+// tuiRow is a lot as the TUI lists it.
+type tuiRow struct {
+	lot          investment
+	priced       bool
+	price, value decimal.Decimal
+	rate         float64 // compound interest
+	// history and details are what the lot's detail view shows, worked
+	// out on load since they can need fetched exchange rates
+	history []performance
+	details []string
+	err     error
+}
+
+// tuiData is one load of the portfolio, fetched away from the key loop so
+// that slow quotes do not freeze the screen.
+type tuiData struct {
+	conf   config
+	rows   []tuiRow
+	failed int
+	now    time.Time
+	err    error
+}
+
+// loadTUI prices the lots of confFile held now, the selected portfolio's
+// when there is one. Nothing is recorded.
+func loadTUI(ctx context.Context, confFile string) tuiData {
+	d := tuiData{now: clock()}
+	conf, err := parseConfig(confFile)
+	if err == nil {
+		conf, err = inPortfolio(conf)
+	}
+	if err != nil {
+		d.err = err
+		return d
+	}
+	store := newHistoryStore(confFile, conf)
+	if conf.fx, err = fxRates(ctx, conf, store, d.now, false); err != nil {
+		d.err = err
+		return d
+	}
+	prices := fetchPrices(ctx, conf, store, d.now, false)
+	d.conf = conf
+	latest := make(map[string]performance)
+	for _, i := range conf.Investments {
+		if i.Date.After(d.now) || i.Inactive != nil {
+			continue
+		}
+		r := tuiRow{lot: i}
+		if q := prices[priceKey{i.Symbol, i.Provider}]; q.err == nil {
+			r.priced, r.price, r.value, r.rate = true, q.price, i.Units.Mul(q.price), currentRate(i, q.price)
+			latest[i.Symbol] = performance{Symbol: i.Symbol, Date: d.now, Price: q.price, CompoundInterest: r.rate}
+		} else {
+			d.failed++
+		}
+		d.rows = append(d.rows, r)
+	}
+	for n, r := range d.rows {
+		if r.history, r.err = lotHistory(store, r.lot, latest, d.now); r.err == nil {
+			r.details = lotDetails(ctx, conf, store, r.lot, r.history, latest, nil, d.now)
+		}
+		d.rows[n] = r
+	}
+	return d
+}
+
+// tuiState is what the TUI shows: the holdings table, or with detail the
+// history of the lot under the cursor.
+type tuiState struct {
+	confFile string
+	data     tuiData
+	loading  bool
+	sortBy   string // "symbol", "value" or "return"
+	desc     bool
+	cursor   int
+	detail   bool
+	// prompt is the line being typed at the bottom, done runs with it on
+	// enter. confirm instead runs on the next key if it is y.
+	prompt  string
+	input   string
+	done    func(string)
+	confirm func()
+	msg     string
+}
+
+// tui runs "tui": a full screen table of the holdings, priced again every
+// refresh. Keys move the cursor, sort, open a lot's history and add or
+// remove lots.
+func tui(ctx context.Context, confFile string, refresh time.Duration) error {
+	in, out := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !term.IsTerminal(in) || !term.IsTerminal(out) {
+		return errors.New("tui needs a terminal")
+	}
+	if refresh < time.Second {
+		return errors.New("-refresh must be at least 1s")
+	}
+	old, err := term.MakeRaw(in)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(in, old)
+	// the alternate screen keeps the shell's scrollback intact
+	fmt.Print("\x1b[?1049h\x1b[?25l")
+	defer fmt.Print("\x1b[?25h\x1b[?1049l")
+
+	keys := make(chan string)
+	go readKeys(os.Stdin, keys)
+	loaded := make(chan tuiData)
+	s := &tuiState{confFile: confFile, sortBy: "value", desc: true}
+	reload := func() {
+		if !s.loading {
+			s.loading = true
+			go func() { loaded <- loadTUI(ctx, confFile) }()
+		}
+	}
+	reload()
+	tick := time.NewTicker(refresh)
+	defer tick.Stop()
+	for {
+		width, height, err := term.GetSize(out)
+		if err != nil {
+			width, height = 80, 24
+		}
+		io.WriteString(os.Stdout, s.render(width, height))
+		select {
+		case d := <-loaded:
+			s.loading = false
+			s.load(d)
+		case <-tick.C:
+			reload()
+		case k, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			quit, changed := s.key(k)
+			if quit {
+				return nil
+			}
+			if changed {
+				reload()
+			}
+		}
+	}
+}
+
+// readKeys sends the keys read from r to keys, naming the special ones,
+// until r fails.
+func readKeys(r io.Reader, keys chan<- string) {
+	defer close(keys)
+	buf := make([]byte, 64)
+	for {
+		n, err := r.Read(buf)
+		if err != nil {
+			return
+		}
+		switch s := string(buf[:n]); s {
+		case "\x1b[A", "\x1bOA":
+			keys <- "up"
+		case "\x1b[B", "\x1bOB":
+			keys <- "down"
+		case "\x1b":
+			keys <- "esc"
+		default:
+			if strings.HasPrefix(s, "\x1b") {
+				continue // other keys with escape sequences
+			}
+			// several keys come in one read when typed fast or pasted
+			for _, c := range s {
+				switch c {
+				case '\r', '\n':
+					keys <- "enter"
+				case 0x7f, '\b':
+					keys <- "backspace"
+				case 0x03:
+					keys <- "ctrl-c"
+				default:
+					keys <- string(c)
+				}
+			}
+		}
+	}
+}
+
+func (s *tuiState) load(d tuiData) {
+	if d.err != nil {
+		s.msg = d.err.Error()
+		return
+	}
+	s.data = d
+	if d.failed > 0 {
+		s.msg = fmt.Sprintf(s.data.conf.tr("%d lots could not be priced"), d.failed)
+	}
+	s.sortRows()
+}
+
+func (s *tuiState) sortRows() {
+	rows := s.data.rows
+	less := func(a, b int) bool { return rows[a].lot.Symbol < rows[b].lot.Symbol }
+	switch s.sortBy {
+	case "value":
+		less = func(a, b int) bool {
+			return s.data.conf.toBase(rows[a].lot.Currency, rows[a].value).LessThan(s.data.conf.toBase(rows[b].lot.Currency, rows[b].value))
+		}
+	case "return":
+		less = func(a, b int) bool { return rows[a].rate < rows[b].rate }
+	}
+	sort.SliceStable(rows, func(a, b int) bool {
+		if s.desc {
+			return less(b, a)
+		}
+		return less(a, b)
+	})
+	if s.cursor >= len(rows) {
+		s.cursor = len(rows) - 1
+	}
+	if s.cursor < 0 {
+		s.cursor = 0
+	}
+}
+
+// key handles a key, reporting whether to quit and whether the config
+// changed and the lots must be loaded again.
+func (s *tuiState) key(k string) (quit, changed bool) {
+	if s.confirm != nil {
+		confirm := s.confirm
+		s.confirm, s.prompt = nil, ""
+		if k == "y" || k == "Y" {
+			confirm()
+			return false, true
+		}
+		s.msg = ""
+		return false, false
+	}
+	if s.done != nil {
+		switch k {
+		case "enter":
+			done := s.done
+			s.done, s.prompt = nil, ""
+			done(s.input)
+			return false, true
+		case "esc", "ctrl-c":
+			s.done, s.prompt = nil, ""
+		case "backspace":
+			if r := []rune(s.input); len(r) > 0 {
+				s.input = string(r[:len(r)-1])
+			}
+		default:
+			if len([]rune(k)) == 1 && k >= " " {
+				s.input += k
+			}
+		}
+		return false, false
+	}
+	s.msg = ""
+	switch k {
+	case "q", "ctrl-c":
+		return true, false
+	case "esc":
+		s.detail = false
+	case "up", "k":
+		if s.cursor > 0 {
+			s.cursor--
+		}
+	case "down", "j":
+		if s.cursor < len(s.data.rows)-1 {
+			s.cursor++
+		}
+	case "enter":
+		s.detail = len(s.data.rows) > 0
+	case "s", "v", "r":
+		by := map[string]string{"s": "symbol", "v": "value", "r": "return"}[k]
+		if s.sortBy == by {
+			s.desc = !s.desc
+		} else {
+			s.sortBy, s.desc = by, by != "symbol"
+		}
+		s.sortRows()
+	case "u":
+		return false, true
+	case "a":
+		s.prompt, s.input = "add SYMBOL,DATE(mm/dd/yy),TOTAL,UNITS[,ACCOUNT[,CURRENCY]]: ", ""
+		s.done = func(line string) {
+			i, err := parseInvestmentLine(strings.TrimSpace(line))
+			if err == nil {
+				err = appendInvestment(s.confFile, i)
+			}
+			if err != nil {
+				s.msg = err.Error()
+				return
+			}
+			s.msg = fmt.Sprintf(s.data.conf.tr("adding %s"), describeInvestment(i))
+		}
+	case "d":
+		if len(s.data.rows) == 0 {
+			break
+		}
+		lot := s.data.rows[s.cursor].lot
+		s.prompt = fmt.Sprintf(s.data.conf.tr("removing %s"), describeInvestment(lot)) + "? (y/n)"
+		s.confirm = func() {
+			s.detail = false
+			if err := removeLot(s.confFile, lot); err != nil {
+				s.msg = err.Error()
+			}
+		}
+	}
+	return false, false
+}
+
+// removeLot removes the lot equal to lot from confFile.
+func removeLot(confFile string, lot investment) error {
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	sortConfig(conf)
+	for n, i := range conf.Investments {
+		if describeInvestment(i) == describeInvestment(lot) && i.Portfolio == lot.Portfolio && i.Provider == lot.Provider {
+			return deleteInvestment(confFile, conf, n)
+		}
+	}
+	return fmt.Errorf("%s is no longer in the config", describeInvestment(lot))
+}
+
+// render draws the whole screen, width by height characters.
+func (s *tuiState) render(width, height int) string {
+	conf := s.data.conf
+	if height < 8 {
+		height = 8
+	}
+	var lines []string
+	add := func(format string, args ...interface{}) {
+		lines = append(lines, clip(fmt.Sprintf(format, args...), width))
+	}
+	title := "stockstalk"
+	if name := selectedPortfolio(); name != "" {
+		title += " [" + name + "]"
+	}
+	if !s.data.now.IsZero() {
+		var cost, value decimal.Decimal
+		for _, r := range s.data.rows {
+			if r.priced {
+				cost = cost.Add(conf.toBase(r.lot.Currency, r.lot.basis()))
+				value = value.Add(conf.toBase(r.lot.Currency, r.value))
+			}
+		}
+		title += fmt.Sprintf("  %s %s, %s %s %s, %s", conf.tr("invested"), cost.StringFixed(2), conf.tr("value"),
+			value.StringFixed(2), conf.baseCurrency(), s.data.now.Format("15:04:05"))
+	}
+	if s.loading {
+		title += " ..."
+	}
+	add("%s", title)
+	add("")
+	if s.detail && s.cursor < len(s.data.rows) {
+		lines = append(lines, s.detailLines(width)...)
+	} else {
+		lines = append(lines, s.tableLines(width, height-5)...)
+	}
+	for len(lines) < height-2 {
+		lines = append(lines, "")
+	}
+	lines = lines[:height-2]
+	switch {
+	case s.prompt != "":
+		add("%s%s", s.prompt, s.input)
+	case s.detail:
+		add("esc back  d remove  q quit")
+	default:
+		add("↑↓ move  enter history  s/v/r sort by symbol/value/return  a add  d remove  u refresh  q quit")
+	}
+	add("%s", s.msg)
+	// in raw mode a newline only moves down, so each line returns too
+	return "\x1b[H\x1b[2J" + strings.Join(lines, "\r\n")
+}
+
+// tableLines lists the lots in at most rows lines, scrolled to keep the
+// cursor in view.
+func (s *tuiState) tableLines(width, rows int) []string {
+	conf := s.data.conf
+	arrow := map[bool]string{false: "↑", true: "↓"}[s.desc]
+	header := fmt.Sprintf("  %-10s %-9s %12s %12s %10s %12s %9s", conf.tr("Symbol"), conf.tr("Bought"), conf.tr("Units"),
+		conf.tr("Cost"), conf.tr("Price"), conf.tr("Value"), conf.tr("Return"))
+	lines := []string{clip(header+"  "+conf.tr("sorted by")+" "+s.sortBy+" "+arrow, width)}
+	first := 0
+	if rows > 1 && s.cursor >= rows-1 {
+		first = s.cursor - (rows - 2)
+	}
+	for n := first; n < len(s.data.rows) && len(lines) < rows; n++ {
+		r := s.data.rows[n]
+		mark := " "
+		if n == s.cursor {
+			mark = ">"
+		}
+		price, value, rate := "-", "-", "-"
+		if r.priced {
+			price, value, rate = r.price.StringFixed(2), r.value.StringFixed(2), fmt.Sprintf("%.2f %%", r.rate)
+		}
+		line := clip(fmt.Sprintf("%s %-10s %-9s %12s %12s %10s %12s %9s", mark, r.lot.Symbol, r.lot.Date.Format(humanDate),
+			r.lot.Units, r.lot.basis().StringFixed(2), price, value, rate), width)
+		if n == s.cursor {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// detailLines shows the lot under the cursor: its report details and
+// charts of its symbol's recorded history, as loaded.
+func (s *tuiState) detailLines(width int) []string {
+	d := s.data
+	r := s.data.rows[s.cursor]
+	lines := []string{clip(lotHeading(r.lot), width)}
+	if r.err != nil {
+		return append(lines, r.err.Error())
+	}
+	history := r.history
+	for _, l := range r.details {
+		lines = append(lines, clip(l, width))
+	}
+	if len(history) < 2 {
+		return append(lines, "", d.conf.tr("not enough recorded history to chart"))
+	}
+	price := make([]chartPoint, len(history))
+	rate := make([]chartPoint, len(history))
+	for n, p := range history {
+		price[n] = chartPoint{date: p.Date, value: p.Price.InexactFloat64()}
+		rate[n] = chartPoint{date: p.Date, value: p.CompoundInterest}
+	}
+	// room for the value labels right of the chart
+	w := width - 12
+	if w > 100 {
+		w = 100
+	}
+	if w < 10 {
+		return lines
+	}
+	lines = append(lines, "")
+	for _, c := range []string{termChart(d.conf.tr("price"), price, w, 2*termChartRows),
+		termChart(d.conf.tr("compound interest"), rate, w, 2*termChartRows)} {
+		lines = append(lines, strings.Split(strings.TrimSuffix(c, "\n"), "\n")...)
+	}
+	return lines
+}
+
+// clip cuts s to width characters.
+func clip(s string, width int) string {
+	if r := []rune(s); len(r) > width {
+		return string(r[:width])
+	}
+	return s
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// twr returns the annual time-weighted return, in percent, of holding lots
+// from the first purchase to now: the growth of the recorded prices,
+// chain-linked between the days they were recorded on so that when money
+// went in does not count. Lots enter at their cost. A day without a
+// recorded price for a symbol carries its last one forward, or before any
+// the cost per unit of its first lot. Dividends are left out and amounts
+// are converted to the base currency at today's rates.
+func twr(conf config, store historyStore, lots []investment, latest map[string]performance, now time.Time) (float64, error) {
+	if len(lots) == 0 {
+		return 0, errors.New("no lots")
+	}
+	lots = append([]investment(nil), lots...)
+	sort.SliceStable(lots, func(a, b int) bool { return lots[a].Date.Before(lots[b].Date) })
+	start := lots[0].Date
+	histories := make(map[string][]performance)
+	days := map[time.Time]bool{startOfDay(now): true}
+	for _, i := range lots {
+		days[startOfDay(i.Date)] = true
+		if _, ok := histories[i.Symbol]; ok {
+			continue
+		}
+		history, err := lotHistory(store, i, latest, now)
+		if err != nil {
+			return 0, err
+		}
+		// lots are sorted, so i is the first of its symbol
+		held := []performance{}
+		for _, p := range history {
+			if !startOfDay(p.Date).Before(startOfDay(i.Date)) {
+				held = append(held, p)
+				days[startOfDay(p.Date)] = true
+			}
+		}
+		histories[i.Symbol] = held
+	}
+	var dates []time.Time
+	for d := range days {
+		dates = append(dates, d)
+	}
+	sort.Slice(dates, func(a, b int) bool { return dates[a].Before(dates[b]) })
+
+	// price is the last recorded price of symbol on or before day, walking
+	// each history forward as the days go by.
+	next := make(map[string]int)
+	prices := make(map[string]decimal.Decimal)
+	price := func(symbol string, day time.Time) decimal.Decimal {
+		h := histories[symbol]
+		for next[symbol] < len(h) && !startOfDay(h[next[symbol]].Date).After(day) {
+			prices[symbol] = h[next[symbol]].Price
+			next[symbol]++
+		}
+		return prices[symbol]
+	}
+	growth, value := 1.0, 0.0
+	bought := 0
+	for _, day := range dates {
+		var in float64
+		for ; bought < len(lots) && !startOfDay(lots[bought].Date).After(day); bought++ {
+			i := lots[bought]
+			in += conf.toBase(i.Currency, i.basis()).InexactFloat64()
+			if _, ok := prices[i.Symbol]; !ok && i.Units.IsPositive() {
+				prices[i.Symbol] = i.basis().Div(i.Units)
+			}
+		}
+		var v float64
+		for _, i := range lots[:bought] {
+			v += conf.toBase(i.Currency, i.Units.Mul(price(i.Symbol, day))).InexactFloat64()
+		}
+		if value+in > 0 {
+			growth *= v / (value + in)
+		}
+		value = v
+	}
+	years := now.Sub(start).Seconds() / secondsPerYear
+	if years <= 0 || growth <= 0 {
+		return 0, errors.New("time-weighted return needs a holding period and a value")
+	}
+	return 100 * (math.Pow(growth, 1/years) - 1), nil
+}
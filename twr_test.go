@@ -0,0 +1,13 @@
+package main
+
+import "testing"
+
+func BenchmarkTWR(b *testing.B) {
+	conf, store, now := syntheticPortfolio(b, 50, 20, 3*365)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if _, err := twr(conf, store, conf.Investments, nil, now); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+const version = "0.2.0"
+
+// minConfigVersion is the oldest stockstalk that can rewrite configs written
+// by this one without dropping data. Raise it along with version whenever
+// the config gains something older versions would lose.
+const minConfigVersion = "0.2.0"
+
+// compareVersions compares dotted version numbers, returning -1, 0 or 1. An
+// empty version, as in configs that predate versioning, sorts first.
+func compareVersions(a, b string) int {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(as[i])
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(bs[i])
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
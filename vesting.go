@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// vest is a future date on which units of a holding become available: an
+// RSU vest or the end of an IPO lockup.
+type vest struct {
+	Symbol string          `json:"symbol"`
+	Date   time.Time       `json:"date"`
+	Units  decimal.Decimal `json:"units"`
+	Kind   string          `json:"kind,omitempty"` // vest (default) or lockup
+	// RemindDays is how many days ahead a reminder is sent, 7 by default.
+	RemindDays int `json:"remind_days,omitempty"`
+}
+
+func (v vest) kind() string {
+	if v.Kind == "" {
+		return "vest"
+	}
+	return v.Kind
+}
+
+func (v vest) remindDays() int {
+	if v.RemindDays <= 0 {
+		return 7
+	}
+	return v.RemindDays
+}
+
+// daysUntil counts calendar days from the day of now to the day of v.
+func (v vest) daysUntil(now time.Time) int {
+	day := func(t time.Time) time.Time { return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC) }
+	return int(day(v.Date).Sub(day(now)).Hours() / 24)
+}
+
+// vestAlerts returns a reminder for every vest or lockup expiry due within
+// its reminder window.
+func vestAlerts(conf config, now time.Time) []alert {
+	var active []alert
+	for _, v := range conf.Vests {
+		d := v.daysUntil(now)
+		if d < 0 || d > v.remindDays() {
+			continue
+		}
+		active = append(active, alert{
+			ID: fmt.Sprintf("%s-%s-%s", v.Symbol, v.kind(), v.Date.Format(isoDate)),
+			Message: fmt.Sprintf(conf.tr("%s %s of %s units on %s, in %d days"),
+				v.Symbol, conf.tr(v.kind()), v.Units, v.Date.Format(humanDate), d),
+		})
+	}
+	return active
+}
+
+// vestHorizon is how far ahead the upcoming vests table looks.
+const vestHorizon = 365
+
+func printVests(w io.Writer, conf config, latest map[string]performance, now time.Time) {
+	vests := append([]vest(nil), conf.Vests...)
+	sort.Slice(vests, func(i, j int) bool { return vests[i].Date.Before(vests[j].Date) })
+	fmt.Fprintf(w, "=== %s ===\n", conf.tr("Upcoming vests"))
+	var total decimal.Decimal
+	for _, v := range vests {
+		d := v.daysUntil(now)
+		if d < 0 || d > vestHorizon {
+			continue
+		}
+		fmt.Fprintf(w, "%s %s %s %s", v.Date.Format(humanDate), v.Symbol, conf.tr(v.kind()), v.Units)
+		if p, ok := latest[v.Symbol]; ok {
+			value := v.Units.Mul(p.Price)
+			total = total.Add(value)
+			fmt.Fprintf(w, " ~%s", value.StringFixed(2))
+		}
+		fmt.Fprintf(w, " (%d %s)\n", d, conf.tr("days"))
+	}
+	if total.IsPositive() {
+		fmt.Fprintf(w, "%s ~%s\n", conf.tr("total"), total.StringFixed(2))
+	}
+	fmt.Fprintf(w, "\n")
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// watch is a symbol followed without holding it.
+type watch struct {
+	Symbol string `json:"symbol"`
+	// Provider prices it like an investment's: a quote plugin, amfi or
+	// crypto.
+	Provider string `json:"provider,omitempty"`
+	// Screen is a buying condition checked on every run, such as
+	// "pe < 20 and price < ma50". See screenMetrics for the names it can use.
+	Screen string `json:"screen,omitempty"`
+}
+
+// screenMetrics returns the values screens can refer to by name.
+func screenMetrics(qs quoteSummary) map[string]float64 {
+	sd := qs.SummaryDetail
+	return map[string]float64{
+		"price":          qs.Price.RegularMarketPrice.Raw,
+		"change":         100 * qs.Price.RegularMarketChangePercent.Raw,
+		"pe":             sd.TrailingPE.Raw,
+		"market_cap":     sd.MarketCap.Raw,
+		"dividend_yield": 100 * sd.DividendYield.Raw,
+		"beta":           sd.Beta.Raw,
+		"ma50":           sd.FiftyDayAverage.Raw,
+		"ma200":          sd.TwoHundredDayAverage.Raw,
+		"high52":         sd.FiftyTwoWeekHigh.Raw,
+		"low52":          sd.FiftyTwoWeekLow.Raw,
+	}
+}
+
+// operand is either a metric name or, when metric is empty, a number.
+type operand struct {
+	metric string
+	value  float64
+}
+
+func parseOperand(s string) (operand, error) {
+	if v, err := strconv.ParseFloat(s, 64); err == nil {
+		return operand{value: v}, nil
+	}
+	if _, ok := screenMetrics(quoteSummary{})[s]; !ok {
+		return operand{}, fmt.Errorf("unknown metric %q", s)
+	}
+	return operand{metric: s}, nil
+}
+
+// eval returns the operand's value and whether it has one: providers leave
+// some metrics out, which Yahoo reports as zero.
+func (o operand) eval(metrics map[string]float64) (float64, bool) {
+	if o.metric == "" {
+		return o.value, true
+	}
+	v := metrics[o.metric]
+	return v, v != 0
+}
+
+type condition struct {
+	left, right operand
+	op          string
+}
+
+// parseScreen parses conditions joined by "and". Tokens must be separated by
+// spaces: "pe < 20 and price < ma50".
+func parseScreen(expr string) ([]condition, error) {
+	if strings.TrimSpace(expr) == "" {
+		return nil, nil
+	}
+	var conds []condition
+	for _, part := range strings.Split(expr, " and ") {
+		f := strings.Fields(part)
+		if len(f) != 3 {
+			return nil, fmt.Errorf("bad condition %q, want e.g. \"pe < 20\"", strings.TrimSpace(part))
+		}
+		switch f[1] {
+		case "<", "<=", ">", ">=", "==":
+		default:
+			return nil, fmt.Errorf("bad operator %q in %q", f[1], strings.TrimSpace(part))
+		}
+		left, err := parseOperand(f[0])
+		if err != nil {
+			return nil, err
+		}
+		right, err := parseOperand(f[2])
+		if err != nil {
+			return nil, err
+		}
+		conds = append(conds, condition{left: left, op: f[1], right: right})
+	}
+	return conds, nil
+}
+
+// matches reports whether all conditions hold. A condition on a metric with
+// no value never holds.
+func matches(conds []condition, metrics map[string]float64) bool {
+	for _, c := range conds {
+		l, lok := c.left.eval(metrics)
+		r, rok := c.right.eval(metrics)
+		if !lok || !rok {
+			return false
+		}
+		var ok bool
+		switch c.op {
+		case "<":
+			ok = l < r
+		case "<=":
+			ok = l <= r
+		case ">":
+			ok = l > r
+		case ">=":
+			ok = l >= r
+		case "==":
+			ok = l == r
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// printWatchlist writes the latest price, day change and 52-week range of
+// each watchlist symbol. The range is Yahoo's, so it is left out for
+// symbols priced by another provider.
+func printWatchlist(ctx context.Context, w io.Writer, conf config, store historyStore, now time.Time) {
+	fmt.Fprintf(w, "=== %s ===\n", conf.tr("Watchlist"))
+	for _, s := range conf.Watchlist {
+		q, err := cachedQuote(ctx, conf, store, investment{Symbol: s.Symbol, Provider: s.Provider}, now)
+		if err != nil {
+			fmt.Fprintf(w, "%s %s: %v\n", s.Symbol, conf.tr("unavailable"), err)
+			continue
+		}
+		line := fmt.Sprintf("%s %s", s.Symbol, q.Price.StringFixed(2))
+		if q.PreviousClose.IsPositive() {
+			change := 100 * (q.Price.InexactFloat64()/q.PreviousClose.InexactFloat64() - 1)
+			line += fmt.Sprintf(" %+.2f %%", change)
+		}
+		if s.Provider == "" {
+			qs, err := cachedSummary(ctx, store, s.Symbol, "summaryDetail", 24*time.Hour)
+			if err != nil {
+				perr(err)
+			} else if sd := qs.SummaryDetail; sd.FiftyTwoWeekHigh.Raw > 0 {
+				line += fmt.Sprintf(", %s %.2f-%.2f", conf.tr("52w"), sd.FiftyTwoWeekLow.Raw, sd.FiftyTwoWeekHigh.Raw)
+			}
+		}
+		fmt.Fprintln(w, line)
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+// printScreener lists the watchlist symbols whose screen passes.
+func printScreener(ctx context.Context, w io.Writer, conf config) {
+	var screened []watch
+	for _, s := range conf.Watchlist {
+		if s.Screen != "" {
+			screened = append(screened, s)
+		}
+	}
+	if len(screened) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "=== %s ===\n", conf.tr("Screener matches"))
+	for _, s := range screened {
+		conds, err := parseScreen(s.Screen)
+		if err != nil {
+			fmt.Fprintf(w, "%s: %v\n", s.Symbol, err)
+			continue
+		}
+		qs, err := fetchQuoteSummary(ctx, s.Symbol, "summaryDetail", "price")
+		if err != nil {
+			fmt.Fprintf(w, "%s %s: %v\n", s.Symbol, conf.tr("unavailable"), err)
+			continue
+		}
+		if matches(conds, screenMetrics(qs)) {
+			fmt.Fprintf(w, "%s %.2f: %s\n", s.Symbol, qs.Price.RegularMarketPrice.Raw, s.Screen)
+		}
+	}
+	fmt.Fprintf(w, "\n")
+}
+
+// watchSymbols handles "watch": with no arguments it lists the watchlist,
+// otherwise it adds a symbol to it or removes one.
+func watchSymbols(w io.Writer, confFile string, args []string, provider, screen string) error {
+	conf, err := parseConfig(confFile)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		for _, s := range conf.Watchlist {
+			line := s.Symbol
+			if s.Provider != "" {
+				line = s.Provider + ":" + line
+			}
+			if s.Screen != "" {
+				line += " " + s.Screen
+			}
+			fmt.Fprintln(w, line)
+		}
+		return nil
+	}
+	if len(args) != 2 {
+		return errUsage
+	}
+	symbol := strings.ToUpper(args[1])
+	switch args[0] {
+	case "add":
+		if k := strings.Index(args[1], ":"); k > 0 {
+			if _, ok := builtinProviders[args[1][:k]]; ok && (provider == "" || provider == args[1][:k]) {
+				provider, symbol = args[1][:k], strings.ToUpper(args[1][k+1:])
+			}
+		}
+		if provider != "" {
+			if b, ok := builtinProviders[provider]; ok {
+				if b.currency(symbol) == "" {
+					return fmt.Errorf("%s cannot price %s", provider, symbol)
+				}
+			} else if _, err := findPlugin(conf.Plugins, provider, pluginQuote); err != nil {
+				return err
+			}
+		}
+		if _, err := parseScreen(screen); err != nil {
+			return err
+		}
+		for _, s := range conf.Watchlist {
+			if s.Symbol == symbol {
+				return fmt.Errorf("%s is already on the watchlist", symbol)
+			}
+		}
+		conf.Watchlist = append(conf.Watchlist, watch{Symbol: symbol, Provider: provider, Screen: screen})
+	case "remove":
+		n := -1
+		for k, s := range conf.Watchlist {
+			if s.Symbol == symbol {
+				n = k
+			}
+		}
+		if n < 0 {
+			return fmt.Errorf("%s is not on the watchlist", symbol)
+		}
+		conf.Watchlist = append(conf.Watchlist[:n], conf.Watchlist[n+1:]...)
+	default:
+		return errUsage
+	}
+	return writeConfig(confFile, conf)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// yahooValue is how the quoteSummary API encodes numbers and dates: the raw
+// value alongside a formatted one. Dates are raw Unix seconds.
+type yahooValue struct {
+	Raw float64 `json:"raw"`
+	Fmt string  `json:"fmt"`
+}
+
+func (v yahooValue) time() time.Time {
+	return time.Unix(int64(v.Raw), 0)
+}
+
+// quoteSummary holds the quoteSummary modules stockstalk reads. Modules
+// that were not requested are left zero.
+type quoteSummary struct {
+	CalendarEvents struct {
+		Earnings struct {
+			EarningsDate []yahooValue `json:"earningsDate"`
+		} `json:"earnings"`
+	} `json:"calendarEvents"`
+	FinancialData financialData `json:"financialData"`
+	ESGScores     struct {
+		TotalESG         yahooValue `json:"totalEsg"`
+		EnvironmentScore yahooValue `json:"environmentScore"`
+		SocialScore      yahooValue `json:"socialScore"`
+		GovernanceScore  yahooValue `json:"governanceScore"`
+	} `json:"esgScores"`
+	SummaryDetail summaryDetail `json:"summaryDetail"`
+	Price         struct {
+		RegularMarketPrice         yahooValue `json:"regularMarketPrice"`
+		RegularMarketChangePercent yahooValue `json:"regularMarketChangePercent"` // fraction
+		Currency                   string     `json:"currency"`
+	} `json:"price"`
+	FundProfile struct {
+		FeesExpensesInvestment struct {
+			AnnualReportExpenseRatio yahooValue `json:"annualReportExpenseRatio"` // fraction
+		} `json:"feesExpensesInvestment"`
+	} `json:"fundProfile"`
+	InsiderTransactions struct {
+		Transactions []insiderTransaction `json:"transactions"`
+	} `json:"insiderTransactions"`
+}
+
+type summaryDetail struct {
+	TrailingPE    yahooValue `json:"trailingPE"`
+	MarketCap     yahooValue `json:"marketCap"`
+	DividendYield yahooValue `json:"dividendYield"` // fraction, 0.012 for 1.2%
+	Beta          yahooValue `json:"beta"`
+
+	FiftyDayAverage      yahooValue `json:"fiftyDayAverage"`
+	TwoHundredDayAverage yahooValue `json:"twoHundredDayAverage"`
+	FiftyTwoWeekHigh     yahooValue `json:"fiftyTwoWeekHigh"`
+	FiftyTwoWeekLow      yahooValue `json:"fiftyTwoWeekLow"`
+}
+
+// insiderTransaction is one Form 4 filing.
+type insiderTransaction struct {
+	FilerName       string     `json:"filerName"`
+	FilerRelation   string     `json:"filerRelation"`
+	TransactionText string     `json:"transactionText"` // e.g. "Sale at price 190.00 per share."
+	StartDate       yahooValue `json:"startDate"`
+	Shares          yahooValue `json:"shares"`
+	Value           yahooValue `json:"value"`
+}
+
+type financialData struct {
+	CurrentPrice            yahooValue `json:"currentPrice"`
+	TargetMeanPrice         yahooValue `json:"targetMeanPrice"`
+	RecommendationKey       string     `json:"recommendationKey"`  // e.g. buy, hold
+	RecommendationMean      yahooValue `json:"recommendationMean"` // 1 strong buy to 5 sell
+	NumberOfAnalystOpinions yahooValue `json:"numberOfAnalystOpinions"`
+}
+
+var yahooClient http.Client
+
+// fetchQuoteSummary fetches the given quoteSummary modules for symbol.
+func fetchQuoteSummary(ctx context.Context, symbol string, modules ...string) (quoteSummary, error) {
+	var qs quoteSummary
+	err := fetchRetry.do(ctx, "yahoo", func(ctx context.Context) (err error) {
+		qs, err = fetchQuoteSummaryOnce(ctx, symbol, modules...)
+		return err
+	})
+	return qs, err
+}
+
+func fetchQuoteSummaryOnce(ctx context.Context, symbol string, modules ...string) (quoteSummary, error) {
+	u := fmt.Sprintf("https://query2.finance.yahoo.com/v10/finance/quoteSummary/%s?modules=%s",
+		url.PathEscape(symbol), url.QueryEscape(strings.Join(modules, ",")))
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return quoteSummary{}, err
+	}
+	// Yahoo throttles requests that do not look like they come from a browser.
+	req.Header.Set("User-Agent", "Mozilla/5.0")
+	resp, err := yahooClient.Do(req)
+	if err != nil {
+		return quoteSummary{}, err
+	}
+	defer resp.Body.Close()
+	var body struct {
+		QuoteSummary struct {
+			Result []quoteSummary `json:"result"`
+			Error  *struct {
+				Description string `json:"description"`
+			} `json:"error"`
+		} `json:"quoteSummary"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return quoteSummary{}, fmt.Errorf("%s: %s: %v", symbol, resp.Status, err)
+	}
+	if e := body.QuoteSummary.Error; e != nil {
+		return quoteSummary{}, fmt.Errorf("%s: %s", symbol, e.Description)
+	}
+	if len(body.QuoteSummary.Result) == 0 {
+		return quoteSummary{}, fmt.Errorf("%s: no data", symbol)
+	}
+	return body.QuoteSummary.Result[0], nil
+}